@@ -15,6 +15,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -22,11 +23,17 @@ import (
 	"net"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"runtime"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/creack/pty"
 	"github.com/nubificus/urunc/pkg/unikontainers"
+	"github.com/nubificus/urunc/pkg/unikontainers/hypervisors"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 	"golang.org/x/sys/unix"
@@ -65,6 +72,9 @@ var createCommand = cli.Command{
 		cli.BoolFlag{
 			Name: "reexec",
 		},
+		cli.BoolFlag{
+			Name: "monitor",
+		},
 	},
 	Action: func(context *cli.Context) error {
 		logrus.WithField("command", "CREATE").WithField("args", os.Args).Debug("urunc INVOKED")
@@ -76,6 +86,10 @@ var createCommand = cli.Command{
 			return createUnikontainer(context)
 		}
 
+		if context.Bool("monitor") {
+			return monitorUnikontainer(context)
+		}
+
 		return reexecUnikontainer(context)
 	},
 }
@@ -251,6 +265,17 @@ func createUnikontainer(context *cli.Context) (err error) {
 	containerPid := reexecPid
 	metrics.Capture(containerID, "TS06")
 
+	// Place the reexec process in the cgroup of the container, before it
+	// spawns the monitor.
+	rootless, err := isRootless(context)
+	if err != nil {
+		return err
+	}
+	err = unikontainer.SetupCgroup(containerPid, context.GlobalBool("systemd-cgroup"), rootless)
+	if err != nil {
+		return err
+	}
+
 	err = unikontainer.Create(containerPid)
 	if err != nil {
 		return err
@@ -349,7 +374,8 @@ func handleNsenterRet(initSock *os.File, reexec *exec.Cmd) (int, error) {
 // sends ReexecStarted message to init.sock,
 // waits AckReexec message on urunc.sock,
 // waits StartExecve message on urunc.sock,
-// executes Prestart hooks and finally execve's the unikernel vmm.
+// executes Prestart hooks and finally spawns and supervises the
+// process that execve's the unikernel vmm.
 func reexecUnikontainer(context *cli.Context) error {
 	// No need to check if containerID is valid, because it will get
 	// checked later. We just want it for the metrics
@@ -413,6 +439,151 @@ func reexecUnikontainer(context *cli.Context) error {
 		return err
 	}
 
+	return superviseMonitor(unikontainer)
+}
+
+// superviseMonitor spawns the process that will execve the monitor and
+// waits for it to exit. Any signal received in the meantime is forwarded
+// to the monitor, except for the first SIGTERM or SIGINT, which triggers a
+// graceful shutdown of the guest. When the monitor exits, its exit status gets decoded
+// to the exit code of the guest, which is saved in state.json and used as
+// the exit code of urunc.
+func superviseMonitor(unikontainer *unikontainers.Unikontainer) error {
+	exitHandler, err := unikontainer.NewExitHandler()
+	if err != nil {
+		return err
+	}
+
+	// The parent death signal is sent when the thread that created the
+	// child exits. Make sure that this thread stays around.
+	runtime.LockOSThread()
+	monitorCommand := createMonitorCmd()
+	sigs := make(chan os.Signal, 128)
+	signal.Notify(sigs)
+	err = monitorCommand.Start()
+	if err != nil {
+		return fmt.Errorf("failed to start monitor process: %w", err)
+	}
+	go forwardSignals(sigs, unikontainer, monitorCommand.Process)
+	// The supervisor stays in the network namespace of the container,
+	// hence it serves DHCP to the guest for as long as the monitor runs.
+	dhcpCtx, stopDHCP := context.WithCancel(context.Background())
+	defer stopDHCP()
+	go func() {
+		err := unikontainer.ServeDHCP(dhcpCtx)
+		if err != nil {
+			logrus.WithError(err).Error("failed to serve DHCP to the unikernel")
+		}
+	}()
+	// Boot the guest concurrently, so we can reap the monitor even if it
+	// exits before it gets configured.
+	go func() {
+		err := unikontainer.BootMonitor(monitorCommand.Process.Pid)
+		if err != nil {
+			logrus.WithError(err).Error("failed to boot the unikernel")
+			_ = monitorCommand.Process.Kill()
+		}
+	}()
+
+	err = monitorCommand.Wait()
+	signal.Stop(sigs)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return fmt.Errorf("failed to wait monitor process: %w", err)
+		}
+	}
+
+	status, ok := monitorCommand.ProcessState.Sys().(syscall.WaitStatus)
+	if !ok {
+		return fmt.Errorf("failed to get the exit status of the monitor")
+	}
+	exitCode, err := exitHandler.HandleExit(status)
+	if err != nil {
+		logrus.WithError(err).Error("failed to save the exit code of the unikernel")
+	}
+	if exitCode != 0 {
+		return cli.NewExitError("", exitCode)
+	}
+	return nil
+}
+
+// forwardSignals forwards every received signal to the monitor process.
+// The first SIGTERM or SIGINT asks the monitor to gracefully shut down the
+// guest instead. If the guest does not exit in the configured stop timeout,
+// the monitor gets killed.
+func forwardSignals(sigs <-chan os.Signal, unikontainer *unikontainers.Unikontainer, monitor *os.Process) {
+	stopping := false
+	for sig := range sigs {
+		switch sig {
+		case unix.SIGCHLD, unix.SIGURG, unix.SIGPIPE:
+			// SIGCHLD refers to our own children and SIGURG is used
+			// internally by the Go runtime for preemption.
+			continue
+		case unix.SIGTERM, unix.SIGINT:
+			if stopping {
+				break
+			}
+			stopping = true
+			timeout := unikontainer.StopTimeout()
+			time.AfterFunc(timeout, func() {
+				logrus.Warn("guest did not shut down in time, killing the monitor")
+				_ = monitor.Kill()
+			})
+			err := unikontainer.GracefulStop(monitor.Pid)
+			if err == nil {
+				continue
+			}
+			if !errors.Is(err, hypervisors.ErrStopNotSupported) {
+				logrus.WithError(err).Error("failed to gracefully stop the guest")
+			}
+			// Fall back to forwarding the signal to the monitor
+		}
+		err := monitor.Signal(sig)
+		if err != nil {
+			logrus.WithError(err).Debugf("failed to forward signal %s to monitor", sig)
+		}
+	}
+}
+
+func createMonitorCmd() *exec.Cmd {
+	selfPath := "/proc/self/exe"
+	monitorCommand := &exec.Cmd{
+		Path:   selfPath,
+		Args:   append(os.Args, "--monitor"),
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+		SysProcAttr: &syscall.SysProcAttr{
+			// The monitor process will pivot to the rootfs of
+			// the container. Use a separate mount namespace,
+			// so that the supervisor keeps its own view and
+			// can still access the state of the container.
+			Cloneflags: unix.CLONE_NEWNS,
+			Pdeathsig:  unix.SIGKILL,
+		},
+	}
+	// Do not pass the nsenter related environment variables, since we have
+	// already joined the container namespaces and the respective pipes
+	// are closed.
+	for _, env := range os.Environ() {
+		if !strings.HasPrefix(env, "_LIBCONTAINER_") {
+			monitorCommand.Env = append(monitorCommand.Env, env)
+		}
+	}
+
+	return monitorCommand
+}
+
+// monitorUnikontainer gets a Unikernel struct from state.json and
+// execve's the unikernel vmm.
+func monitorUnikontainer(context *cli.Context) error {
+	// get Unikontainer data from state.json
+	unikontainer, err := getUnikontainer(context)
+	if err != nil {
+		return err
+	}
+
 	// execve
 	return unikontainer.Exec()
 }
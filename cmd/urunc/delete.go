@@ -55,10 +55,7 @@ status of "ubuntu01" as "stopped" the following will delete resources held for
 			return err
 		}
 		if context.Bool("force") {
-			err := unikontainer.Kill()
-			if err != nil {
-				return err
-			}
+			return unikontainer.ForceDelete()
 		}
 		return unikontainer.Delete()
 	},
@@ -0,0 +1,101 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// event is a line of the output of the events command, as in runc
+type event struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	Data any    `json:"data,omitempty"`
+}
+
+var eventsCommand = cli.Command{
+	Name:  "events",
+	Usage: "display container events such as the statistics of the unikernel",
+	ArgsUsage: `<container-id>
+
+Where "<container-id>" is the name for the instance of the container.`,
+	Description: `The events command displays the statistics of the unikernel, as reported
+by the monitor through its control socket, at the given interval.`,
+	Flags: []cli.Flag{
+		cli.DurationFlag{
+			Name:  "interval",
+			Value: 5 * time.Second,
+			Usage: "set the stats collection interval",
+		},
+		cli.BoolFlag{
+			Name:  "stats",
+			Usage: "display the container's stats then exit",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		logrus.WithField("command", "EVENTS").WithField("args", os.Args).Debug("urunc INVOKED")
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+		interval := context.Duration("interval")
+		if interval <= 0 {
+			return fmt.Errorf("duration interval must be greater than 0")
+		}
+
+		// get Unikontainer data from state.json
+		unikontainer, err := getUnikontainer(context)
+		if err != nil {
+			return err
+		}
+		status, err := unikontainer.RefreshStatus()
+		if err != nil {
+			return err
+		}
+		if status == specs.StateStopped {
+			return fmt.Errorf("container %s is not running", unikontainer.State.ID)
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		for {
+			stats, err := unikontainer.Stats()
+			if err != nil {
+				return err
+			}
+			err = enc.Encode(event{Type: "stats", ID: unikontainer.State.ID, Data: stats})
+			if err != nil {
+				return err
+			}
+			if context.Bool("stats") {
+				return nil
+			}
+			time.Sleep(interval)
+			// Stop once the unikernel exits
+			status, err = unikontainer.RefreshStatus()
+			if err != nil {
+				return err
+			}
+			if status == specs.StateStopped {
+				return nil
+			}
+		}
+	},
+}
@@ -15,11 +15,15 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"runtime"
+	"strconv"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
+	"golang.org/x/sys/unix"
 )
 
 var killCommand = cli.Command{
@@ -57,6 +61,31 @@ signal to the init process of the "ubuntu01" container:
 		if err != nil {
 			return err
 		}
-		return unikontainer.Kill()
+		signal, err := parseSignal(context.Args().Get(1))
+		if err != nil {
+			return err
+		}
+		return unikontainer.Kill(signal, context.Bool("all"))
 	},
 }
+
+// parseSignal parses a signal given either as a number or as a name, with or
+// without the SIG prefix. If no signal is given, SIGTERM is returned.
+func parseSignal(rawSignal string) (unix.Signal, error) {
+	if rawSignal == "" {
+		return unix.SIGTERM, nil
+	}
+	s, err := strconv.Atoi(rawSignal)
+	if err == nil {
+		return unix.Signal(s), nil
+	}
+	name := strings.ToUpper(rawSignal)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	signal := unix.SignalNum(name)
+	if signal == 0 {
+		return -1, fmt.Errorf("unknown signal %q", rawSignal)
+	}
+	return signal, nil
+}
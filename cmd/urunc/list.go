@@ -0,0 +1,147 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/nubificus/urunc/pkg/unikontainers"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// containerListEntry holds the information of a unikernel container
+// shown by the list command
+type containerListEntry struct {
+	ID         string `json:"id"`
+	Pid        int    `json:"pid"`
+	Status     string `json:"status"`
+	Bundle     string `json:"bundle"`
+	Unikernel  string `json:"unikernel"`
+	Hypervisor string `json:"hypervisor"`
+	ExitCode   *int   `json:"exitCode,omitempty"`
+}
+
+var listCommand = cli.Command{
+	Name:  "list",
+	Usage: "lists unikernel containers started by urunc with the given root",
+	ArgsUsage: `
+
+Where the given root is specified via the global option "--root"
+(default: "/run/urunc").
+
+EXAMPLE 1:
+To list unikernel containers created via the default "--root":
+       # urunc list
+
+EXAMPLE 2:
+To list unikernel containers created using a non-default value for "--root":
+       # urunc --root value list`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "format, f",
+			Value: "table",
+			Usage: `select one of: table or json`,
+		},
+		cli.BoolFlag{
+			Name:  "quiet, q",
+			Usage: "display only container IDs",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		logrus.WithField("command", "LIST").WithField("args", os.Args).Debug("urunc INVOKED")
+		if err := checkArgs(context, 0, exactArgs); err != nil {
+			return err
+		}
+
+		// We have already made sure in main.go that root is not nil
+		rootDir := context.GlobalString("root")
+		entries, err := getContainerListEntries(rootDir)
+		if err != nil {
+			return err
+		}
+
+		if context.Bool("quiet") {
+			for _, entry := range entries {
+				fmt.Println(entry.ID)
+			}
+			return nil
+		}
+
+		switch context.String("format") {
+		case "table":
+			w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+			fmt.Fprint(w, "ID\tPID\tSTATUS\tEXIT CODE\tBUNDLE\tUNIKERNEL\tHYPERVISOR\n")
+			for _, entry := range entries {
+				exitCode := "-"
+				if entry.ExitCode != nil {
+					exitCode = strconv.Itoa(*entry.ExitCode)
+				}
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+					entry.ID,
+					entry.Pid,
+					entry.Status,
+					exitCode,
+					entry.Bundle,
+					entry.Unikernel,
+					entry.Hypervisor)
+			}
+			return w.Flush()
+		case "json":
+			if entries == nil {
+				entries = []containerListEntry{}
+			}
+			return json.NewEncoder(os.Stdout).Encode(entries)
+		default:
+			return fmt.Errorf("invalid format option: %s", context.String("format"))
+		}
+	},
+}
+
+// getContainerListEntries loads the state of every unikernel container
+// under rootDir and makes sure that its status is up to date.
+func getContainerListEntries(rootDir string) ([]containerListEntry, error) {
+	unikontainerList, err := unikontainers.List(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []containerListEntry
+	for _, u := range unikontainerList {
+		status, err := u.RefreshStatus()
+		if err != nil {
+			logrus.WithError(err).WithField("id", u.State.ID).Warn("failed to refresh container status")
+		}
+		pid := u.State.Pid
+		if status == specs.StateStopped {
+			pid = 0
+		}
+		entries = append(entries, containerListEntry{
+			ID:         u.State.ID,
+			Pid:        pid,
+			Status:     string(status),
+			Bundle:     u.State.Bundle,
+			Unikernel:  u.UnikernelType(),
+			Hypervisor: u.Hypervisor(),
+			ExitCode:   u.Runtime.ExitCode,
+		})
+	}
+	return entries, nil
+}
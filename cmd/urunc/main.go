@@ -100,11 +100,17 @@ func main() {
 	app.Commands = []cli.Command{
 		createCommand,
 		deleteCommand,
+		eventsCommand,
 		killCommand,
+		listCommand,
+		pauseCommand,
+		psCommand,
+		resumeCommand,
 		runCommand,
+		snapshotCommand,
 		// specCommand,
 		startCommand,
-		// stateCommand,
+		stateCommand,
 	}
 	app.Before = func(context *cli.Context) error {
 		if err := reviseRootDir(context); err != nil {
@@ -0,0 +1,74 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+var pauseCommand = cli.Command{
+	Name:  "pause",
+	Usage: "pause suspends the execution of the unikernel in the container",
+	ArgsUsage: `<container-id>
+
+Where "<container-id>" is the name for the instance of the container to be
+paused.`,
+	Description: `The pause command suspends the execution of the unikernel, by stopping
+its vCPUs through the control socket of the monitor.
+
+Use urunc list to identify instances of containers and their current status.`,
+	Action: func(context *cli.Context) error {
+		logrus.WithField("command", "PAUSE").WithField("args", os.Args).Debug("urunc INVOKED")
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+
+		// get Unikontainer data from state.json
+		unikontainer, err := getUnikontainer(context)
+		if err != nil {
+			return err
+		}
+		return unikontainer.Pause()
+	},
+}
+
+var resumeCommand = cli.Command{
+	Name:  "resume",
+	Usage: "resumes the execution of a paused unikernel",
+	ArgsUsage: `<container-id>
+
+Where "<container-id>" is the name for the instance of the container to be
+resumed.`,
+	Description: `The resume command resumes the execution of a unikernel that was
+previously paused.
+
+Use urunc list to identify instances of containers and their current status.`,
+	Action: func(context *cli.Context) error {
+		logrus.WithField("command", "RESUME").WithField("args", os.Args).Debug("urunc INVOKED")
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+
+		// get Unikontainer data from state.json
+		unikontainer, err := getUnikontainer(context)
+		if err != nil {
+			return err
+		}
+		return unikontainer.Resume()
+	},
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+var psCommand = cli.Command{
+	Name:  "ps",
+	Usage: "ps displays the monitor process of a unikernel container and its children",
+	ArgsUsage: `<container-id>
+
+Where "<container-id>" is the name for the instance of the container.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "format, f",
+			Value: "table",
+			Usage: `select one of: table or json`,
+		},
+	},
+	Action: func(context *cli.Context) error {
+		logrus.WithField("command", "PS").WithField("args", os.Args).Debug("urunc INVOKED")
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+
+		// get Unikontainer data from state.json
+		unikontainer, err := getUnikontainer(context)
+		if err != nil {
+			return err
+		}
+
+		processes, err := unikontainer.Processes()
+		if err != nil {
+			return err
+		}
+
+		switch context.String("format") {
+		case "table":
+			w := tabwriter.NewWriter(os.Stdout, 8, 1, 3, ' ', 0)
+			fmt.Fprint(w, "PID\tPPID\tCMD\n")
+			for _, p := range processes {
+				fmt.Fprintf(w, "%d\t%d\t%s\n", p.Pid, p.PPid, p.Command)
+			}
+			return w.Flush()
+		case "json":
+			return json.NewEncoder(os.Stdout).Encode(processes)
+		default:
+			return fmt.Errorf("invalid format option: %s", context.String("format"))
+		}
+	},
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+var snapshotCommand = cli.Command{
+	Name:  "snapshot",
+	Usage: "snapshot saves the state and the memory of a paused unikernel",
+	ArgsUsage: `<container-id>
+
+Where "<container-id>" is the name for the instance of the container to be
+snapshotted.`,
+	Description: `The snapshot command saves the state of the VM and the memory of a paused
+unikernel through the control socket of the monitor. The snapshot is stored in
+the control directory of the container, as <name>.vmstate and <name>.mem.
+
+Use urunc pause to pause the unikernel first.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "name",
+			Value: "snapshot",
+			Usage: "the name of the snapshot files",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		logrus.WithField("command", "SNAPSHOT").WithField("args", os.Args).Debug("urunc INVOKED")
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+
+		// get Unikontainer data from state.json
+		unikontainer, err := getUnikontainer(context)
+		if err != nil {
+			return err
+		}
+		return unikontainer.Snapshot(context.String("name"))
+	},
+}
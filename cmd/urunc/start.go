@@ -60,5 +60,10 @@ func startUnikontainer(context *cli.Context) error {
 	}
 	metrics.Capture(containerID, "TS13")
 
+	err = unikontainer.SetRunning()
+	if err != nil {
+		return err
+	}
+
 	return unikontainer.ExecuteHooks("Poststart")
 }
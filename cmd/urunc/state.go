@@ -0,0 +1,78 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// containerStateOutput is the output of the state command. Along with the
+// OCI state, it includes the exit code of the guest, if it has exited, and
+// the configuration file of the monitor, if there is one.
+type containerStateOutput struct {
+	specs.State
+	ExitCode      *int   `json:"exitCode,omitempty"`
+	MonitorConfig string `json:"monitorConfig,omitempty"`
+}
+
+var stateCommand = cli.Command{
+	Name:  "state",
+	Usage: "output the state of a container",
+	ArgsUsage: `<container-id>
+
+Where "<container-id>" is your name for the instance of the container.`,
+	Description: `The state command outputs current state information for the
+instance of a container.`,
+	Action: func(context *cli.Context) error {
+		logrus.WithField("command", "STATE").WithField("args", os.Args).Debug("urunc INVOKED")
+		if err := checkArgs(context, 1, exactArgs); err != nil {
+			return err
+		}
+
+		// get Unikontainer data from state.json
+		unikontainer, err := getUnikontainer(context)
+		if err != nil {
+			return err
+		}
+
+		// Make sure the status reflects the actual state of the monitor
+		status, err := unikontainer.RefreshStatus()
+		if err != nil {
+			return err
+		}
+
+		state := containerStateOutput{
+			State:         *unikontainer.State,
+			ExitCode:      unikontainer.Runtime.ExitCode,
+			MonitorConfig: unikontainer.MonitorConfigFile(),
+		}
+		// According to the OCI runtime spec, the pid is only required
+		// when the container is created or running.
+		if status == specs.StateStopped {
+			state.Pid = 0
+		}
+		data, err := json.MarshalIndent(state, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(append(data, '\n'))
+		return err
+	},
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strconv"
 	"syscall"
 
 	"github.com/nubificus/urunc/pkg/unikontainers"
@@ -99,6 +100,20 @@ func runcExec() error {
 	return syscall.Exec(args[0], args, os.Environ()) //nolint: gosec
 }
 
+// isRootless parses the global rootless flag. In "auto" mode, urunc is
+// considered rootless, if it is not running as root.
+func isRootless(context *cli.Context) (bool, error) {
+	rootless := context.GlobalString("rootless")
+	if rootless == "" || rootless == "auto" {
+		return os.Geteuid() != 0, nil
+	}
+	value, err := strconv.ParseBool(rootless)
+	if err != nil {
+		return false, fmt.Errorf("invalid value for --rootless: %s", rootless)
+	}
+	return value, nil
+}
+
 // newSockPair returns a new SOCK_STREAM unix socket pair.
 func newSockPair(name string) (parent, child *os.File, err error) {
 	fds, err := unix.Socketpair(unix.AF_LOCAL, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
@@ -15,9 +15,13 @@
 package constants
 
 const (
+	// The default static network, which Knative expects
+	StaticNetworkSubnet      = "172.16.1.0/24"
 	StaticNetworkTapIP       = "172.16.1.1"
 	StaticNetworkUnikernelIP = "172.16.1.2"
 	// TODO: Experiment with DynamicNetworkTapIP starting from 172.16.X.1
-	DynamicNetworkTapIP  = "172.16.X.2"
-	QueueProxyRedirectIP = "172.16.1.2"
+	DynamicNetworkTapIP = "172.16.X.2"
+	// The IP of the unikernels that do not use the IP of the pod, when
+	// multiple unikernels share the same network namespace
+	DynamicNetworkGuestIP = "172.16.X.3"
 )
@@ -0,0 +1,55 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	t.Run("new file", func(t *testing.T) {
+		t.Parallel()
+		path := filepath.Join(t.TempDir(), "state.json")
+		assert.NoError(t, WriteFileAtomic(path, []byte("new"), 0o600))
+		content, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, "new", string(content))
+		info, err := os.Stat(path)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	})
+	t.Run("replace file", func(t *testing.T) {
+		t.Parallel()
+		dir := t.TempDir()
+		path := filepath.Join(dir, "state.json")
+		assert.NoError(t, os.WriteFile(path, []byte("old content"), 0o600))
+		assert.NoError(t, WriteFileAtomic(path, []byte("new"), 0o600))
+		content, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, "new", string(content))
+		entries, err := os.ReadDir(dir)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1, "Expected no temporary file to be left behind")
+	})
+	t.Run("missing directory", func(t *testing.T) {
+		t.Parallel()
+		path := filepath.Join(t.TempDir(), "missing", "state.json")
+		assert.Error(t, WriteFileAtomic(path, []byte("new"), 0o600))
+	})
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unixsock
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// The usable length of sun_path, without the terminating NUL
+const maxAddrLen = 107
+
+// EnsureValidAddr checks that addr fits in the address of a unix socket
+func EnsureValidAddr(addr string) error {
+	if addr == "" {
+		return fmt.Errorf("socket address is empty")
+	}
+	if len(addr) > maxAddrLen {
+		return fmt.Errorf("socket address \"%s\" is too long", addr)
+	}
+	return nil
+}
+
+// shortAddr returns an address that reaches the socket at path and fits in
+// sun_path. The directories of containers can be too deep (e.g. under the
+// root of the containerd shim), hence a long path gets reached through the
+// file descriptor of its directory in /proc/self/fd. The returned function
+// closes that descriptor and it has to be called once the address is used.
+func shortAddr(path string) (string, func(), error) {
+	if len(path) <= maxAddrLen {
+		return path, func() {}, nil
+	}
+	dir := filepath.Dir(path)
+	fd, err := unix.Open(dir, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to open %s: %w", dir, err)
+	}
+	release := func() {
+		_ = unix.Close(fd)
+	}
+	addr := filepath.Join("/proc/self/fd", strconv.Itoa(fd), filepath.Base(path))
+	err = EnsureValidAddr(addr)
+	if err != nil {
+		release()
+		return "", nil, err
+	}
+	return addr, release, nil
+}
+
+// DialContext connects to the unix socket at path, regardless of the length
+// of path
+func DialContext(ctx context.Context, path string) (net.Conn, error) {
+	addr, release, err := shortAddr(path)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	var d net.Dialer
+	return d.DialContext(ctx, "unix", addr)
+}
+
+// Listen creates a unix socket at path and listens on it, regardless of the
+// length of path. Closing the listener does not remove the socket, since the
+// address might not reach it any more.
+func Listen(path string) (*net.UnixListener, error) {
+	addr, release, err := shortAddr(path)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: addr, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	listener.SetUnlinkOnClose(false)
+	return listener, nil
+}
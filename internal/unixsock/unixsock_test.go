@@ -0,0 +1,83 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unixsock
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnsureValidAddr(t *testing.T) {
+	validSockAddr := "/tmp/valid.sock"
+	emptySockAddr := ""
+	longSockAddr := string(make([]byte, 109))
+
+	assert.NoError(t, EnsureValidAddr(validSockAddr), "Expected no error for valid socket address")
+	assert.Error(t, EnsureValidAddr(emptySockAddr), "Expected error for empty socket address")
+	assert.Error(t, EnsureValidAddr(longSockAddr), "Expected error for long socket address")
+	assert.Error(t, EnsureValidAddr(strings.Repeat("a", 108)), "Expected error for address without room for NUL")
+}
+
+func TestListenDial(t *testing.T) {
+	t.Run("short path", func(t *testing.T) {
+		t.Parallel()
+		path := filepath.Join(t.TempDir(), "test.sock")
+		listener, err := Listen(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+		conn, err := DialContext(context.Background(), path)
+		assert.NoError(t, err)
+		if conn != nil {
+			conn.Close()
+		}
+	})
+	t.Run("path longer than sun_path", func(t *testing.T) {
+		t.Parallel()
+		// As in /run/containerd/runc/k8s.io/<container ID>/control
+		dir := filepath.Join(t.TempDir(), "k8s.io", strings.Repeat("f", 64), "control")
+		err := os.MkdirAll(dir, 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, "test.sock")
+		assert.Greater(t, len(path), maxAddrLen)
+
+		listener, err := Listen(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+		_, err = os.Stat(path)
+		assert.NoError(t, err)
+
+		conn, err := DialContext(context.Background(), path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		accepted, err := listener.Accept()
+		assert.NoError(t, err)
+		if accepted != nil {
+			accepted.Close()
+		}
+	})
+}
@@ -0,0 +1,509 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	dhcpServerPort = 67
+	dhcpClientPort = 68
+
+	// The IP of the guest never changes, but some clients do not handle
+	// infinite leases well. The server renews the lease as long as the
+	// unikernel runs.
+	dhcpLeaseTime = 24 * 60 * 60
+
+	bootRequest     = 1
+	bootReply       = 2
+	dhcpMagicCookie = 0x63825363
+	// The fixed part of a DHCP message, up to the magic cookie
+	dhcpHeaderLen = 240
+	// Some clients drop messages shorter than the minimum BOOTP message
+	dhcpMinMessageLen = 300
+	dhcpBroadcastFlag = 0x8000
+
+	ethHeaderLen  = 14
+	ipv4HeaderLen = 20
+	udpHeaderLen  = 8
+)
+
+// DHCP message types
+const (
+	dhcpDiscover byte = 1
+	dhcpOffer    byte = 2
+	dhcpRequest  byte = 3
+	dhcpAck      byte = 5
+	dhcpNak      byte = 6
+	dhcpInform   byte = 8
+)
+
+// DHCP options
+const (
+	optPad         byte = 0
+	optSubnetMask  byte = 1
+	optRouter      byte = 3
+	optDNSServers  byte = 6
+	optHostname    byte = 12
+	optDomainName  byte = 15
+	optRequestedIP byte = 50
+	optLeaseTime   byte = 51
+	optMessageType byte = 53
+	optServerID    byte = 54
+	optEnd         byte = 255
+)
+
+// DHCPLease holds the network configuration that the DHCP server of urunc
+// hands to a guest.
+type DHCPLease struct {
+	IP         net.IP
+	Mask       net.IPMask
+	Gateway    net.IP
+	ServerIP   net.IP
+	DNSServers []net.IP
+	Domain     string
+	Hostname   string
+}
+
+// NewDHCPLease creates the lease of a guest with the IPv4 configuration of
+// info. The nameservers and the search domains are the ones of the
+// container. Since DHCP does not carry IPv6 configuration, IPv6 nameservers
+// get ignored.
+func NewDHCPLease(info Interface, nameservers []string, search []string, hostname string) (DHCPLease, error) {
+	ip := net.ParseIP(info.IP).To4()
+	if ip == nil {
+		return DHCPLease{}, fmt.Errorf("interface %s has no IPv4 address", info.Interface)
+	}
+	maskIP := net.ParseIP(info.Mask).To4()
+	if maskIP == nil {
+		return DHCPLease{}, fmt.Errorf("invalid mask %q of interface %s", info.Mask, info.Interface)
+	}
+	lease := DHCPLease{
+		IP:       ip,
+		Mask:     net.IPMask(maskIP),
+		Hostname: hostname,
+	}
+	if info.DefaultGateway != "" {
+		lease.Gateway = net.ParseIP(info.DefaultGateway).To4()
+		if lease.Gateway == nil {
+			return DHCPLease{}, fmt.Errorf("invalid gateway %q of interface %s", info.DefaultGateway, info.Interface)
+		}
+	}
+	for _, nameserver := range nameservers {
+		if dnsIP := net.ParseIP(nameserver).To4(); dnsIP != nil {
+			lease.DNSServers = append(lease.DNSServers, dnsIP)
+		}
+	}
+	if len(search) > 0 {
+		lease.Domain = search[0]
+	}
+	lease.ServerIP = dhcpServerIP(lease)
+	return lease, nil
+}
+
+// dhcpServerIP returns the address that the DHCP server uses as its
+// identifier. The guest talks only to the gateway, hence it is the gateway,
+// if there is one. Otherwise, it is the first address of the subnet, which
+// is not the address of the guest.
+func dhcpServerIP(lease DHCPLease) net.IP {
+	if lease.Gateway != nil {
+		return lease.Gateway
+	}
+	serverIP := lease.IP.Mask(lease.Mask)
+	serverIP[3]++
+	if serverIP.Equal(lease.IP) {
+		serverIP[3]++
+	}
+	return serverIP
+}
+
+// dhcpMessage holds the fields of a DHCP message that the server needs
+type dhcpMessage struct {
+	op      byte
+	xid     uint32
+	flags   uint16
+	ciaddr  net.IP
+	yiaddr  net.IP
+	chaddr  net.HardwareAddr
+	options map[byte][]byte
+}
+
+func (m dhcpMessage) messageType() byte {
+	value := m.options[optMessageType]
+	if len(value) != 1 {
+		return 0
+	}
+	return value[0]
+}
+
+// parseDHCPMessage parses a DHCP message from the payload of a UDP packet
+func parseDHCPMessage(data []byte) (dhcpMessage, error) {
+	if len(data) < dhcpHeaderLen {
+		return dhcpMessage{}, fmt.Errorf("DHCP message is too short")
+	}
+	// Only Ethernet addresses are expected
+	if data[1] != 1 || data[2] != 6 {
+		return dhcpMessage{}, fmt.Errorf("unsupported hardware address type %d", data[1])
+	}
+	if binary.BigEndian.Uint32(data[236:240]) != dhcpMagicCookie {
+		return dhcpMessage{}, fmt.Errorf("invalid DHCP magic cookie")
+	}
+	msg := dhcpMessage{
+		op:      data[0],
+		yiaddr:  net.IP(bytes.Clone(data[16:20])),
+		xid:     binary.BigEndian.Uint32(data[4:8]),
+		flags:   binary.BigEndian.Uint16(data[10:12]),
+		ciaddr:  net.IP(bytes.Clone(data[12:16])),
+		chaddr:  net.HardwareAddr(bytes.Clone(data[28:34])),
+		options: make(map[byte][]byte),
+	}
+	options := data[dhcpHeaderLen:]
+	for len(options) > 0 {
+		code := options[0]
+		if code == optEnd {
+			break
+		}
+		if code == optPad {
+			options = options[1:]
+			continue
+		}
+		if len(options) < 2 || len(options) < 2+int(options[1]) {
+			return dhcpMessage{}, fmt.Errorf("truncated DHCP option %d", code)
+		}
+		length := int(options[1])
+		msg.options[code] = options[2 : 2+length]
+		options = options[2+length:]
+	}
+	if msg.messageType() == 0 {
+		return dhcpMessage{}, fmt.Errorf("missing DHCP message type")
+	}
+	return msg, nil
+}
+
+// reply returns the type of the reply of the server to req, or 0 if the
+// server should not reply.
+func (l DHCPLease) reply(req dhcpMessage) byte {
+	if req.op != bootRequest {
+		return 0
+	}
+	switch req.messageType() {
+	case dhcpDiscover:
+		return dhcpOffer
+	case dhcpRequest:
+		// The guest selected another server
+		serverID, ok := req.options[optServerID]
+		if ok && !net.IP(serverID).Equal(l.ServerIP) {
+			return 0
+		}
+		requested := net.IP(req.options[optRequestedIP])
+		if len(requested) == 0 {
+			// A renewing guest sets its address in ciaddr
+			requested = req.ciaddr
+		}
+		if !requested.Equal(l.IP) {
+			return dhcpNak
+		}
+		return dhcpAck
+	case dhcpInform:
+		return dhcpAck
+	default:
+		// The address of the guest is reserved, hence there is nothing to do
+		// for the rest of the messages (e.g. DHCPRELEASE)
+		return 0
+	}
+}
+
+// encode builds a DHCP reply of msgType to req
+func (l DHCPLease) encode(req dhcpMessage, msgType byte) []byte {
+	msg := make([]byte, dhcpHeaderLen, dhcpMinMessageLen)
+	msg[0] = bootReply
+	msg[1] = 1
+	msg[2] = 6
+	binary.BigEndian.PutUint32(msg[4:8], req.xid)
+	binary.BigEndian.PutUint16(msg[10:12], req.flags)
+	copy(msg[28:34], req.chaddr)
+	binary.BigEndian.PutUint32(msg[236:240], dhcpMagicCookie)
+	msg = appendDHCPOption(msg, optMessageType, msgType)
+	msg = appendDHCPOption(msg, optServerID, l.ServerIP...)
+	if msgType == dhcpNak {
+		return padDHCPMessage(append(msg, optEnd))
+	}
+	if msgType == dhcpAck && req.messageType() == dhcpInform {
+		// The guest has already configured its address
+		copy(msg[12:16], req.ciaddr)
+	} else {
+		copy(msg[16:20], l.IP)
+		lease := binary.BigEndian.AppendUint32(nil, dhcpLeaseTime)
+		msg = appendDHCPOption(msg, optLeaseTime, lease...)
+	}
+	msg = appendDHCPOption(msg, optSubnetMask, l.Mask...)
+	if l.Gateway != nil {
+		msg = appendDHCPOption(msg, optRouter, l.Gateway...)
+	}
+	if len(l.DNSServers) > 0 {
+		var servers []byte
+		for _, server := range l.DNSServers {
+			servers = append(servers, server...)
+		}
+		msg = appendDHCPOption(msg, optDNSServers, servers...)
+	}
+	if l.Domain != "" {
+		msg = appendDHCPOption(msg, optDomainName, []byte(l.Domain)...)
+	}
+	if l.Hostname != "" {
+		msg = appendDHCPOption(msg, optHostname, []byte(l.Hostname)...)
+	}
+	return padDHCPMessage(append(msg, optEnd))
+}
+
+// appendDHCPOption appends an option to a DHCP message. Values longer than
+// the maximum length of an option get truncated.
+func appendDHCPOption(msg []byte, code byte, value ...byte) []byte {
+	if len(value) > 255 {
+		value = value[:255]
+	}
+	msg = append(msg, code, byte(len(value)))
+	return append(msg, value...)
+}
+
+func padDHCPMessage(msg []byte) []byte {
+	for len(msg) < dhcpMinMessageLen {
+		msg = append(msg, optPad)
+	}
+	return msg
+}
+
+// parseDHCPFrame parses a DHCP message to port from an Ethernet frame
+func parseDHCPFrame(frame []byte, port uint16) (dhcpMessage, error) {
+	if len(frame) < ethHeaderLen+ipv4HeaderLen+udpHeaderLen {
+		return dhcpMessage{}, fmt.Errorf("frame is too short")
+	}
+	if binary.BigEndian.Uint16(frame[12:14]) != unix.ETH_P_IP {
+		return dhcpMessage{}, fmt.Errorf("not an IPv4 packet")
+	}
+	ip := frame[ethHeaderLen:]
+	ihl := int(ip[0]&0x0f) * 4
+	if ip[0]>>4 != 4 || ihl < ipv4HeaderLen || len(ip) < ihl+udpHeaderLen {
+		return dhcpMessage{}, fmt.Errorf("invalid IPv4 header")
+	}
+	if ip[9] != unix.IPPROTO_UDP {
+		return dhcpMessage{}, fmt.Errorf("not a UDP packet")
+	}
+	udp := ip[ihl:]
+	if binary.BigEndian.Uint16(udp[2:4]) != port {
+		return dhcpMessage{}, fmt.Errorf("not a DHCP message to port %d", port)
+	}
+	udpLen := int(binary.BigEndian.Uint16(udp[4:6]))
+	if udpLen < udpHeaderLen || udpLen > len(udp) {
+		return dhcpMessage{}, fmt.Errorf("invalid UDP length %d", udpLen)
+	}
+	return parseDHCPMessage(udp[udpHeaderLen:udpLen])
+}
+
+// replyFrame builds the Ethernet frame, which carries the reply to req, from
+// the device with srcMAC. As in RFC 2131, the reply goes to the address of a
+// configured guest, or is broadcast if the guest asked for it or if it is a
+// DHCPNAK. Otherwise, it goes to the offered address and the MAC of the guest.
+func (l DHCPLease) replyFrame(srcMAC net.HardwareAddr, req dhcpMessage) ([]byte, bool) {
+	msgType := l.reply(req)
+	if msgType == 0 {
+		return nil, false
+	}
+	payload := l.encode(req, msgType)
+	dstMAC := req.chaddr
+	dstIP := net.IP(payload[16:20])
+	if !req.ciaddr.Equal(net.IPv4zero) {
+		dstIP = req.ciaddr
+	}
+	if msgType == dhcpNak || (req.ciaddr.Equal(net.IPv4zero) && req.flags&dhcpBroadcastFlag != 0) {
+		dstMAC = net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+		dstIP = net.IPv4bcast.To4()
+	}
+
+	udpLen := udpHeaderLen + len(payload)
+	frame := make([]byte, ethHeaderLen+ipv4HeaderLen+udpLen)
+	copy(frame[0:6], dstMAC)
+	copy(frame[6:12], srcMAC)
+	binary.BigEndian.PutUint16(frame[12:14], unix.ETH_P_IP)
+
+	ip := frame[ethHeaderLen : ethHeaderLen+ipv4HeaderLen]
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], uint16(ipv4HeaderLen+udpLen)) //nolint:gosec
+	ip[8] = 64
+	ip[9] = unix.IPPROTO_UDP
+	copy(ip[12:16], l.ServerIP)
+	copy(ip[16:20], dstIP)
+	binary.BigEndian.PutUint16(ip[10:12], checksum(ip, 0))
+
+	udp := frame[ethHeaderLen+ipv4HeaderLen:]
+	binary.BigEndian.PutUint16(udp[0:2], dhcpServerPort)
+	binary.BigEndian.PutUint16(udp[2:4], dhcpClientPort)
+	binary.BigEndian.PutUint16(udp[4:6], uint16(udpLen)) //nolint:gosec
+	copy(udp[udpHeaderLen:], payload)
+	// The checksum of UDP covers a pseudo header with the addresses, the
+	// protocol and the length
+	pseudo := uint32(unix.IPPROTO_UDP) + uint32(udpLen)
+	for i := 12; i < 20; i += 2 {
+		pseudo += uint32(binary.BigEndian.Uint16(ip[i : i+2]))
+	}
+	udpChecksum := checksum(udp, pseudo)
+	if udpChecksum == 0 {
+		udpChecksum = 0xffff
+	}
+	binary.BigEndian.PutUint16(udp[6:8], udpChecksum)
+	return frame, true
+}
+
+// checksum returns the Internet checksum of data, starting from sum
+func checksum(data []byte, sum uint32) uint16 {
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i : i+2]))
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return ^uint16(sum)
+}
+
+// dhcpFilter is a classic BPF program, which accepts only the IPv4 UDP
+// packets to the DHCP server port, in order to avoid copying the rest of the
+// traffic of the guest.
+var dhcpFilter = []unix.SockFilter{
+	// Drop anything but IPv4
+	{Code: unix.BPF_LD | unix.BPF_H | unix.BPF_ABS, K: 12},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 0, Jf: 8, K: unix.ETH_P_IP},
+	// Drop anything but UDP
+	{Code: unix.BPF_LD | unix.BPF_B | unix.BPF_ABS, K: ethHeaderLen + 9},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 0, Jf: 6, K: unix.IPPROTO_UDP},
+	// Drop fragments
+	{Code: unix.BPF_LD | unix.BPF_H | unix.BPF_ABS, K: ethHeaderLen + 6},
+	{Code: unix.BPF_JMP | unix.BPF_JSET | unix.BPF_K, Jt: 4, Jf: 0, K: 0x1fff},
+	// Load the length of the IPv4 header and check the destination port
+	{Code: unix.BPF_LDX | unix.BPF_B | unix.BPF_MSH, K: ethHeaderLen},
+	{Code: unix.BPF_LD | unix.BPF_H | unix.BPF_IND, K: ethHeaderLen + 2},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 0, Jf: 1, K: dhcpServerPort},
+	{Code: unix.BPF_RET | unix.BPF_K, K: 0xffff},
+	{Code: unix.BPF_RET | unix.BPF_K, K: 0},
+}
+
+// htons converts a short from the host to the network byte order
+func htons(v uint16) uint16 {
+	return binary.NativeEndian.Uint16(binary.BigEndian.AppendUint16(nil, v))
+}
+
+// listenDHCP opens a packet socket, which receives the DHCP requests that
+// arrive at the device with ifIndex and sends the replies through it.
+//
+// The TC filters of the tap devices redirect the traffic of the guest before
+// it reaches the network stack, hence a UDP socket would never receive the
+// requests. Packet sockets of all protocols receive the traffic before the TC
+// filters though.
+func listenDHCP(ifIndex int) (*os.File, error) {
+	// A socket of protocol 0 does not receive anything, until it gets bound
+	// to a protocol. Hence, the filter applies to every received packet.
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create packet socket: %w", err)
+	}
+	err = unix.SetsockoptSockFprog(fd, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, &unix.SockFprog{
+		Len:    uint16(len(dhcpFilter)),
+		Filter: &dhcpFilter[0],
+	})
+	if err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to attach DHCP filter: %w", err)
+	}
+	err = unix.Bind(fd, &unix.SockaddrLinklayer{
+		Protocol: htons(unix.ETH_P_ALL),
+		Ifindex:  ifIndex,
+	})
+	if err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to bind packet socket: %w", err)
+	}
+	// A non-blocking file uses the poller of the runtime, hence closing it
+	// interrupts a pending read.
+	return os.NewFile(uintptr(fd), "dhcp"), nil
+}
+
+// ServeDHCP answers the DHCP requests of the guest behind the tap device
+// with the lease, until ctx gets canceled.
+func ServeDHCP(ctx context.Context, device string, lease DHCPLease) error {
+	link, err := netlink.LinkByName(device)
+	if err != nil {
+		return fmt.Errorf("failed to find %s: %w", device, err)
+	}
+	conn, err := listenDHCP(link.Attrs().Index)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer func() {
+		if stop() {
+			conn.Close()
+		}
+	}()
+
+	netlog.WithField("device", device).Debugf("serving %s over DHCP", lease)
+	srcMAC := link.Attrs().HardwareAddr
+	buf := make([]byte, 65536)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil && errors.Is(err, os.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("failed to receive DHCP request on %s: %w", device, err)
+		}
+		req, err := parseDHCPFrame(buf[:n], dhcpServerPort)
+		if err != nil {
+			netlog.WithError(err).Debugf("ignoring packet on %s", device)
+			continue
+		}
+		frame, ok := lease.replyFrame(srcMAC, req)
+		if !ok {
+			continue
+		}
+		_, err = conn.Write(frame)
+		if err != nil {
+			netlog.WithError(err).Warnf("failed to send DHCP reply on %s", device)
+		}
+	}
+}
+
+// String returns the lease in a form suitable for logs
+func (l DHCPLease) String() string {
+	var dns []string
+	for _, server := range l.DNSServers {
+		dns = append(dns, server.String())
+	}
+	return fmt.Sprintf("ip=%s mask=%s gateway=%s dns=%s", l.IP, net.IP(l.Mask), l.Gateway, strings.Join(dns, ","))
+}
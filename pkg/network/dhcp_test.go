@@ -0,0 +1,254 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testGuestMAC  = net.HardwareAddr{0x02, 0x42, 0xac, 0x11, 0x00, 0x02}
+	testServerMAC = net.HardwareAddr{0x02, 0x42, 0xac, 0x11, 0x00, 0x01}
+)
+
+// dhcpRequestFrame builds the frame of a DHCP message of a guest without an
+// address, as a DHCP client would send it.
+func dhcpRequestFrame(msgType byte, ciaddr net.IP, flags uint16, options ...[]byte) []byte {
+	msg := make([]byte, dhcpHeaderLen)
+	msg[0] = bootRequest
+	msg[1] = 1
+	msg[2] = 6
+	binary.BigEndian.PutUint32(msg[4:8], 0xdeadbeef)
+	binary.BigEndian.PutUint16(msg[10:12], flags)
+	copy(msg[12:16], ciaddr.To4())
+	copy(msg[28:34], testGuestMAC)
+	binary.BigEndian.PutUint32(msg[236:240], dhcpMagicCookie)
+	msg = appendDHCPOption(msg, optMessageType, msgType)
+	for _, option := range options {
+		msg = append(msg, option...)
+	}
+	msg = append(msg, optEnd)
+
+	frame := make([]byte, ethHeaderLen+ipv4HeaderLen+udpHeaderLen, ethHeaderLen+ipv4HeaderLen+udpHeaderLen+len(msg))
+	copy(frame[0:6], net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	copy(frame[6:12], testGuestMAC)
+	binary.BigEndian.PutUint16(frame[12:14], 0x0800)
+	ip := frame[ethHeaderLen:]
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], uint16(ipv4HeaderLen+udpHeaderLen+len(msg)))
+	ip[9] = 17
+	copy(ip[16:20], net.IPv4bcast.To4())
+	udp := ip[ipv4HeaderLen:]
+	binary.BigEndian.PutUint16(udp[0:2], dhcpClientPort)
+	binary.BigEndian.PutUint16(udp[2:4], dhcpServerPort)
+	binary.BigEndian.PutUint16(udp[4:6], uint16(udpHeaderLen+len(msg)))
+	return append(frame, msg...)
+}
+
+func dhcpOption(code byte, value ...byte) []byte {
+	return appendDHCPOption(nil, code, value...)
+}
+
+func testLease(t *testing.T) DHCPLease {
+	lease, err := NewDHCPLease(Interface{
+		IP:             "10.244.1.5",
+		Mask:           "255.255.255.0",
+		DefaultGateway: "10.244.1.1",
+		Interface:      "eth0",
+	}, []string{"10.96.0.10", "fd00::10"}, []string{"default.svc.cluster.local", "svc.cluster.local"}, "nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lease
+}
+
+// exchange passes a request frame through the server and returns the reply
+// frame, if any, and the parsed reply.
+func exchange(t *testing.T, lease DHCPLease, frame []byte) ([]byte, dhcpMessage, bool) {
+	req, err := parseDHCPFrame(frame, dhcpServerPort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replyFrame, ok := lease.replyFrame(testServerMAC, req)
+	if !ok {
+		return nil, dhcpMessage{}, false
+	}
+	reply, err := parseDHCPFrame(replyFrame, dhcpClientPort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return replyFrame, reply, true
+}
+
+func TestNewDHCPLease(t *testing.T) {
+	t.Run("with gateway", func(t *testing.T) {
+		t.Parallel()
+		lease := testLease(t)
+		assert.Equal(t, "10.244.1.5", lease.IP.String())
+		assert.Equal(t, "ffffff00", lease.Mask.String())
+		assert.Equal(t, "10.244.1.1", lease.Gateway.String())
+		assert.Equal(t, "10.244.1.1", lease.ServerIP.String())
+		assert.Equal(t, []net.IP{net.IPv4(10, 96, 0, 10).To4()}, lease.DNSServers)
+		assert.Equal(t, "default.svc.cluster.local", lease.Domain)
+		assert.Equal(t, "nginx", lease.Hostname)
+	})
+
+	t.Run("without gateway", func(t *testing.T) {
+		t.Parallel()
+		lease, err := NewDHCPLease(Interface{IP: "192.168.10.1", Mask: "255.255.255.0"}, nil, nil, "")
+		assert.NoError(t, err)
+		assert.Nil(t, lease.Gateway)
+		assert.Equal(t, "192.168.10.2", lease.ServerIP.String())
+	})
+
+	t.Run("without IPv4", func(t *testing.T) {
+		t.Parallel()
+		_, err := NewDHCPLease(Interface{IPv6: "fd00::5", Interface: "eth0"}, nil, nil, "")
+		assert.Error(t, err)
+	})
+}
+
+func TestDHCPReplies(t *testing.T) {
+	lease := testLease(t)
+	serverID := dhcpOption(optServerID, lease.ServerIP...)
+
+	t.Run("discover", func(t *testing.T) {
+		t.Parallel()
+		frame, reply, ok := exchange(t, lease, dhcpRequestFrame(dhcpDiscover, net.IPv4zero, 0))
+		if !ok {
+			t.Fatal("expected a DHCP reply")
+		}
+		assert.Equal(t, dhcpOffer, reply.messageType())
+		assert.Equal(t, uint32(0xdeadbeef), reply.xid)
+		assert.Equal(t, "10.244.1.5", reply.yiaddr.String())
+		assert.Equal(t, []byte(lease.ServerIP), reply.options[optServerID])
+		assert.Equal(t, []byte{255, 255, 255, 0}, reply.options[optSubnetMask])
+		assert.Equal(t, []byte{10, 244, 1, 1}, reply.options[optRouter])
+		assert.Equal(t, []byte{10, 96, 0, 10}, reply.options[optDNSServers])
+		assert.Equal(t, "default.svc.cluster.local", string(reply.options[optDomainName]))
+		assert.Equal(t, "nginx", string(reply.options[optHostname]))
+		assert.Equal(t, []byte{0, 1, 0x51, 0x80}, reply.options[optLeaseTime])
+		// Unicast to the offered address and the MAC of the guest
+		assert.Equal(t, []byte(testGuestMAC), frame[0:6])
+		assert.Equal(t, []byte(testServerMAC), frame[6:12])
+		assert.Equal(t, []byte{10, 244, 1, 5}, frame[ethHeaderLen+16:ethHeaderLen+20])
+		assert.GreaterOrEqual(t, len(frame), ethHeaderLen+ipv4HeaderLen+udpHeaderLen+dhcpMinMessageLen)
+	})
+
+	t.Run("checksums", func(t *testing.T) {
+		t.Parallel()
+		frame, _, ok := exchange(t, lease, dhcpRequestFrame(dhcpDiscover, net.IPv4zero, 0))
+		if !ok {
+			t.Fatal("expected a DHCP reply")
+		}
+		ip := frame[ethHeaderLen : ethHeaderLen+ipv4HeaderLen]
+		assert.Equal(t, uint16(0), checksum(ip, 0))
+		udp := frame[ethHeaderLen+ipv4HeaderLen:]
+		pseudo := uint32(17) + uint32(len(udp))
+		for i := 12; i < 20; i += 2 {
+			pseudo += uint32(binary.BigEndian.Uint16(ip[i : i+2]))
+		}
+		assert.Equal(t, uint16(0), checksum(udp, pseudo))
+	})
+
+	t.Run("broadcast flag", func(t *testing.T) {
+		t.Parallel()
+		frame, _, ok := exchange(t, lease, dhcpRequestFrame(dhcpDiscover, net.IPv4zero, dhcpBroadcastFlag))
+		if !ok {
+			t.Fatal("expected a DHCP reply")
+		}
+		assert.Equal(t, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, frame[0:6])
+		assert.Equal(t, []byte{255, 255, 255, 255}, frame[ethHeaderLen+16:ethHeaderLen+20])
+	})
+
+	t.Run("request", func(t *testing.T) {
+		t.Parallel()
+		_, reply, ok := exchange(t, lease, dhcpRequestFrame(dhcpRequest, net.IPv4zero, 0,
+			serverID, dhcpOption(optRequestedIP, 10, 244, 1, 5)))
+		if !ok {
+			t.Fatal("expected a DHCP reply")
+		}
+		assert.Equal(t, dhcpAck, reply.messageType())
+		assert.Equal(t, "10.244.1.5", reply.yiaddr.String())
+	})
+
+	t.Run("renew", func(t *testing.T) {
+		t.Parallel()
+		frame, reply, ok := exchange(t, lease, dhcpRequestFrame(dhcpRequest, net.IPv4(10, 244, 1, 5), 0))
+		if !ok {
+			t.Fatal("expected a DHCP reply")
+		}
+		assert.Equal(t, dhcpAck, reply.messageType())
+		assert.Equal(t, []byte{10, 244, 1, 5}, frame[ethHeaderLen+16:ethHeaderLen+20])
+	})
+
+	t.Run("request of another address", func(t *testing.T) {
+		t.Parallel()
+		frame, reply, ok := exchange(t, lease, dhcpRequestFrame(dhcpRequest, net.IPv4zero, 0,
+			dhcpOption(optRequestedIP, 10, 244, 1, 6)))
+		if !ok {
+			t.Fatal("expected a DHCP reply")
+		}
+		assert.Equal(t, dhcpNak, reply.messageType())
+		assert.Equal(t, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, frame[0:6])
+	})
+
+	t.Run("request to another server", func(t *testing.T) {
+		t.Parallel()
+		_, _, ok := exchange(t, lease, dhcpRequestFrame(dhcpRequest, net.IPv4zero, 0,
+			dhcpOption(optServerID, 10, 244, 1, 254), dhcpOption(optRequestedIP, 10, 244, 1, 5)))
+		assert.False(t, ok)
+	})
+
+	t.Run("inform", func(t *testing.T) {
+		t.Parallel()
+		_, reply, ok := exchange(t, lease, dhcpRequestFrame(dhcpInform, net.IPv4(10, 244, 1, 5), 0))
+		if !ok {
+			t.Fatal("expected a DHCP reply")
+		}
+		assert.Equal(t, dhcpAck, reply.messageType())
+		assert.True(t, reply.yiaddr.Equal(net.IPv4zero))
+		assert.NotContains(t, reply.options, optLeaseTime)
+	})
+
+	t.Run("release", func(t *testing.T) {
+		t.Parallel()
+		_, _, ok := exchange(t, lease, dhcpRequestFrame(7, net.IPv4(10, 244, 1, 5), 0, serverID))
+		assert.False(t, ok)
+	})
+}
+
+func TestParseDHCPFrame(t *testing.T) {
+	t.Run("truncated option", func(t *testing.T) {
+		t.Parallel()
+		frame := dhcpRequestFrame(dhcpDiscover, net.IPv4zero, 0)
+		// Replace the end option with an option that exceeds the packet
+		frame[len(frame)-1] = optHostname
+		binary.BigEndian.PutUint16(frame[ethHeaderLen+ipv4HeaderLen+4:], uint16(len(frame)-ethHeaderLen-ipv4HeaderLen+1))
+		frame = append(frame, 10)
+		_, err := parseDHCPFrame(frame, dhcpServerPort)
+		assert.Error(t, err)
+	})
+
+	t.Run("other port", func(t *testing.T) {
+		t.Parallel()
+		_, err := parseDHCPFrame(dhcpRequestFrame(dhcpDiscover, net.IPv4zero, 0), dhcpClientPort)
+		assert.Error(t, err)
+	})
+}
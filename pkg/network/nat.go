@@ -0,0 +1,413 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/binaryutil"
+	"github.com/google/nftables/expr"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// The nftables table and chains that hold the NAT rules of urunc in
+	// the network namespace
+	natTableName           = "urunc"
+	natChainName           = "postrouting"
+	natPreroutingChainName = "prerouting"
+	natOutputChainName     = "output"
+)
+
+var natTable = &nftables.Table{
+	Name:   natTableName,
+	Family: nftables.TableFamilyIPv4,
+}
+
+var natChain = &nftables.Chain{
+	Name:     natChainName,
+	Table:    natTable,
+	Type:     nftables.ChainTypeNAT,
+	Hooknum:  nftables.ChainHookPostrouting,
+	Priority: nftables.ChainPriorityNATSource,
+}
+
+// The port forwarding rules apply to the traffic that arrives at the
+// namespace and to the traffic of the other containers of the pod.
+var natPreroutingChain = &nftables.Chain{
+	Name:     natPreroutingChainName,
+	Table:    natTable,
+	Type:     nftables.ChainTypeNAT,
+	Hooknum:  nftables.ChainHookPrerouting,
+	Priority: nftables.ChainPriorityNATDest,
+}
+
+var natOutputChain = &nftables.Chain{
+	Name:     natOutputChainName,
+	Table:    natTable,
+	Type:     nftables.ChainTypeNAT,
+	Hooknum:  nftables.ChainHookOutput,
+	Priority: nftables.ChainPriorityNATDest,
+}
+
+// natChains are all the chains of the NAT table
+var natChains = []*nftables.Chain{natChain, natPreroutingChain, natOutputChain}
+
+// PortForward forwards the traffic that targets a port of the pod to a port
+// of the unikernel.
+type PortForward struct {
+	Protocol  string `json:"protocol"`  // tcp or udp
+	Port      uint16 `json:"port"`      // The port of the pod
+	GuestPort uint16 `json:"guestPort"` // The port of the unikernel
+}
+
+// ParsePortForwards parses a comma-separated list of port forwarding rules in
+// the format <port>[:<guest port>][/<protocol>], where the protocol is tcp
+// (the default) or udp, as in the EXPOSE instruction of Dockerfiles.
+func ParsePortForwards(value string) ([]PortForward, error) {
+	var forwards []PortForward
+	for _, rule := range strings.Split(value, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		ports, protocol, found := strings.Cut(rule, "/")
+		if !found {
+			protocol = "tcp"
+		}
+		protocol = strings.ToLower(protocol)
+		if protocol != "tcp" && protocol != "udp" {
+			return nil, fmt.Errorf("invalid protocol in port forwarding rule %q", rule)
+		}
+		port, guestPort, found := strings.Cut(ports, ":")
+		if !found {
+			guestPort = port
+		}
+		podPort, err := strconv.ParseUint(port, 10, 16)
+		if err != nil || podPort == 0 {
+			return nil, fmt.Errorf("invalid port in port forwarding rule %q", rule)
+		}
+		unikernelPort, err := strconv.ParseUint(guestPort, 10, 16)
+		if err != nil || unikernelPort == 0 {
+			return nil, fmt.Errorf("invalid guest port in port forwarding rule %q", rule)
+		}
+		forwards = append(forwards, PortForward{
+			Protocol:  protocol,
+			Port:      uint16(podPort),
+			GuestPort: uint16(unikernelPort),
+		})
+	}
+	return forwards, nil
+}
+
+// natRule describes a masquerade rule for the traffic of an allocation
+type natRule struct {
+	protocol uint8  // The L4 protocol to match, or 0 for any protocol
+	minPort  uint16 // The first source port of the masqueraded connections, if any
+	maxPort  uint16 // The last source port of the masqueraded connections, if any
+}
+
+// enableIPForwarding writes 1 to /proc/sys/net/ipv4/ip_forward to enable IP
+// forwarding in the current network namespace.
+func enableIPForwarding() error {
+	file, err := os.OpenFile("/proc/sys/net/ipv4/ip_forward", os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open /proc/sys/net/ipv4/ip_forward: %w", err)
+	}
+	defer file.Close()
+
+	_, err = file.WriteString("1")
+	if err != nil {
+		return fmt.Errorf("failed to enable IP forwarding: %w", err)
+	}
+	netlog.Debug("Enabled IP forwarding")
+	return nil
+}
+
+// natRules returns the rules which masquerade the traffic of the allocation
+// behind the IP of the redirect interface. If the allocation has a port
+// range, the TCP and UDP connections use only this range.
+func natRules(allocation TapAllocation) ([]natRule, error) {
+	if allocation.NATPorts == "" {
+		return []natRule{{}}, nil
+	}
+	var minPort, maxPort uint16
+	_, err := fmt.Sscanf(allocation.NATPorts, "%d-%d", &minPort, &maxPort)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NAT port range %q: %w", allocation.NATPorts, err)
+	}
+	return []natRule{
+		{protocol: unix.IPPROTO_TCP, minPort: minPort, maxPort: maxPort},
+		{protocol: unix.IPPROTO_UDP, minPort: minPort, maxPort: maxPort},
+		{},
+	}, nil
+}
+
+// natRuleExprs returns the nftables expressions of rule, which masquerade
+// the packets from subnet that leave through iface.
+func natRuleExprs(subnet *net.IPNet, iface string, rule natRule) []expr.Any {
+	exprs := []expr.Any{
+		// ip saddr <subnet>
+		&expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseNetworkHeader,
+			Offset:       12,
+			Len:          4,
+		},
+		&expr.Bitwise{
+			SourceRegister: 1,
+			DestRegister:   1,
+			Len:            4,
+			Mask:           subnet.Mask,
+			Xor:            []byte{0, 0, 0, 0},
+		},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: subnet.IP.To4()},
+		// oifname <iface>
+		&expr.Meta{Key: expr.MetaKeyOIFNAME, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: ifname(iface)},
+	}
+	if rule.protocol != 0 {
+		// meta l4proto <protocol>
+		exprs = append(exprs,
+			&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{rule.protocol}},
+		)
+	}
+	if rule.minPort == 0 {
+		return append(exprs, &expr.Masq{})
+	}
+	// masquerade to :<minPort>-<maxPort>
+	return append(exprs,
+		&expr.Immediate{Register: 1, Data: binaryutil.BigEndian.PutUint16(rule.minPort)},
+		&expr.Immediate{Register: 2, Data: binaryutil.BigEndian.PutUint16(rule.maxPort)},
+		&expr.Masq{ToPorts: true, RegProtoMin: 1, RegProtoMax: 2},
+	)
+}
+
+// portForwardExprs returns the nftables expressions which forward the
+// packets that target the port of podIP to the port of guestIP.
+func portForwardExprs(podIP net.IP, guestIP net.IP, forward PortForward) []expr.Any {
+	protocol := byte(unix.IPPROTO_TCP)
+	if forward.Protocol == "udp" {
+		protocol = unix.IPPROTO_UDP
+	}
+	return []expr.Any{
+		// ip daddr <podIP>
+		&expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseNetworkHeader,
+			Offset:       16,
+			Len:          4,
+		},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: podIP.To4()},
+		// meta l4proto <protocol>
+		&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{protocol}},
+		// th dport <port>
+		&expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseTransportHeader,
+			Offset:       2,
+			Len:          2,
+		},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binaryutil.BigEndian.PutUint16(forward.Port)},
+		// dnat to <guestIP>:<guestPort>
+		&expr.Immediate{Register: 1, Data: guestIP.To4()},
+		&expr.Immediate{Register: 2, Data: binaryutil.BigEndian.PutUint16(forward.GuestPort)},
+		&expr.NAT{
+			Type:        expr.NATTypeDestNAT,
+			Family:      unix.NFPROTO_IPV4,
+			RegAddrMin:  1,
+			RegProtoMin: 2,
+		},
+	}
+}
+
+// ifname returns the name of an interface in the format of the kernel
+func ifname(name string) []byte {
+	b := make([]byte, unix.IFNAMSIZ)
+	copy(b, name)
+	return b
+}
+
+// natRuleTag returns the user data that marks the NAT rules of the allocation,
+// in order to tell them apart from the rules of any other allocation.
+func natRuleTag(allocation TapAllocation) []byte {
+	return []byte(fmt.Sprintf("urunc:%s:%d", allocation.TapDevice, allocation.TapIndex))
+}
+
+// addMasquerade masquerades the traffic of the subnet of the allocation
+// behind the IP of its redirect interface and records the handles of the
+// nftables rules in the allocation.
+func addMasquerade(allocation *TapAllocation) error {
+	err := enableIPForwarding()
+	if err != nil {
+		return err
+	}
+	_, subnet, err := net.ParseCIDR(allocation.NATSubnet)
+	if err != nil {
+		return fmt.Errorf("invalid NAT subnet %q: %w", allocation.NATSubnet, err)
+	}
+	rules, err := natRules(*allocation)
+	if err != nil {
+		return err
+	}
+	conn, err := nftables.New()
+	if err != nil {
+		return fmt.Errorf("failed to connect to nftables: %w", err)
+	}
+	tag := natRuleTag(*allocation)
+	conn.AddTable(natTable)
+	conn.AddChain(natChain)
+	for _, rule := range rules {
+		conn.AddRule(&nftables.Rule{
+			Table:    natTable,
+			Chain:    natChain,
+			Exprs:    natRuleExprs(subnet, allocation.RedirectDevice, rule),
+			UserData: tag,
+		})
+	}
+	err = conn.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to add NAT rules: %w", err)
+	}
+	err = recordNATRules(conn, allocation, natChain)
+	if err != nil {
+		return err
+	}
+	netlog.WithField("subnet", allocation.NATSubnet).Debug("Applied nftables rules for NAT")
+	return nil
+}
+
+// addPortForwards forwards the traffic that targets the ports of podIP to the
+// ports of the unikernel of the allocation and records the handles of the
+// nftables rules in the allocation.
+func addPortForwards(allocation *TapAllocation, podIP string, forwards []PortForward) error {
+	if len(forwards) == 0 {
+		return nil
+	}
+	pod := net.ParseIP(podIP).To4()
+	if pod == nil {
+		return fmt.Errorf("port forwarding requires an IPv4 address on %s", allocation.RedirectDevice)
+	}
+	guest := net.ParseIP(allocation.GuestIP).To4()
+	if guest == nil {
+		return fmt.Errorf("invalid guest IP %q", allocation.GuestIP)
+	}
+	conn, err := nftables.New()
+	if err != nil {
+		return fmt.Errorf("failed to connect to nftables: %w", err)
+	}
+	tag := natRuleTag(*allocation)
+	conn.AddTable(natTable)
+	for _, chain := range []*nftables.Chain{natPreroutingChain, natOutputChain} {
+		conn.AddChain(chain)
+		for _, forward := range forwards {
+			conn.AddRule(&nftables.Rule{
+				Table:    natTable,
+				Chain:    chain,
+				Exprs:    portForwardExprs(pod, guest, forward),
+				UserData: tag,
+			})
+		}
+	}
+	err = conn.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to add port forwarding rules: %w", err)
+	}
+	for _, chain := range []*nftables.Chain{natPreroutingChain, natOutputChain} {
+		err = recordNATRules(conn, allocation, chain)
+		if err != nil {
+			return err
+		}
+	}
+	netlog.WithField("ports", forwards).Debug("Applied nftables rules for port forwarding")
+	return nil
+}
+
+// recordNATRules records the handles of the rules of the allocation in chain,
+// which the kernel assigned, unless they are already recorded.
+func recordNATRules(conn *nftables.Conn, allocation *TapAllocation, chain *nftables.Chain) error {
+	installed, err := conn.GetRules(natTable, chain)
+	if err != nil {
+		return fmt.Errorf("failed to list NAT rules: %w", err)
+	}
+	tag := natRuleTag(*allocation)
+	for _, rule := range installed {
+		if bytes.Equal(rule.UserData, tag) && !slices.Contains(allocation.NATRules, rule.Handle) {
+			allocation.NATRules = append(allocation.NATRules, rule.Handle)
+		}
+	}
+	return nil
+}
+
+// deleteMasquerade deletes the NAT rules that were recorded in the allocation,
+// including the port forwarding rules. The table of urunc gets deleted too,
+// if there are no rules left in it.
+func deleteMasquerade(allocation TapAllocation) error {
+	if len(allocation.NATRules) == 0 {
+		return nil
+	}
+	conn, err := nftables.New()
+	if err != nil {
+		return fmt.Errorf("failed to connect to nftables: %w", err)
+	}
+	recorded := make(map[uint64]bool, len(allocation.NATRules))
+	for _, handle := range allocation.NATRules {
+		recorded[handle] = true
+	}
+	// The handles might have been reused, if the table was recreated
+	tag := natRuleTag(allocation)
+	remaining := 0
+	exists := false
+	for _, chain := range natChains {
+		installed, err := conn.GetRules(natTable, chain)
+		if errors.Is(err, unix.ENOENT) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to list NAT rules: %w", err)
+		}
+		exists = true
+		for _, rule := range installed {
+			if !recorded[rule.Handle] || !bytes.Equal(rule.UserData, tag) {
+				remaining++
+				continue
+			}
+			err = conn.DelRule(rule)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if !exists {
+		return nil
+	}
+	if remaining == 0 {
+		conn.DelTable(natTable)
+	}
+	err = conn.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to delete NAT rules: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/nftables/expr"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestNATRules(t *testing.T) {
+	t.Run("port range", func(t *testing.T) {
+		t.Parallel()
+		allocation := TapAllocation{Index: 1, RedirectDevice: "eth1", NATSubnet: "172.16.2.0/24", NATPorts: natPortRange(1)}
+		rules, err := natRules(allocation)
+		assert.NoError(t, err)
+		assert.Equal(t, []natRule{
+			{protocol: unix.IPPROTO_TCP, minPort: 16640, maxPort: 16895},
+			{protocol: unix.IPPROTO_UDP, minPort: 16640, maxPort: 16895},
+			{},
+		}, rules)
+	})
+	t.Run("no port range", func(t *testing.T) {
+		t.Parallel()
+		rules, err := natRules(TapAllocation{NATSubnet: "172.16.1.0/24"})
+		assert.NoError(t, err)
+		assert.Equal(t, []natRule{{}}, rules)
+	})
+	t.Run("invalid port range", func(t *testing.T) {
+		t.Parallel()
+		_, err := natRules(TapAllocation{NATPorts: "16640"})
+		assert.Error(t, err)
+	})
+}
+
+func TestNATRuleExprs(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("172.16.2.0/24")
+	t.Run("masquerade to port range", func(t *testing.T) {
+		t.Parallel()
+		exprs := natRuleExprs(subnet, "eth1", natRule{protocol: unix.IPPROTO_TCP, minPort: 16640, maxPort: 16895})
+		assert.Contains(t, exprs, &expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{172, 16, 2, 0}})
+		assert.Contains(t, exprs, &expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: ifname("eth1")})
+		assert.Contains(t, exprs, &expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{unix.IPPROTO_TCP}})
+		assert.Equal(t, &expr.Masq{ToPorts: true, RegProtoMin: 1, RegProtoMax: 2}, exprs[len(exprs)-1])
+	})
+	t.Run("masquerade any protocol", func(t *testing.T) {
+		t.Parallel()
+		exprs := natRuleExprs(subnet, "eth1", natRule{})
+		assert.Len(t, exprs, 6)
+		assert.Equal(t, &expr.Masq{}, exprs[len(exprs)-1])
+	})
+}
+
+func TestNATRuleTag(t *testing.T) {
+	t.Parallel()
+	tag := natRuleTag(TapAllocation{TapDevice: "tap1_urunc", TapIndex: 7})
+	assert.Equal(t, "urunc:tap1_urunc:7", string(tag))
+	assert.NotEqual(t, tag, natRuleTag(TapAllocation{TapDevice: "tap1_urunc", TapIndex: 8}))
+}
+
+func TestParsePortForwards(t *testing.T) {
+	t.Run("port forwarding rules", func(t *testing.T) {
+		t.Parallel()
+		forwards, err := ParsePortForwards("8080, 80:8000/tcp,53/UDP,")
+		assert.NoError(t, err)
+		assert.Equal(t, []PortForward{
+			{Protocol: "tcp", Port: 8080, GuestPort: 8080},
+			{Protocol: "tcp", Port: 80, GuestPort: 8000},
+			{Protocol: "udp", Port: 53, GuestPort: 53},
+		}, forwards)
+	})
+	t.Run("no rules", func(t *testing.T) {
+		t.Parallel()
+		forwards, err := ParsePortForwards("")
+		assert.NoError(t, err)
+		assert.Empty(t, forwards)
+	})
+	t.Run("invalid rules", func(t *testing.T) {
+		t.Parallel()
+		for _, value := range []string{"http", "80/sctp", "0", "70000", "80:", "80:x/tcp"} {
+			_, err := ParsePortForwards(value)
+			assert.Error(t, err, value)
+		}
+	})
+}
+
+func TestPortForwardExprs(t *testing.T) {
+	t.Parallel()
+	exprs := portForwardExprs(net.IP{10, 0, 0, 5}, net.IP{172, 16, 1, 2}, PortForward{Protocol: "udp", Port: 5353, GuestPort: 53})
+	assert.Contains(t, exprs, &expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{10, 0, 0, 5}})
+	assert.Contains(t, exprs, &expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{unix.IPPROTO_UDP}})
+	assert.Contains(t, exprs, &expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{0x14, 0xe9}})
+	assert.Contains(t, exprs, &expr.Immediate{Register: 1, Data: []byte{172, 16, 1, 2}})
+	assert.Contains(t, exprs, &expr.Immediate{Register: 2, Data: []byte{0, 53}})
+	assert.IsType(t, &expr.NAT{}, exprs[len(exprs)-1])
+}
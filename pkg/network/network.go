@@ -18,64 +18,121 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
 
-	"github.com/jackpal/gateway"
 	"github.com/sirupsen/logrus"
 	"github.com/vishvananda/netlink"
 	"golang.org/x/sys/unix"
 )
 
 const (
-	DefaultInterface = "eth0" // FIXME: Discover the veth endpoint name instead of using default "eth0". See: https://github.com/nubificus/urunc/issues/14
-	DefaultTap       = "tapX_urunc"
+	DefaultTap     = "tapX_urunc"
+	DefaultMacvtap = "macvtapX_urunc"
 )
 
 var netlog = logrus.WithField("subsystem", "network")
 
+// UnikernelNetworkInfo describes the network of a unikernel. It is recorded in
+// the state of the container, in order to tear down the network later.
 type UnikernelNetworkInfo struct {
-	TapDevice string
-	EthDevice Interface
+	TapDevice     string        `json:"tapDevice"`
+	TapCharDevice *CharDevice   `json:"tapCharDevice,omitempty"` // The char device of a macvtap, which the monitor opens instead of TapDevice
+	EthDevice     Interface     `json:"ethDevice"`
+	Allocation    TapAllocation `json:"allocation"`
 }
+
+// CharDevice describes a char device node
+type CharDevice struct {
+	Path  string `json:"path"`
+	Major uint32 `json:"major"`
+	Minor uint32 `json:"minor"`
+}
+
+// TapAllocation records the network resources that were allocated for a
+// unikernel inside the network namespace, in order to release exactly these
+// resources and nothing more, when the unikernel gets deleted.
+type TapAllocation struct {
+	Index          int      `json:"index"`                    // The index of the tap device in the namespace
+	TapDevice      string   `json:"tapDevice"`                // The name of the tap device
+	TapIndex       int      `json:"tapIfIndex"`               // The interface index of the tap device
+	TapIP          string   `json:"tapIP"`                    // The IP of the tap device
+	GuestIP        string   `json:"guestIP"`                  // The IP of the unikernel
+	GuestMAC       string   `json:"guestMAC"`                 // The MAC of the unikernel
+	RedirectDevice string   `json:"redirectDevice,omitempty"` // The interface that connects the namespace with the outside world
+	RedirectQdisc  bool     `json:"redirectQdisc,omitempty"`  // The ingress qdisc of the redirect interface was added by urunc
+	Redirect       bool     `json:"redirect,omitempty"`       // Traffic of the redirect interface is redirected to the tap
+	NATSubnet      string   `json:"natSubnet,omitempty"`      // The subnet of the tap that gets masqueraded
+	NATPorts       string   `json:"natPorts,omitempty"`       // The port range used for the masquerade
+	NATRules       []uint64 `json:"natRules,omitempty"`       // The handles of the nftables rules of the masquerade
+	Police         bool     `json:"police,omitempty"`         // A police filter on the redirect interface limits the traffic of the unikernel
+}
+
 type Manager interface {
-	NetworkSetup(uid uint32, gid uint32) (*UnikernelNetworkInfo, error)
+	// NetworkSetup creates a tap device for the unikernel and connects it
+	// with the interface iface of the network namespace.
+	NetworkSetup(uid uint32, gid uint32, iface string) (*UnikernelNetworkInfo, error)
 }
 
 type Interface struct {
-	IP             string
-	DefaultGateway string
-	Mask           string
-	Interface      string
-	MAC            string
+	IP             string `json:"ip"`
+	DefaultGateway string `json:"defaultGateway"`
+	Mask           string `json:"mask"`
+	IPv6           string `json:"ipv6,omitempty"`
+	IPv6PrefixLen  int    `json:"ipv6PrefixLength,omitempty"`
+	IPv6Gateway    string `json:"ipv6Gateway,omitempty"`
+	Interface      string `json:"interface"`
+	MAC            string `json:"mac"`
 }
 
 func NewNetworkManager(networkType string) (Manager, error) {
 	switch networkType {
 	case "static":
-		return &StaticNetwork{}, nil
+		return NewStaticNetwork(DefaultStaticConfig()), nil
 	case "dynamic":
 		return &DynamicNetwork{}, nil
+	case "macvtap":
+		return &MacvtapNetwork{}, nil
 	default:
 		return nil, fmt.Errorf("network manager %s not supported", networkType)
 
 	}
 }
 
-func getTapIndex() (int, error) {
+// tapName returns the name of the tap device with the given index
+func tapName(index int) string {
+	return linkName(DefaultTap, index)
+}
+
+// linkName returns the name of the link with the given index, replacing the
+// X of the template with the index.
+func linkName(template string, index int) string {
+	return strings.ReplaceAll(template, "X", strconv.Itoa(index))
+}
+
+// freeTapIndex returns the lowest index that is not used by any urunc tap
+// device in the current network namespace.
+func freeTapIndex(maxIndex int) (int, error) {
+	return freeLinkIndex(DefaultTap, maxIndex)
+}
+
+// freeLinkIndex returns the lowest index that is not used by any link named
+// after template in the current network namespace.
+func freeLinkIndex(template string, maxIndex int) (int, error) {
 	ifaces, err := net.Interfaces()
 	if err != nil {
 		return 0, err
 	}
-	tapCount := 0
+	used := make(map[string]bool, len(ifaces))
 	for _, iface := range ifaces {
-		if strings.Contains(iface.Name, "tap") {
-			tapCount++
-		}
+		used[iface.Name] = true
 	}
-	if tapCount > 255 {
-		return tapCount, fmt.Errorf("TAP interfaces count higher than 255")
+	for index := 0; index <= maxIndex; index++ {
+		if !used[linkName(template, index)] {
+			return index, nil
+		}
 	}
-	return tapCount, nil
+	return 0, fmt.Errorf("no free tap device: up to %d unikernels can share a network namespace", maxIndex+1)
 }
 
 func createTapDevice(name string, mtu int, ownerUID, ownerGID uint32) (netlink.Link, error) {
@@ -120,19 +177,75 @@ func createTapDevice(name string, mtu int, ownerUID, ownerGID uint32) (netlink.L
 	return tapLink, nil
 }
 
-// ensureEth0Exists checks all network interfaces in current netns and returns
-// nil if eth0 is present or ErrEth0NotFound if not
-func ensureEth0Exists() error {
-	ifaces, err := net.Interfaces()
+// DiscoverInterfaces returns the interfaces of the current network namespace
+// that the unikernel gets a network device for, in the order of the devices
+// of the guest. If names is not empty, it returns these interfaces, as long
+// as all of them exist. Otherwise, it returns the interface of the default
+// route. If there is no default route (e.g. the unikernel was spawned using
+// ctr), it returns no interfaces.
+func DiscoverInterfaces(names []string) ([]string, error) {
+	if len(names) > 0 {
+		seen := make(map[string]bool, len(names))
+		for _, name := range names {
+			if seen[name] {
+				return nil, fmt.Errorf("interface %s was requested more than once", name)
+			}
+			seen[name] = true
+			_, err := netlink.LinkByName(name)
+			if err != nil {
+				return nil, fmt.Errorf("failed to find interface %s: %w", name, err)
+			}
+		}
+		return names, nil
+	}
+	route, err := defaultRoute(nil, netlink.FAMILY_V4)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	for _, iface := range ifaces {
-		if iface.Name == DefaultInterface {
-			return nil
+	if route == nil {
+		// IPv6 only namespace
+		route, err = defaultRoute(nil, netlink.FAMILY_V6)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if route == nil {
+		return nil, nil
+	}
+	link, err := netlink.LinkByIndex(route.LinkIndex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the interface of the default route: %w", err)
+	}
+	return []string{link.Attrs().Name}, nil
+}
+
+// defaultRoute returns the default route of the given family with the lowest
+// metric through link, or through any interface if link is nil. It returns
+// nil, if there is no such route.
+func defaultRoute(link netlink.Link, family int) (*netlink.Route, error) {
+	routes, err := netlink.RouteList(link, family)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routes: %w", err)
+	}
+	var defRoute *netlink.Route
+	for i, route := range routes {
+		if !isDefaultRoute(route) || route.LinkIndex == 0 {
+			continue
+		}
+		if defRoute == nil || route.Priority < defRoute.Priority {
+			defRoute = &routes[i]
 		}
 	}
-	return errors.New("eth0 device not found")
+	return defRoute, nil
+}
+
+// isDefaultRoute returns true, if route matches every destination
+func isDefaultRoute(route netlink.Route) bool {
+	if route.Dst == nil {
+		return true
+	}
+	ones, _ := route.Dst.Mask.Size()
+	return ones == 0
 }
 
 func getInterfaceInfo(iface string) (Interface, error) {
@@ -151,42 +264,83 @@ func getInterfaceInfo(iface string) (Interface, error) {
 	}
 	ipAddress := ""
 	mask := ""
-	netMask := net.IPMask{}
+	ipv6Address := ""
+	ipv6PrefixLen := 0
 	for _, addr := range addrs {
 		ipNet, ok := addr.(*net.IPNet)
-		if ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
-			ipAddress = ipNet.IP.String()
-			// hexadecimal notation
-			mask = ipNet.Mask.String()
-			netMask = ipNet.Mask
-			break
+		if !ok || !ipNet.IP.IsGlobalUnicast() {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			if ipAddress == "" {
+				ipAddress = ipNet.IP.String()
+				mask = decimalMask(ipNet.Mask)
+			}
+		} else if ipv6Address == "" {
+			ipv6Address = ipNet.IP.String()
+			ipv6PrefixLen, _ = ipNet.Mask.Size()
 		}
 	}
-	if mask == "" {
-		return Interface{}, fmt.Errorf("failed to find mask for %q", DefaultInterface)
-	}
-	// convert to decimal notation
-	decimalParts := make([]string, len(netMask))
-	for i, part := range netMask {
-		decimalParts[i] = fmt.Sprintf("%d", part)
-	}
-	mask = strings.Join(decimalParts, ".")
-	if ipAddress == "" {
-		return Interface{}, fmt.Errorf("failed to find IPv4 address for %q", DefaultInterface)
+	if ipAddress == "" && ipv6Address == "" {
+		return Interface{}, fmt.Errorf("failed to find IPv4 or IPv6 address for %q", iface)
 	}
-	gateway, err := gateway.DiscoverGateway()
+	// Only the interface of the default route has a gateway. The guest
+	// reaches the subnets of the rest of the interfaces directly.
+	link, err := netlink.LinkByName(iface)
 	if err != nil {
 		return Interface{}, err
 	}
+	gateway := ""
+	if ipAddress != "" {
+		gateway, err = defaultGateway(link, netlink.FAMILY_V4)
+		if err != nil {
+			return Interface{}, err
+		}
+	}
+	ipv6Gateway := ""
+	if ipv6Address != "" {
+		ipv6Gateway, err = defaultGateway(link, netlink.FAMILY_V6)
+		if err != nil {
+			return Interface{}, err
+		}
+	}
 	return Interface{
 		IP:             ipAddress,
-		DefaultGateway: gateway.String(),
+		DefaultGateway: gateway,
 		Mask:           mask,
-		Interface:      DefaultInterface,
+		IPv6:           ipv6Address,
+		IPv6PrefixLen:  ipv6PrefixLen,
+		IPv6Gateway:    ipv6Gateway,
+		Interface:      iface,
 		MAC:            IfMAC,
 	}, nil
 }
 
+// decimalMask converts an IPv4 mask to the dotted decimal notation
+func decimalMask(mask net.IPMask) string {
+	if len(mask) == net.IPv6len {
+		mask = mask[12:]
+	}
+	decimalParts := make([]string, len(mask))
+	for i, part := range mask {
+		decimalParts[i] = strconv.Itoa(int(part))
+	}
+	return strings.Join(decimalParts, ".")
+}
+
+// defaultGateway returns the gateway of the default route of the given
+// family through link, or an empty string if there is no such route.
+func defaultGateway(link netlink.Link, family int) (string, error) {
+	route, err := defaultRoute(link, family)
+	if err != nil {
+		return "", err
+	}
+	if route == nil || route.Gw == nil {
+		return "", nil
+	}
+	return route.Gw.String(), nil
+}
+
 func addIngressQdisc(link netlink.Link) error {
 	ingress := &netlink.Ingress{
 		QdiscAttrs: netlink.QdiscAttrs{
@@ -197,11 +351,45 @@ func addIngressQdisc(link netlink.Link) error {
 	return netlink.QdiscAdd((ingress))
 }
 
+// ensureIngressQdisc adds an ingress qdisc to link, unless it already has
+// one, since multiple unikernels can install filters on the same link. It
+// returns true, if the qdisc belongs to urunc, meaning that urunc added it
+// or that it holds only filters of urunc.
+func ensureIngressQdisc(link netlink.Link) (bool, error) {
+	err := addIngressQdisc(link)
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, unix.EEXIST) {
+		return false, err
+	}
+	filters, err := netlink.FilterList(link, netlink.MakeHandle(0xffff, 0))
+	if err != nil {
+		return false, err
+	}
+	if len(filters) == 0 {
+		return false, nil
+	}
+	for _, filter := range filters {
+		if !isUruncPriority(filter.Attrs().Priority) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
 func addRedirectFilter(source netlink.Link, target netlink.Link) error {
+	return addRedirectFilterWithPriority(source, target, 0)
+}
+
+// addRedirectFilterWithPriority redirects all the ingress traffic of source to
+// target. A priority of 0 lets the kernel choose one.
+func addRedirectFilterWithPriority(source netlink.Link, target netlink.Link, priority uint16) error {
 	return netlink.FilterAdd(&netlink.U32{
 		FilterAttrs: netlink.FilterAttrs{
 			LinkIndex: source.Attrs().Index,
 			Parent:    netlink.MakeHandle(0xffff, 0),
+			Priority:  priority,
 			Protocol:  unix.ETH_P_ALL,
 		},
 		Actions: []netlink.Action{
@@ -216,35 +404,11 @@ func addRedirectFilter(source netlink.Link, target netlink.Link) error {
 	})
 }
 
-func networkSetup(tapName string, ipAddress string, redirectLink netlink.Link, addTCRules bool, uid uint32, gid uint32) (netlink.Link, error) {
-	err := ensureEth0Exists()
-	// if eth0 does not exist in the namespace, the unikernel was spawned using ctr, so we skip the network setup
-	if err != nil {
-		netlog.Warn("eth0 interface not found, assuming unikernel was spawned using ctr")
-		return nil, nil
-	}
+func networkSetup(tapName string, ipAddress string, redirectLink netlink.Link, uid uint32, gid uint32) (netlink.Link, error) {
 	newTapDevice, err := createTapDevice(tapName, redirectLink.Attrs().MTU, uid, gid)
 	if err != nil {
 		return nil, err
 	}
-	if addTCRules {
-		err = addIngressQdisc(newTapDevice)
-		if err != nil {
-			return nil, err
-		}
-		err = addIngressQdisc(redirectLink)
-		if err != nil {
-			return nil, err
-		}
-		err = addRedirectFilter(newTapDevice, redirectLink)
-		if err != nil {
-			return nil, err
-		}
-		err = addRedirectFilter(redirectLink, newTapDevice)
-		if err != nil {
-			return nil, err
-		}
-	}
 	ipn, err := netlink.ParseAddr(ipAddress)
 	if err != nil {
 		return nil, err
@@ -261,91 +425,119 @@ func networkSetup(tapName string, ipAddress string, redirectLink netlink.Link, a
 	return newTapDevice, nil
 }
 
-func Cleanup(tapDevice string) error {
-	netlog.Debug("net cleanup called")
-	ifaces, err := net.Interfaces()
+// Cleanup releases the network resources of a unikernel, as recorded in its
+// allocation. It deletes the tap device of the unikernel, the TC filters it
+// installed on the redirect interface and its NAT rules. The resources of any
+// other unikernel in the same network namespace remain intact.
+func Cleanup(allocation TapAllocation) error {
+	netlog.WithField("tap", allocation.TapDevice).Debug("net cleanup called")
+	redirectDevice := allocation.RedirectDevice
+	priorities := allocationPriorities(allocation)
+	redirectLink, err := netlink.LinkByName(redirectDevice)
 	if err != nil {
-		return err
-	}
-	for _, iface := range ifaces {
-		netlog.Debugf("Discovered device %s", iface.Name)
+		if len(priorities) > 0 {
+			netlog.Errorf("Failed to get link %s by name: %v", redirectDevice, err)
+		}
+	} else {
+		err = deleteFilters(redirectLink, priorities)
+		if err != nil {
+			netlog.Errorf("Failed to delete TC filters: %v", err)
+			return err
+		}
+		// The qdisc might hold filters of other unikernels, or it
+		// might not belong to urunc at all.
+		if allocation.RedirectQdisc {
+			err = deleteUnusedIngressQdisc(redirectLink)
+			if err != nil {
+				netlog.Errorf("Failed to delete ingress qdisc: %v", err)
+				return err
+			}
+		}
 	}
-	tapLink, err := netlink.LinkByName(tapDevice)
-	if err != nil {
-		netlog.Errorf("Failed to get link %s by name: %v", tapDevice, err)
-		return nil
+	// A failure to delete the NAT rules does not affect the rest of the
+	// unikernels, hence the tap device still gets deleted.
+	var natErr error
+	if allocation.NATSubnet != "" {
+		natErr = deleteMasquerade(allocation)
+		if natErr != nil {
+			netlog.Errorf("Failed to delete NAT rules: %v", natErr)
+		}
 	}
-	err = deleteAllTCFilters(tapLink)
+	tapLink, err := netlink.LinkByName(allocation.TapDevice)
 	if err != nil {
-		netlog.Errorf("Failed to delete all TC filters: %v", err)
-		return err
+		netlog.Errorf("Failed to get link %s by name: %v", allocation.TapDevice, err)
+		return natErr
 	}
-	err = deleteAllQDiscs(tapLink)
-	if err != nil {
-		netlog.Errorf("Failed to delete all qdiscs: %v", err)
-		return err
+	// The tap device might have been deleted and its name reused by the
+	// tap device of another unikernel.
+	if allocation.TapIndex != 0 && tapLink.Attrs().Index != allocation.TapIndex {
+		netlog.Warnf("Link %s does not belong to this unikernel", allocation.TapDevice)
+		return natErr
 	}
+	// The qdiscs and filters of the tap device get deleted along with it
 	err = deleteTapDevice(tapLink)
 	if err != nil {
-		netlog.Errorf("Failed to delete link %s: %v", tapDevice, err)
+		netlog.Errorf("Failed to delete link %s: %v", allocation.TapDevice, err)
 	}
-	return nil
+	return natErr
 }
 
-func deleteIngressQdisc(link netlink.Link) error {
-	qdiscs, err := netlink.QdiscList(link)
+// deleteFilters deletes the ingress filters of link with the given
+// priorities. Deleting a priority removes all the filters in it.
+func deleteFilters(link netlink.Link, priorities []uint16) error {
+	if len(priorities) == 0 {
+		return nil
+	}
+	filters, err := netlink.FilterList(link, netlink.MakeHandle(0xffff, 0))
 	if err != nil {
 		return err
 	}
-	for _, qdisc := range qdiscs {
-		if qdisc.Attrs().Parent == netlink.HANDLE_INGRESS && qdisc.Attrs().LinkIndex == link.Attrs().Index {
-			err = netlink.QdiscDel(qdisc)
-			if err != nil {
-				return err
-			}
+	existing := make(map[uint16]bool, len(filters))
+	for _, filter := range filters {
+		existing[filter.Attrs().Priority] = true
+	}
+	for _, priority := range priorities {
+		if !existing[priority] {
+			continue
+		}
+		err = netlink.FilterDel(&netlink.U32{
+			FilterAttrs: netlink.FilterAttrs{
+				LinkIndex: link.Attrs().Index,
+				Parent:    netlink.MakeHandle(0xffff, 0),
+				Priority:  priority,
+			},
+		})
+		if err != nil && !errors.Is(err, unix.ENOENT) {
+			return err
 		}
 	}
 	return nil
 }
 
-func deleteAllQDiscs(device netlink.Link) error {
-	err := deleteIngressQdisc(device)
-	if err != nil {
-		return err
-	}
-	device, err = netlink.LinkByName(DefaultInterface)
+// deleteUnusedIngressQdisc deletes the ingress qdisc of link, if there are
+// no filters attached to it anymore.
+func deleteUnusedIngressQdisc(link netlink.Link) error {
+	filters, err := netlink.FilterList(link, netlink.MakeHandle(0xffff, 0))
 	if err != nil {
 		return err
 	}
-	err = deleteIngressQdisc(device)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func deleteAllTCFilters(device netlink.Link) error {
-	var allFilters []netlink.Filter
-	parent := uint32(netlink.HANDLE_ROOT)
-	tapFilters, err := netlink.FilterList(device, parent)
-	if err != nil {
+	if len(filters) > 0 {
 		return nil
 	}
-	allFilters = append(allFilters, tapFilters...)
+	return deleteIngressQdisc(link)
+}
 
-	device, err = netlink.LinkByName(DefaultInterface)
-	if err != nil {
-		return err
-	}
-	ethFilters, err := netlink.FilterList(device, parent)
+func deleteIngressQdisc(link netlink.Link) error {
+	qdiscs, err := netlink.QdiscList(link)
 	if err != nil {
 		return err
 	}
-	allFilters = append(allFilters, ethFilters...)
-	for _, filter := range allFilters {
-		err = netlink.FilterDel(filter)
-		if err != nil {
-			return err
+	for _, qdisc := range qdiscs {
+		if qdisc.Attrs().Parent == netlink.HANDLE_INGRESS && qdisc.Attrs().LinkIndex == link.Attrs().Index {
+			err = netlink.QdiscDel(qdisc)
+			if err != nil {
+				return err
+			}
 		}
 	}
 	return nil
@@ -21,46 +21,302 @@ import (
 
 	"github.com/nubificus/urunc/internal/constants"
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Priorities of the ingress filters on the redirect interface. Lower
+	// values get evaluated first.
+	policePriority      uint16 = 5    // Limits the traffic to the macvtap of a unikernel
+	arpMirrorPriority   uint16 = 10   // Copies ARP to the host, along with the tap
+	natPassBasePriority uint16 = 100  // Passes the NAT traffic of a tap to the host
+	redirectPriority    uint16 = 1000 // Redirects everything else to the tap
+
+	// Every unikernel, other than the one using the IP of the pod, gets a
+	// block of source ports for its masqueraded connections. The blocks are
+	// aligned, in order to match them with a single u32 key.
+	natPortBase      = 0x4000
+	natPortBlockSize = 0x100
+	maxDynamicIndex  = (0x8000-natPortBase)/natPortBlockSize - 1
 )
 
 type DynamicNetwork struct {
 }
 
-// NetworkSetup checks if any tap device is available in the current netns. If it is, it assumes a running unikernel
-// is present in the current netns and returns an error, because network functionality for more than one unikernels
-// is not yet implemented.
-// If no TAP devices are available in the current netns, it creates a new tap device and
-// sets TC rules between the veth interface and the tap device inside the namespace.
+// NetworkSetup creates a new tap device for the unikernel, using the lowest
+// free index in the current netns, and connects it with the interface iface.
 //
-// FIXME: CUrrently only one tap device per netns can provide functional networking. We need to find a proper way to handle networking
-// for multiple unikernels in the same pod/network namespace.
-// See: https://github.com/nubificus/urunc/issues/13
-func (n DynamicNetwork) NetworkSetup(uid uint32, gid uint32) (*UnikernelNetworkInfo, error) {
-	tapIndex, err := getTapIndex()
+// The first unikernel on an interface takes over the IP and MAC of this
+// interface. TC rules redirect all the traffic between the interface and the
+// tap device, with the exception of ARP which is copied to the host too.
+//
+// Any other unikernel that uses the same interface (e.g. multiple unikernel
+// containers in the same pod) gets its own subnet, IP and MAC. Its traffic
+// gets routed by the host and masqueraded behind the IP of the interface,
+// using a dedicated block of source ports. A TC filter passes the replies that
+// target this block to the host, instead of redirecting them to the first
+// unikernel. These unikernels are reachable from the other containers of the
+// pod through their own IP.
+func (n DynamicNetwork) NetworkSetup(uid uint32, gid uint32, iface string) (*UnikernelNetworkInfo, error) {
+	tapIndex, err := freeTapIndex(maxDynamicIndex)
 	if err != nil {
 		return nil, err
 	}
-	if tapIndex > 0 {
-		return nil, fmt.Errorf("unsupported operation: can't spawn multiple unikernels in the same network namespace")
+	redirectLink, err := netlink.LinkByName(iface)
+	if err != nil {
+		netlog.Errorf("failed to find %s interface", iface)
+		return nil, err
 	}
-	redirectLink, err := netlink.LinkByName(DefaultInterface)
+	redirected, err := isRedirected(redirectLink)
 	if err != nil {
-		netlog.Errorf("failed to find %s interface", DefaultInterface)
 		return nil, err
 	}
-	newTapName := strings.ReplaceAll(DefaultTap, "X", strconv.Itoa(tapIndex))
+	newTapName := tapName(tapIndex)
 	ipTemplate := fmt.Sprintf("%s/24", constants.DynamicNetworkTapIP)
 	newIPAddr := strings.ReplaceAll(ipTemplate, "X", strconv.Itoa(tapIndex+1))
-	newTapDevice, err := networkSetup(newTapName, newIPAddr, redirectLink, true, uid, gid)
+	if redirected {
+		return sharedNetworkSetup(tapIndex, newTapName, newIPAddr, redirectLink, uid, gid)
+	}
+	newTapDevice, err := networkSetup(newTapName, newIPAddr, redirectLink, uid, gid)
 	if err != nil {
 		return nil, err
 	}
-	ifInfo, err := getInterfaceInfo(DefaultInterface)
+	allocation := TapAllocation{
+		Index:          tapIndex,
+		TapDevice:      newTapDevice.Attrs().Name,
+		TapIndex:       newTapDevice.Attrs().Index,
+		TapIP:          strings.TrimSuffix(newIPAddr, "/24"),
+		RedirectDevice: redirectLink.Attrs().Name,
+		Redirect:       true,
+	}
+	allocation.RedirectQdisc, err = addPrimaryTCRules(newTapDevice, redirectLink)
 	if err != nil {
+		_ = Cleanup(allocation)
+		return nil, err
+	}
+	ifInfo, err := getInterfaceInfo(iface)
+	if err != nil {
+		_ = Cleanup(allocation)
+		return nil, err
+	}
+	allocation.GuestIP = ifInfo.IP
+	allocation.GuestMAC = ifInfo.MAC
+	return &UnikernelNetworkInfo{
+		TapDevice:  newTapDevice.Attrs().Name,
+		EthDevice:  ifInfo,
+		Allocation: allocation,
+	}, nil
+}
+
+// isRedirected returns true, if the traffic of link is already redirected to
+// the tap device of another unikernel.
+func isRedirected(link netlink.Link) (bool, error) {
+	qdiscs, err := netlink.QdiscList(link)
+	if err != nil {
+		return false, err
+	}
+	hasIngress := false
+	for _, qdisc := range qdiscs {
+		if qdisc.Attrs().Parent == netlink.HANDLE_INGRESS {
+			hasIngress = true
+			break
+		}
+	}
+	if !hasIngress {
+		return false, nil
+	}
+	filters, err := netlink.FilterList(link, netlink.MakeHandle(0xffff, 0))
+	if err != nil {
+		return false, err
+	}
+	for _, filter := range filters {
+		if filter.Attrs().Priority == redirectPriority {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// sharedNetworkSetup sets up the network of a unikernel that shares the
+// redirect interface with the unikernel that uses the IP of this interface.
+func sharedNetworkSetup(tapIndex int, newTapName string, newIPAddr string, redirectLink netlink.Link, uid uint32, gid uint32) (*UnikernelNetworkInfo, error) {
+	newTapDevice, err := networkSetup(newTapName, newIPAddr, redirectLink, uid, gid)
+	if err != nil {
+		return nil, err
+	}
+	subnet := strconv.Itoa(tapIndex + 1)
+	tapIP := strings.ReplaceAll(constants.DynamicNetworkTapIP, "X", subnet)
+	guestIP := strings.ReplaceAll(constants.DynamicNetworkGuestIP, "X", subnet)
+	allocation := TapAllocation{
+		Index:          tapIndex,
+		TapDevice:      newTapDevice.Attrs().Name,
+		TapIndex:       newTapDevice.Attrs().Index,
+		TapIP:          tapIP,
+		GuestIP:        guestIP,
+		GuestMAC:       guestMAC(tapIndex),
+		RedirectDevice: redirectLink.Attrs().Name,
+		NATSubnet:      strings.ReplaceAll("172.16.X.0/24", "X", subnet),
+		NATPorts:       natPortRange(tapIndex),
+	}
+	allocation.RedirectQdisc, err = addNATPassFilters(redirectLink, tapIndex)
+	if err != nil {
+		_ = Cleanup(allocation)
+		return nil, err
+	}
+	err = addMasquerade(&allocation)
+	if err != nil {
+		_ = Cleanup(allocation)
 		return nil, err
 	}
 	return &UnikernelNetworkInfo{
 		TapDevice: newTapDevice.Attrs().Name,
-		EthDevice: ifInfo,
+		EthDevice: Interface{
+			IP:             guestIP,
+			DefaultGateway: tapIP,
+			Mask:           "255.255.255.0",
+			Interface:      redirectLink.Attrs().Name,
+			MAC:            allocation.GuestMAC,
+		},
+		Allocation: allocation,
 	}, nil
 }
+
+// guestMAC returns a locally administered MAC address for the unikernel that
+// uses the tap device with the given index.
+func guestMAC(tapIndex int) string {
+	return fmt.Sprintf("02:75:72:6e:63:%02x", tapIndex)
+}
+
+// natPortBlock returns the first source port that the unikernel with the
+// given tap index uses for masquerading.
+func natPortBlock(tapIndex int) uint32 {
+	return uint32(natPortBase + tapIndex*natPortBlockSize) // nolint:gosec
+}
+
+// natPortRange returns the source port range of the unikernel with the given
+// tap index in the format <first>-<last>.
+func natPortRange(tapIndex int) string {
+	first := natPortBlock(tapIndex)
+	return fmt.Sprintf("%d-%d", first, first+natPortBlockSize-1)
+}
+
+// allocationPriorities returns the priorities of the filters that were
+// installed on the redirect interface for the allocation.
+func allocationPriorities(allocation TapAllocation) []uint16 {
+	var priorities []uint16
+	if allocation.Redirect {
+		priorities = append(priorities, arpMirrorPriority, redirectPriority)
+	}
+	if allocation.NATPorts != "" {
+		tcp, udp := natPassPriorities(allocation.Index)
+		priorities = append(priorities, tcp, udp)
+	}
+	if allocation.Police {
+		priorities = append(priorities, policePriority)
+	}
+	return priorities
+}
+
+// isUruncPriority returns true, if urunc installs filters with the given
+// priority on the redirect interface.
+func isUruncPriority(priority uint16) bool {
+	lastNATPriority, _ := natPassPriorities(maxDynamicIndex)
+	return priority == policePriority || priority == arpMirrorPriority || priority == redirectPriority ||
+		(priority >= natPassBasePriority && priority <= lastNATPriority+1)
+}
+
+// natPassPriorities returns the priorities of the TCP and UDP filters which
+// pass the NAT traffic of the unikernel with the given tap index to the host.
+func natPassPriorities(tapIndex int) (uint16, uint16) {
+	base := natPassBasePriority + uint16(2*tapIndex) // nolint:gosec
+	return base, base + 1
+}
+
+// addPrimaryTCRules redirects the traffic between the tap device and the
+// redirect interface. ARP packets that arrive at the redirect interface are
+// also passed to the host, since the host needs to resolve the gateway for
+// the traffic of the unikernels that share the namespace. It returns true, if
+// the ingress qdisc of the redirect interface belongs to urunc.
+func addPrimaryTCRules(tapLink netlink.Link, redirectLink netlink.Link) (bool, error) {
+	err := addIngressQdisc(tapLink)
+	if err != nil {
+		return false, err
+	}
+	err = addRedirectFilter(tapLink, redirectLink)
+	if err != nil {
+		return false, err
+	}
+	owned, err := ensureIngressQdisc(redirectLink)
+	if err != nil {
+		return false, err
+	}
+	err = netlink.FilterAdd(&netlink.U32{
+		FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: redirectLink.Attrs().Index,
+			Parent:    netlink.MakeHandle(0xffff, 0),
+			Priority:  arpMirrorPriority,
+			Protocol:  unix.ETH_P_ARP,
+		},
+		Actions: []netlink.Action{
+			&netlink.MirredAction{
+				ActionAttrs: netlink.ActionAttrs{
+					Action: netlink.TC_ACT_OK,
+				},
+				MirredAction: netlink.TCA_EGRESS_MIRROR,
+				Ifindex:      tapLink.Attrs().Index,
+			},
+		},
+	})
+	if err != nil {
+		return owned, fmt.Errorf("failed to add ARP filter: %w", err)
+	}
+	return owned, addRedirectFilterWithPriority(redirectLink, tapLink, redirectPriority)
+}
+
+// addNATPassFilters passes the TCP and UDP packets that target the source
+// port block of the unikernel with the given tap index to the host, where
+// they get de-masqueraded and routed to the tap device. The filters assume
+// IPv4 packets without options. It returns true, if the ingress qdisc of the
+// redirect interface belongs to urunc.
+func addNATPassFilters(redirectLink netlink.Link, tapIndex int) (bool, error) {
+	owned, err := ensureIngressQdisc(redirectLink)
+	if err != nil {
+		return false, err
+	}
+	tcpPriority, udpPriority := natPassPriorities(tapIndex)
+	natFilters := []struct {
+		protocol uint32
+		priority uint16
+	}{
+		{protocol: unix.IPPROTO_TCP, priority: tcpPriority},
+		{protocol: unix.IPPROTO_UDP, priority: udpPriority},
+	}
+	for _, f := range natFilters {
+		err = netlink.FilterAdd(&netlink.U32{
+			FilterAttrs: netlink.FilterAttrs{
+				LinkIndex: redirectLink.Attrs().Index,
+				Parent:    netlink.MakeHandle(0xffff, 0),
+				Priority:  f.priority,
+				Protocol:  unix.ETH_P_IP,
+			},
+			Sel: &netlink.TcU32Sel{
+				Flags: netlink.TC_U32_TERMINAL,
+				Keys: []netlink.TcU32Key{
+					// IP header length of 20 bytes
+					{Mask: 0x0f000000, Val: 0x05000000, Off: 0},
+					// L4 protocol
+					{Mask: 0x00ff0000, Val: f.protocol << 16, Off: 8},
+					// Destination port in the port block
+					{Mask: 0x0000ff00, Val: natPortBlock(tapIndex), Off: 20},
+				},
+			},
+			// A matching filter without actions lets the packet
+			// continue to the host.
+			ClassId: netlink.MakeHandle(1, 1),
+		})
+		if err != nil {
+			return owned, fmt.Errorf("failed to add NAT filter: %w", err)
+		}
+	}
+	return owned, nil
+}
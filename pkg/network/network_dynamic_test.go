@@ -0,0 +1,85 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNATPortRange(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "16640-16895", natPortRange(1))
+	assert.Equal(t, "32512-32767", natPortRange(maxDynamicIndex))
+	// Every block must be aligned, in order to match it with a u32 mask
+	for index := 1; index <= maxDynamicIndex; index++ {
+		assert.Zero(t, natPortBlock(index)&0xff)
+		assert.Less(t, natPortBlock(index), uint32(0x8000))
+	}
+}
+
+func TestAllocationPriorities(t *testing.T) {
+	t.Run("unikernel with the IP of the pod", func(t *testing.T) {
+		t.Parallel()
+		priorities := allocationPriorities(TapAllocation{Index: 0, Redirect: true})
+		assert.ElementsMatch(t, []uint16{arpMirrorPriority, redirectPriority}, priorities)
+	})
+
+	t.Run("unikernels do not share priorities", func(t *testing.T) {
+		t.Parallel()
+		seen := map[uint16]bool{arpMirrorPriority: true, redirectPriority: true}
+		for index := 1; index <= maxDynamicIndex; index++ {
+			allocation := TapAllocation{Index: index, NATPorts: natPortRange(index)}
+			for _, priority := range allocationPriorities(allocation) {
+				assert.False(t, seen[priority], "priority %d is reused", priority)
+				assert.Less(t, priority, redirectPriority)
+				seen[priority] = true
+			}
+		}
+	})
+
+	t.Run("static network", func(t *testing.T) {
+		t.Parallel()
+		assert.Empty(t, allocationPriorities(TapAllocation{Index: 0}))
+	})
+
+	t.Run("rate limited macvtap", func(t *testing.T) {
+		t.Parallel()
+		priorities := allocationPriorities(TapAllocation{Index: 0, Police: true})
+		assert.Equal(t, []uint16{policePriority}, priorities)
+	})
+}
+
+func TestGuestMAC(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "02:75:72:6e:63:01", guestMAC(1))
+	assert.NotEqual(t, guestMAC(1), guestMAC(2))
+}
+
+func TestIsUruncPriority(t *testing.T) {
+	t.Parallel()
+	for index := 1; index <= maxDynamicIndex; index++ {
+		tcp, udp := natPassPriorities(index)
+		assert.True(t, isUruncPriority(tcp))
+		assert.True(t, isUruncPriority(udp))
+	}
+	assert.True(t, isUruncPriority(policePriority))
+	assert.True(t, isUruncPriority(arpMirrorPriority))
+	assert.True(t, isUruncPriority(redirectPriority))
+	// Priorities that the kernel assigns to filters without one
+	assert.False(t, isUruncPriority(49152))
+	assert.False(t, isUruncPriority(1))
+}
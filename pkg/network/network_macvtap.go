@@ -0,0 +1,168 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// A passthru macvtap takes over its interface, hence there can be at most
+// one for every interface of the namespace.
+const maxMacvtapIndex = 255
+
+type MacvtapNetwork struct {
+}
+
+// NetworkSetup creates a macvtap device in passthru mode on top of the
+// interface iface. The macvtap receives all the traffic of the interface and
+// inherits its MAC, while the unikernel takes over the IP of the interface.
+// The monitor reads and writes the packets through the char device of the
+// macvtap, hence no TC rules are necessary.
+//
+// Since the macvtap takes over the interface, only one unikernel can use each
+// interface of the namespace.
+func (n MacvtapNetwork) NetworkSetup(_ uint32, _ uint32, iface string) (*UnikernelNetworkInfo, error) {
+	parentLink, err := netlink.LinkByName(iface)
+	if err != nil {
+		netlog.Errorf("failed to find %s interface", iface)
+		return nil, err
+	}
+	used, err := hasMacvtap(parentLink)
+	if err != nil {
+		return nil, err
+	}
+	if used {
+		return nil, fmt.Errorf("interface %s is already used by another unikernel", iface)
+	}
+	ifInfo, err := getInterfaceInfo(iface)
+	if err != nil {
+		return nil, err
+	}
+	index, err := freeLinkIndex(DefaultMacvtap, maxMacvtapIndex)
+	if err != nil {
+		return nil, err
+	}
+	macvtapName := linkName(DefaultMacvtap, index)
+	attrs := netlink.NewLinkAttrs()
+	attrs.Name = macvtapName
+	attrs.ParentIndex = parentLink.Attrs().Index
+	attrs.MTU = parentLink.Attrs().MTU
+	err = netlink.LinkAdd(&netlink.Macvtap{
+		Macvlan: netlink.Macvlan{
+			LinkAttrs: attrs,
+			Mode:      netlink.MACVLAN_MODE_PASSTHRU,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create macvtap device: %w", err)
+	}
+	macvtapLink, err := netlink.LinkByName(macvtapName)
+	if err != nil {
+		return nil, err
+	}
+	allocation := TapAllocation{
+		Index:          index,
+		TapDevice:      macvtapName,
+		TapIndex:       macvtapLink.Attrs().Index,
+		GuestIP:        ifInfo.IP,
+		GuestMAC:       ifInfo.MAC,
+		RedirectDevice: iface,
+	}
+	err = netlink.LinkSetUp(macvtapLink)
+	if err != nil {
+		_ = Cleanup(allocation)
+		return nil, err
+	}
+	charDevice, err := macvtapCharDevice(macvtapLink)
+	if err != nil {
+		_ = Cleanup(allocation)
+		return nil, err
+	}
+	return &UnikernelNetworkInfo{
+		TapDevice:     macvtapName,
+		TapCharDevice: &charDevice,
+		EthDevice:     ifInfo,
+		Allocation:    allocation,
+	}, nil
+}
+
+// hasMacvtap returns true, if there is a macvtap device on top of link
+func hasMacvtap(link netlink.Link) (bool, error) {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return false, fmt.Errorf("failed to list links: %w", err)
+	}
+	for _, l := range links {
+		if l.Type() == "macvtap" && l.Attrs().ParentIndex == link.Attrs().Index {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// macvtapCharDevice returns the char device of the macvtap link. The sysfs of
+// the host shows only the interfaces of the host network namespace, hence the
+// numbers of the device get read from a new sysfs instance, which belongs to
+// the current network namespace.
+func macvtapCharDevice(link netlink.Link) (CharDevice, error) {
+	sysfsDir, err := os.MkdirTemp("", "urunc-sysfs-")
+	if err != nil {
+		return CharDevice{}, fmt.Errorf("failed to create sysfs directory: %w", err)
+	}
+	defer os.Remove(sysfsDir)
+	err = unix.Mount("sysfs", sysfsDir, "sysfs", unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "")
+	if err != nil {
+		return CharDevice{}, fmt.Errorf("failed to mount sysfs: %w", err)
+	}
+	defer func() {
+		err := unix.Unmount(sysfsDir, unix.MNT_DETACH)
+		if err != nil {
+			netlog.Errorf("failed to unmount %s: %v", sysfsDir, err)
+		}
+	}()
+	// The kernel names the char device after the index of the macvtap
+	devName := fmt.Sprintf("tap%d", link.Attrs().Index)
+	devFile := filepath.Join(sysfsDir, "class/net", link.Attrs().Name, "macvtap", devName, "dev")
+	data, err := os.ReadFile(devFile)
+	if err != nil {
+		return CharDevice{}, fmt.Errorf("failed to read the char device of %s: %w", link.Attrs().Name, err)
+	}
+	major, minor, err := parseDevNumbers(string(data))
+	if err != nil {
+		return CharDevice{}, err
+	}
+	return CharDevice{
+		Path:  filepath.Join("/dev", devName),
+		Major: major,
+		Minor: minor,
+	}, nil
+}
+
+// parseDevNumbers parses the numbers of a device, as shown in sysfs, in the
+// format <major>:<minor>.
+func parseDevNumbers(dev string) (uint32, uint32, error) {
+	var major, minor uint32
+	_, err := fmt.Sscanf(strings.TrimSpace(dev), "%d:%d", &major, &minor)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid device numbers %q: %w", dev, err)
+	}
+	return major, minor, nil
+}
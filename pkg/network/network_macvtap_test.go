@@ -0,0 +1,61 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDevNumbers(t *testing.T) {
+	t.Run("sysfs format", func(t *testing.T) {
+		t.Parallel()
+		major, minor, err := parseDevNumbers("246:1\n")
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(246), major)
+		assert.Equal(t, uint32(1), minor)
+	})
+	t.Run("invalid format", func(t *testing.T) {
+		t.Parallel()
+		_, _, err := parseDevNumbers("tap3")
+		assert.Error(t, err)
+	})
+}
+
+func TestLinkName(t *testing.T) {
+	t.Run("macvtap", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, "macvtap2_urunc", linkName(DefaultMacvtap, 2))
+	})
+	t.Run("tap", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, "tap0_urunc", tapName(0))
+	})
+}
+
+func TestNewNetworkManager(t *testing.T) {
+	t.Run("macvtap", func(t *testing.T) {
+		t.Parallel()
+		manager, err := NewNetworkManager("macvtap")
+		assert.NoError(t, err)
+		assert.IsType(t, &MacvtapNetwork{}, manager)
+	})
+	t.Run("unknown", func(t *testing.T) {
+		t.Parallel()
+		_, err := NewNetworkManager("bridge")
+		assert.Error(t, err)
+	})
+}
@@ -15,103 +15,166 @@
 package network
 
 import (
-	"bytes"
 	"fmt"
-	"os"
-	"os/exec"
-	"strings"
+	"net"
+	"slices"
 
 	"github.com/nubificus/urunc/internal/constants"
 	"github.com/vishvananda/netlink"
 )
 
-var StaticIPAddr = fmt.Sprintf("%s/24", constants.StaticNetworkTapIP)
-
-type StaticNetwork struct {
+// StaticConfig describes the network of the static mode
+type StaticConfig struct {
+	Subnet  *net.IPNet    // The subnet of the tap device and the unikernel
+	TapIP   net.IP        // The IP of the tap device, which is the gateway of the unikernel
+	GuestIP net.IP        // The IP of the unikernel
+	Ports   []PortForward // The ports of the pod that get forwarded to the unikernel
 }
 
-// Apply the following rule:
-// iptables -t nat -A POSTROUTING -o <IF> -s <IP> -j MASQUERADE --wait 1
-// and write 1 to /proc/sys/net/ipv4/ip_forward to enable IP forwarding.
-func setNATRule(iface string, sourceIP string) error {
-	var args []string
-	var stdout, stderr bytes.Buffer
-
-	path, err := exec.LookPath("iptables")
-	if err != nil {
-		return err
+// DefaultStaticConfig returns the configuration of the static network that
+// Knative expects.
+func DefaultStaticConfig() StaticConfig {
+	_, subnet, _ := net.ParseCIDR(constants.StaticNetworkSubnet)
+	return StaticConfig{
+		Subnet:  subnet,
+		TapIP:   net.ParseIP(constants.StaticNetworkTapIP).To4(),
+		GuestIP: net.ParseIP(constants.StaticNetworkUnikernelIP).To4(),
 	}
+}
 
-	file, err := os.OpenFile("/proc/sys/net/ipv4/ip_forward", os.O_WRONLY, 0644)
+// NewStaticConfig returns the configuration of the static network with the
+// given IPv4 subnet and addresses. An empty subnet stands for the default
+// one. An empty tap or guest IP stands for the first or the second address of
+// the subnet respectively.
+func NewStaticConfig(subnet string, tapIP string, guestIP string, ports []PortForward) (StaticConfig, error) {
+	config := DefaultStaticConfig()
+	config.Ports = ports
+	if subnet == "" && tapIP == "" && guestIP == "" {
+		return config, nil
+	}
+	if subnet != "" {
+		_, ipNet, err := net.ParseCIDR(subnet)
+		if err != nil {
+			return StaticConfig{}, fmt.Errorf("invalid static network subnet %q: %w", subnet, err)
+		}
+		config.Subnet = ipNet
+	}
+	if config.Subnet.IP.To4() == nil {
+		return StaticConfig{}, fmt.Errorf("static network subnet %s is not an IPv4 subnet", config.Subnet)
+	}
+	ones, bits := config.Subnet.Mask.Size()
+	if bits-ones < 2 {
+		return StaticConfig{}, fmt.Errorf("static network subnet %s is too small", config.Subnet)
+	}
+	var err error
+	config.TapIP, err = staticIP(config.Subnet, tapIP, 1)
 	if err != nil {
-		return fmt.Errorf("failed to open /proc/sys/net/ipv4/ip_forward: %w", err)
+		return StaticConfig{}, err
 	}
-	defer file.Close()
-
-	_, err = file.WriteString("1")
+	config.GuestIP, err = staticIP(config.Subnet, guestIP, 2)
 	if err != nil {
-		return fmt.Errorf("failed to enable IP forwarding: %w", err)
+		return StaticConfig{}, err
 	}
-	netlog.Debug("Enabled IP forwarding")
-
-	args = append(args, path)
-	args = append(args, "-t")
-	args = append(args, "nat")
-	args = append(args, "-A")
-	args = append(args, "POSTROUTING")
-	args = append(args, "-s")
-	args = append(args, sourceIP)
-	args = append(args, "-o")
-	args = append(args, iface)
-	args = append(args, "-j")
-	args = append(args, "MASQUERADE")
-	args = append(args, "--wait")
-	args = append(args, "1")
+	if config.TapIP.Equal(config.GuestIP) {
+		return StaticConfig{}, fmt.Errorf("the tap device and the unikernel can not share the IP %s", config.TapIP)
+	}
+	return config, nil
+}
 
-	cmd := exec.Cmd{
-		Path:   path,
-		Args:   args,
-		Stdout: &stdout,
-		Stderr: &stderr,
+// staticIP parses an IPv4 address of subnet. If ip is empty, it returns the
+// address of subnet with the given offset.
+func staticIP(subnet *net.IPNet, ip string, offset byte) (net.IP, error) {
+	if ip == "" {
+		addr := slices.Clone(subnet.IP.To4())
+		addr[3] += offset
+		return addr, nil
 	}
-	err = cmd.Run()
-	if err != nil {
-		switch err.(type) {
-		case *exec.ExitError:
-			return fmt.Errorf("iptables command %s failed: %s", cmd.String(), stderr.String())
-		default:
-			return err
-		}
+	addr := net.ParseIP(ip).To4()
+	if addr == nil {
+		return nil, fmt.Errorf("invalid static network IP %q", ip)
+	}
+	if !subnet.Contains(addr) {
+		return nil, fmt.Errorf("IP %s is not in the static network subnet %s", addr, subnet)
+	}
+	// The address of the subnet and the broadcast address are reserved
+	broadcast := slices.Clone(subnet.IP.To4())
+	for i := range broadcast {
+		broadcast[i] |= ^subnet.Mask[len(subnet.Mask)-4+i]
 	}
+	if addr.Equal(subnet.IP) || addr.Equal(broadcast) {
+		return nil, fmt.Errorf("IP %s is reserved in the static network subnet %s", addr, subnet)
+	}
+	return addr, nil
+}
 
-	netlog.Debug("Applied iptables rule for NAT")
+type StaticNetwork struct {
+	Config StaticConfig
+}
 
-	return nil
+// NewStaticNetwork returns a static network manager with the given
+// configuration.
+func NewStaticNetwork(config StaticConfig) *StaticNetwork {
+	return &StaticNetwork{Config: config}
 }
 
-func (n StaticNetwork) NetworkSetup(uid uint32, gid uint32) (*UnikernelNetworkInfo, error) {
-	newTapName := strings.ReplaceAll(DefaultTap, "X", "0")
-	addTCRules := false
-	redirectLink, err := netlink.LinkByName(DefaultInterface)
+// NetworkSetup creates a tap device with a static IP for the unikernel and
+// masquerades its traffic behind the IP of the interface iface. The traffic
+// that targets the forwarded ports of the interface gets forwarded to the
+// unikernel. Since the IPs are static, only a single unikernel with a single
+// network device can use this network in the namespace.
+func (n StaticNetwork) NetworkSetup(uid uint32, gid uint32, iface string) (*UnikernelNetworkInfo, error) {
+	config := n.Config
+	if config.Subnet == nil {
+		config = DefaultStaticConfig()
+		config.Ports = n.Config.Ports
+	}
+	newTapName := tapName(0)
+	redirectLink, err := netlink.LinkByName(iface)
 	if err != nil {
-		netlog.Errorf("failed to find %s interface", DefaultInterface)
+		netlog.Errorf("failed to find %s interface", iface)
 		return nil, err
 	}
-	newTapDevice, err := networkSetup(newTapName, StaticIPAddr, redirectLink, addTCRules, uid, gid)
+	ones, _ := config.Subnet.Mask.Size()
+	tapAddr := fmt.Sprintf("%s/%d", config.TapIP, ones)
+	newTapDevice, err := networkSetup(newTapName, tapAddr, redirectLink, uid, gid)
 	if err != nil {
 		return nil, err
 	}
-	err = setNATRule(DefaultInterface, StaticIPAddr)
+	allocation := TapAllocation{
+		Index:          0,
+		TapDevice:      newTapDevice.Attrs().Name,
+		TapIndex:       newTapDevice.Attrs().Index,
+		TapIP:          config.TapIP.String(),
+		GuestIP:        config.GuestIP.String(),
+		GuestMAC:       redirectLink.Attrs().HardwareAddr.String(),
+		RedirectDevice: redirectLink.Attrs().Name,
+		NATSubnet:      config.Subnet.String(),
+	}
+	err = addMasquerade(&allocation)
 	if err != nil {
+		_ = Cleanup(allocation)
 		return nil, err
 	}
+	if len(config.Ports) > 0 {
+		ifInfo, err := getInterfaceInfo(iface)
+		if err != nil {
+			_ = Cleanup(allocation)
+			return nil, err
+		}
+		err = addPortForwards(&allocation, ifInfo.IP, config.Ports)
+		if err != nil {
+			_ = Cleanup(allocation)
+			return nil, err
+		}
+	}
 	return &UnikernelNetworkInfo{
-		TapDevice: newTapDevice.Attrs().Name,
+		TapDevice:  newTapDevice.Attrs().Name,
+		Allocation: allocation,
 		EthDevice: Interface{
-			IP:             constants.StaticNetworkUnikernelIP,
-			DefaultGateway: constants.StaticNetworkTapIP,
-			Mask:           "255.255.255.0",
-			Interface:      DefaultInterface, // or tap0_urunc?
+			IP:             config.GuestIP.String(),
+			DefaultGateway: config.TapIP.String(),
+			Mask:           decimalMask(config.Subnet.Mask),
+			Interface:      iface,
 			MAC:            redirectLink.Attrs().HardwareAddr.String(),
 		},
 	}, nil
@@ -0,0 +1,67 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"net"
+	"testing"
+
+	"github.com/nubificus/urunc/internal/constants"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStaticConfig(t *testing.T) {
+	t.Run("default configuration", func(t *testing.T) {
+		t.Parallel()
+		config, err := NewStaticConfig("", "", "", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, constants.StaticNetworkSubnet, config.Subnet.String())
+		assert.Equal(t, constants.StaticNetworkTapIP, config.TapIP.String())
+		assert.Equal(t, constants.StaticNetworkUnikernelIP, config.GuestIP.String())
+	})
+	t.Run("addresses default to the start of the subnet", func(t *testing.T) {
+		t.Parallel()
+		config, err := NewStaticConfig("10.10.0.0/16", "", "", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "10.10.0.1", config.TapIP.String())
+		assert.Equal(t, "10.10.0.2", config.GuestIP.String())
+	})
+	t.Run("custom addresses", func(t *testing.T) {
+		t.Parallel()
+		ports := []PortForward{{Protocol: "tcp", Port: 80, GuestPort: 8080}}
+		config, err := NewStaticConfig("192.168.5.0/24", "192.168.5.254", "192.168.5.10", ports)
+		assert.NoError(t, err)
+		assert.Equal(t, net.IP{192, 168, 5, 254}, config.TapIP)
+		assert.Equal(t, net.IP{192, 168, 5, 10}, config.GuestIP)
+		assert.Equal(t, ports, config.Ports)
+	})
+	t.Run("invalid configurations", func(t *testing.T) {
+		t.Parallel()
+		invalid := []struct{ subnet, tapIP, guestIP string }{
+			{"10.10.0.0", "", ""},
+			{"fd00::/64", "", ""},
+			{"10.10.0.0/31", "", ""},
+			{"10.10.0.0/24", "10.10.1.1", ""},
+			{"10.10.0.0/24", "", "10.10.0.255"},
+			{"10.10.0.0/24", "10.10.0.0", ""},
+			{"10.10.0.0/24", "10.10.0.2", ""},
+			{"", "", "not-an-ip"},
+		}
+		for _, c := range invalid {
+			_, err := NewStaticConfig(c.subnet, c.tapIP, c.guestIP, nil)
+			assert.Error(t, err, c)
+		}
+	})
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+)
+
+func TestDiscoverInterfaces(t *testing.T) {
+	t.Run("requested interfaces", func(t *testing.T) {
+		t.Parallel()
+		ifaces, err := DiscoverInterfaces([]string{"lo"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"lo"}, ifaces)
+	})
+	t.Run("missing interface", func(t *testing.T) {
+		t.Parallel()
+		_, err := DiscoverInterfaces([]string{"lo", "urunc-missing0"})
+		assert.ErrorContains(t, err, "urunc-missing0")
+	})
+	t.Run("duplicate interface", func(t *testing.T) {
+		t.Parallel()
+		_, err := DiscoverInterfaces([]string{"lo", "lo"})
+		assert.Error(t, err)
+	})
+}
+
+func TestIsDefaultRoute(t *testing.T) {
+	_, anyDst, _ := net.ParseCIDR("0.0.0.0/0")
+	_, subnet, _ := net.ParseCIDR("10.0.0.0/24")
+	t.Run("no destination", func(t *testing.T) {
+		t.Parallel()
+		assert.True(t, isDefaultRoute(netlink.Route{}))
+	})
+	t.Run("any destination", func(t *testing.T) {
+		t.Parallel()
+		assert.True(t, isDefaultRoute(netlink.Route{Dst: anyDst}))
+	})
+	t.Run("subnet", func(t *testing.T) {
+		t.Parallel()
+		assert.False(t, isDefaultRoute(netlink.Route{Dst: subnet}))
+	})
+}
+
+func TestDecimalMask(t *testing.T) {
+	t.Run("IPv4 mask", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, "255.255.255.0", decimalMask(net.CIDRMask(24, 32)))
+	})
+	t.Run("host mask", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, "255.255.255.255", decimalMask(net.CIDRMask(32, 32)))
+	})
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// The police filters of urunc on the tap devices get evaluated before
+	// the redirect filters.
+	tapPolicePriority uint16 = 1
+
+	// The latency of the TBF qdiscs, which determines how many bytes can
+	// wait in the queue, on top of the burst.
+	tbfLatencyUsec = 25000
+
+	// The burst of a limit is the traffic of 100ms at its rate, but not
+	// less than minBurst bytes, in order to fit a few full sized frames.
+	burstDivisor = 10
+	minBurst     = 32 * 1024
+
+	// Kubernetes does not accept bandwidth limits out of this range
+	minBandwidth = 1000
+	maxBandwidth = 1000000000000000
+)
+
+// RateLimit holds the bandwidth limits of the network of a unikernel in bits
+// per second. A limit of 0 means no limit. The directions are the ones of the
+// container, hence the ingress traffic is the one towards the unikernel.
+type RateLimit struct {
+	Ingress uint64 `json:"ingress,omitempty"`
+	Egress  uint64 `json:"egress,omitempty"`
+}
+
+// bandwidthSuffixes are the suffixes of the Kubernetes quantities
+var bandwidthSuffixes = []struct {
+	suffix     string
+	multiplier float64
+}{
+	// The binary suffixes first, since they end with the decimal ones
+	{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40}, {"Pi", 1 << 50},
+	{"k", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12}, {"P", 1e15},
+}
+
+// ParseBandwidth parses a bandwidth in bits per second, in the format of the
+// kubernetes.io/ingress-bandwidth and kubernetes.io/egress-bandwidth
+// annotations (e.g. 10M or 1Gi).
+func ParseBandwidth(value string) (uint64, error) {
+	value = strings.TrimSpace(value)
+	number := value
+	multiplier := 1.0
+	for _, s := range bandwidthSuffixes {
+		if strings.HasSuffix(value, s.suffix) {
+			number = strings.TrimSuffix(value, s.suffix)
+			multiplier = s.multiplier
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("invalid bandwidth %q", value)
+	}
+	bandwidth := n * multiplier
+	if bandwidth < minBandwidth || bandwidth > maxBandwidth {
+		return 0, fmt.Errorf("bandwidth %q is out of range [1k, 1P]", value)
+	}
+	return uint64(bandwidth), nil
+}
+
+// ApplyRateLimit limits the bandwidth of the network of a unikernel. The
+// traffic that the tap device of the unikernel transmits to the guest passes
+// through a TBF qdisc, while a police filter drops the traffic of the guest
+// that exceeds the limit, as it arrives at the tap device. Hence, the limits
+// apply in the same way to every monitor.
+//
+// The traffic from the char device of a macvtap bypasses its ingress, but it
+// passes through its qdisc. Hence, a TBF qdisc limits the egress traffic of
+// the guest and a police filter on the interface of the macvtap limits the
+// ingress traffic.
+func ApplyRateLimit(info *UnikernelNetworkInfo, limit RateLimit) error {
+	tapLink, err := netlink.LinkByName(info.TapDevice)
+	if err != nil {
+		return fmt.Errorf("failed to find %s: %w", info.TapDevice, err)
+	}
+	towardsGuest := limit.Ingress
+	fromGuest := limit.Egress
+	if info.TapCharDevice != nil {
+		towardsGuest = limit.Egress
+		fromGuest = limit.Ingress
+	}
+	// The qdiscs and filters of the tap device get deleted along with it
+	if towardsGuest != 0 {
+		err = addTBFQdisc(tapLink, towardsGuest)
+		if err != nil {
+			return err
+		}
+	}
+	if fromGuest == 0 {
+		return nil
+	}
+	if info.TapCharDevice == nil {
+		_, err = ensureIngressQdisc(tapLink)
+		if err != nil {
+			return err
+		}
+		return addPoliceFilter(tapLink, fromGuest, tapPolicePriority)
+	}
+	parentLink, err := netlink.LinkByName(info.Allocation.RedirectDevice)
+	if err != nil {
+		return fmt.Errorf("failed to find %s: %w", info.Allocation.RedirectDevice, err)
+	}
+	owned, err := ensureIngressQdisc(parentLink)
+	if err != nil {
+		return err
+	}
+	// Record the filter, in order to delete it along with the macvtap
+	info.Allocation.RedirectQdisc = info.Allocation.RedirectQdisc || owned
+	info.Allocation.Police = true
+	return addPoliceFilter(parentLink, fromGuest, policePriority)
+}
+
+// rateBurst returns the burst in bytes of a limit of rate bits per second
+func rateBurst(rate uint64) uint32 {
+	burst := rate / 8 / burstDivisor
+	if burst < minBurst {
+		return minBurst
+	}
+	if burst > math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(burst)
+}
+
+// addTBFQdisc adds a TBF root qdisc to link, which limits its transmitted
+// traffic to rate bits per second.
+func addTBFQdisc(link netlink.Link, rate uint64) error {
+	rateBytes := rate / 8
+	burst := rateBurst(rate)
+	limit := float64(rateBytes)*tbfLatencyUsec/netlink.TIME_UNITS_PER_SEC + float64(burst)
+	if limit > math.MaxUint32 {
+		limit = math.MaxUint32
+	}
+	err := netlink.QdiscReplace(&netlink.Tbf{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: link.Attrs().Index,
+			Handle:    netlink.MakeHandle(1, 0),
+			Parent:    netlink.HANDLE_ROOT,
+		},
+		Rate:   rateBytes,
+		Limit:  uint32(limit),
+		Buffer: netlink.Xmittime(rateBytes, burst),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add TBF qdisc to %s: %w", link.Attrs().Name, err)
+	}
+	return nil
+}
+
+// addPoliceFilter adds an ingress filter to link, which drops the traffic
+// that exceeds rate bits per second. The rest of the traffic continues to the
+// next filters.
+func addPoliceFilter(link netlink.Link, rate uint64, priority uint16) error {
+	rateBytes := rate / 8
+	if rateBytes > math.MaxUint32 {
+		return fmt.Errorf("bandwidth of %d bits per second is too high for a police filter", rate)
+	}
+	police := netlink.NewPoliceAction()
+	police.Rate = uint32(rateBytes)
+	police.Burst = rateBurst(rate)
+	police.ExceedAction = netlink.TC_POLICE_SHOT
+	police.NotExceedAction = netlink.TC_POLICE_UNSPEC
+	err := netlink.FilterAdd(&netlink.U32{
+		FilterAttrs: netlink.FilterAttrs{
+			LinkIndex: link.Attrs().Index,
+			Parent:    netlink.MakeHandle(0xffff, 0),
+			Priority:  priority,
+			Protocol:  unix.ETH_P_ALL,
+		},
+		Actions: []netlink.Action{police},
+	})
+	if errors.Is(err, unix.ENOENT) {
+		return fmt.Errorf("failed to add police filter to %s, the kernel might not support the police action: %w", link.Attrs().Name, err)
+	} else if err != nil {
+		return fmt.Errorf("failed to add police filter to %s: %w", link.Attrs().Name, err)
+	}
+	return nil
+}
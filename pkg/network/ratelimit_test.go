@@ -0,0 +1,67 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBandwidth(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected uint64
+	}{
+		{"10M", 10000000},
+		{"1Gi", 1 << 30},
+		{"100k", 100000},
+		{"1.5M", 1500000},
+		{" 2000 ", 2000},
+		{"1Ki", 1024},
+	}
+	for _, tc := range tests {
+		t.Run(tc.value, func(t *testing.T) {
+			t.Parallel()
+			bandwidth, err := ParseBandwidth(tc.value)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, bandwidth)
+		})
+	}
+
+	t.Run("invalid values", func(t *testing.T) {
+		t.Parallel()
+		for _, value := range []string{"", "M", "10Mbit", "-1M", "NaN"} {
+			_, err := ParseBandwidth(value)
+			assert.Error(t, err, value)
+		}
+	})
+
+	t.Run("out of range", func(t *testing.T) {
+		t.Parallel()
+		_, err := ParseBandwidth("999")
+		assert.Error(t, err)
+		_, err = ParseBandwidth("2P")
+		assert.Error(t, err)
+	})
+}
+
+func TestRateBurst(t *testing.T) {
+	t.Parallel()
+	// 100ms of traffic at the given rate
+	assert.Equal(t, uint32(1250000), rateBurst(100000000))
+	// Low rates get enough burst for a few full sized frames
+	assert.Equal(t, uint32(minBurst), rateBurst(1000000))
+}
@@ -0,0 +1,280 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	mke2fsBinary = "mke2fs"
+
+	// The block size of the images and the space that every file takes at
+	// least
+	imageBlockSize = 4096
+	// The free space of an image, on top of its content, for the metadata of
+	// the filesystem and for any new files of the guest
+	imageSlack = 8 * 1024 * 1024
+
+	// The directory where urunc keeps the images that it creates from the
+	// rootfs of containers, in order to reuse them for the containers of
+	// the same image
+	rootfsCacheDir = "/var/lib/urunc/rootfs"
+	// The time after which an unused image of the cache gets removed
+	rootfsCacheMaxAge = 7 * 24 * time.Hour
+	// The block image of the rootfs of the container, in its base directory
+	rootfsImageName = "rootfs.img"
+	// The path of the block image of the rootfs in the rootfs of the monitor
+	monitorRootfsImage = "/.urunc/rootfs.img"
+)
+
+// imageSize returns the size in bytes and the number of inodes of an image
+// that fits the content of dir, with a quarter of free space and inodes.
+func imageSize(dir string) (uint64, uint64, error) {
+	var used, inodes uint64
+	err := filepath.WalkDir(dir, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		inodes++
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		blocks := (uint64(info.Size()) + imageBlockSize - 1) / imageBlockSize //nolint: gosec
+		if blocks == 0 {
+			blocks = 1
+		}
+		used += blocks * imageBlockSize
+		return nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to walk %s: %w", dir, err)
+	}
+	size := used + used/4 + imageSlack
+	// mke2fs expects the size in whole blocks
+	size = (size + imageBlockSize - 1) / imageBlockSize * imageBlockSize
+	return size, inodes + inodes/4 + 16, nil
+}
+
+// buildExt2Image creates an ext2 image at image with the content of srcDir.
+// The image is a copy, hence any changes of the guest stay in the image.
+func buildExt2Image(srcDir string, image string) error {
+	mke2fsPath, err := exec.LookPath(mke2fsBinary)
+	if err != nil {
+		return fmt.Errorf("%s is required to create block images: %w", mke2fsBinary, err)
+	}
+	size, inodes, err := imageSize(srcDir)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(image), 0o700)
+	if err != nil {
+		return fmt.Errorf("failed to create directory of %s: %w", image, err)
+	}
+	args := []string{
+		"-q", "-F",
+		"-t", "ext2",
+		"-b", strconv.Itoa(imageBlockSize),
+		"-N", strconv.FormatUint(inodes, 10),
+		"-d", srcDir,
+		image,
+		strconv.FormatUint(size/1024, 10) + "k",
+	}
+	out, err := exec.Command(mke2fsPath, args...).CombinedOutput() //nolint: gosec
+	if err != nil {
+		_ = os.Remove(image)
+		return fmt.Errorf("failed to create block image of %s: %w: %s", srcDir, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// rootfsDigest returns a digest of the tree of dir, which covers the paths,
+// the metadata and the content of the files and the targets of the symlinks.
+// The digest names the cached images of the rootfs, hence it has to cover
+// the content, since images that differ only in the content of their files
+// can have the same metadata (e.g. reproducible builds).
+func rootfsDigest(dir string) (string, error) {
+	hash := sha256.New()
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		var uid, gid uint32
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			uid = stat.Uid
+			gid = stat.Gid
+		}
+		content := ""
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			content, err = os.Readlink(path)
+		case info.Mode().IsRegular():
+			content, err = fileDigest(path)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(hash, "%s\x00%d\x00%d\x00%d\x00%d\x00%d\x00%s\n", relPath,
+			info.Mode(), info.Size(), info.ModTime().UnixNano(), uid, gid, content)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to walk %s: %w", dir, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// fileDigest returns the sha256 digest of the content of the file at path
+func fileDigest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// cachedImage returns the path of the image with key and ext in cacheDir.
+// If the image is not there, it gets created with build. The image gets
+// created under a temporary name and gets renamed, hence concurrent builds of
+// the same image do not see a partial image. The modification time of the
+// image marks its last use, for pruneCache.
+func cachedImage(cacheDir string, key string, ext string, build func(path string) error) (string, error) {
+	image := filepath.Join(cacheDir, key+ext)
+	_, err := os.Stat(image)
+	if err == nil {
+		uniklog.WithField("image", image).Debug("using cached image")
+		now := time.Now()
+		err = os.Chtimes(image, now, now)
+		if err != nil {
+			return "", fmt.Errorf("failed to set times of %s: %w", image, err)
+		}
+		return image, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to stat %s: %w", image, err)
+	}
+	err = os.MkdirAll(cacheDir, 0o700)
+	if err != nil {
+		return "", fmt.Errorf("failed to create directory %s: %w", cacheDir, err)
+	}
+	tmpImage := image + "." + strconv.Itoa(os.Getpid()) + ".tmp"
+	err = build(tmpImage)
+	if err != nil {
+		_ = os.Remove(tmpImage)
+		return "", err
+	}
+	err = os.Rename(tmpImage, image)
+	if err != nil {
+		_ = os.Remove(tmpImage)
+		return "", fmt.Errorf("failed to rename %s: %w", tmpImage, err)
+	}
+	return image, nil
+}
+
+// pruneCache removes the images of cacheDir that were not used for maxAge,
+// along with any leftovers of failed builds. The containers that use an
+// image have a copy or a bind mount of it, hence the removal does not affect
+// them.
+func pruneCache(cacheDir string, maxAge time.Duration) error {
+	entries, err := os.ReadDir(cacheDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read %s: %w", cacheDir, err)
+	}
+	deadline := time.Now().Add(-maxAge)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", entry.Name(), err)
+		}
+		if !info.Mode().IsRegular() || info.ModTime().After(deadline) {
+			continue
+		}
+		image := filepath.Join(cacheDir, entry.Name())
+		err = os.Remove(image)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s: %w", image, err)
+		}
+		uniklog.WithField("image", image).Debug("removed unused cached image")
+	}
+	return nil
+}
+
+// copyImage copies the image src to dst. The copy shares the blocks of src,
+// if the filesystem allows it, and it stays sparse otherwise.
+func copyImage(src string, dst string) error {
+	out, err := exec.Command("cp", "--reflink=auto", "--sparse=always", src, dst).CombinedOutput() //nolint: gosec
+	if err != nil {
+		return fmt.Errorf("failed to copy %s: %w: %s", src, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// buildRootfsImage creates the ext2 image of the rootfs of the container in
+// its base directory and returns its path. The image is a copy of the cached
+// image of the rootfs, which gets created if needed, hence the changes of the
+// guest stay in the image of the container.
+func (u *Unikontainer) buildRootfsImage(rootfsDir string) (string, error) {
+	digest, err := rootfsDigest(rootfsDir)
+	if err != nil {
+		return "", err
+	}
+	cached, err := cachedImage(rootfsCacheDir, digest, ".ext2", func(path string) error {
+		return buildExt2Image(rootfsDir, path)
+	})
+	if err != nil {
+		return "", err
+	}
+	image := filepath.Join(u.BaseDir, rootfsImageName)
+	err = copyImage(cached, image)
+	if err != nil {
+		return "", err
+	}
+	// The monitor might not run as root
+	err = os.Chown(image, int(u.Spec.Process.User.UID), int(u.Spec.Process.User.GID))
+	if err != nil {
+		return "", fmt.Errorf("failed to set owner of %s: %w", image, err)
+	}
+	return image, nil
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestImageSize(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "small"), []byte("data"), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "large"), make([]byte, 3*imageBlockSize+1), 0o600))
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "empty"), 0o755))
+
+	size, inodes, err := imageSize(dir)
+	assert.NoError(t, err)
+	// The directories, the small file and the large file take 1, 1, 1 and
+	// 4 blocks respectively, and the free space is a quarter of them, rounded
+	// up to whole blocks
+	used := uint64(7 * imageBlockSize)
+	assert.Equal(t, used+2*imageBlockSize+imageSlack, size)
+	assert.Equal(t, uint64(4+1+16), inodes)
+}
+
+func TestRootfsDigest(t *testing.T) {
+	newRootfs := func(t *testing.T) string {
+		dir := t.TempDir()
+		mtime := time.Unix(1700000000, 0)
+		for _, name := range []string{"bin/app", "etc/config"} {
+			path := filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(name), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(path, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.Symlink("bin/app", filepath.Join(dir, "app")); err != nil {
+			t.Fatal(err)
+		}
+		times := []unix.Timespec{unix.NsecToTimespec(mtime.UnixNano()), unix.NsecToTimespec(mtime.UnixNano())}
+		if err := unix.UtimesNanoAt(unix.AT_FDCWD, filepath.Join(dir, "app"), times, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"bin", "etc", "."} {
+			if err := os.Chtimes(filepath.Join(dir, name), mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return dir
+	}
+
+	t.Run("same tree", func(t *testing.T) {
+		t.Parallel()
+		digest1, err := rootfsDigest(newRootfs(t))
+		assert.NoError(t, err)
+		digest2, err := rootfsDigest(newRootfs(t))
+		assert.NoError(t, err)
+		assert.Equal(t, digest1, digest2)
+		assert.Len(t, digest1, 64)
+	})
+
+	t.Run("changed file", func(t *testing.T) {
+		t.Parallel()
+		dir := newRootfs(t)
+		digest1, err := rootfsDigest(dir)
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "etc/config"), []byte("changed config"), 0o644))
+		digest2, err := rootfsDigest(dir)
+		assert.NoError(t, err)
+		assert.NotEqual(t, digest1, digest2)
+	})
+
+	t.Run("same metadata with different content", func(t *testing.T) {
+		t.Parallel()
+		dir := newRootfs(t)
+		digest1, err := rootfsDigest(dir)
+		assert.NoError(t, err)
+		path := filepath.Join(dir, "etc/config")
+		assert.NoError(t, os.WriteFile(path, []byte("etc/CONFIG"), 0o644))
+		mtime := time.Unix(1700000000, 0)
+		assert.NoError(t, os.Chtimes(path, mtime, mtime))
+		digest2, err := rootfsDigest(dir)
+		assert.NoError(t, err)
+		assert.NotEqual(t, digest1, digest2)
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		t.Parallel()
+		_, err := rootfsDigest(filepath.Join(t.TempDir(), "missing"))
+		assert.Error(t, err)
+	})
+}
+
+func TestCachedImage(t *testing.T) {
+	t.Run("build once", func(t *testing.T) {
+		t.Parallel()
+		cacheDir := filepath.Join(t.TempDir(), "cache")
+		builds := 0
+		build := func(path string) error {
+			builds++
+			return os.WriteFile(path, []byte("image"), 0o600)
+		}
+		image1, err := cachedImage(cacheDir, "digest", ".ext2", build)
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join(cacheDir, "digest.ext2"), image1)
+		image2, err := cachedImage(cacheDir, "digest", ".ext2", build)
+		assert.NoError(t, err)
+		assert.Equal(t, image1, image2)
+		assert.Equal(t, 1, builds)
+	})
+
+	t.Run("use refreshes the image", func(t *testing.T) {
+		t.Parallel()
+		cacheDir := t.TempDir()
+		image := filepath.Join(cacheDir, "digest.ext2")
+		if err := os.WriteFile(image, []byte("image"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		old := time.Now().Add(-time.Hour)
+		if err := os.Chtimes(image, old, old); err != nil {
+			t.Fatal(err)
+		}
+		_, err := cachedImage(cacheDir, "digest", ".ext2", func(_ string) error {
+			return errors.New("unexpected build")
+		})
+		assert.NoError(t, err)
+		info, err := os.Stat(image)
+		assert.NoError(t, err)
+		assert.True(t, info.ModTime().After(old))
+	})
+
+	t.Run("failed build", func(t *testing.T) {
+		t.Parallel()
+		cacheDir := t.TempDir()
+		_, err := cachedImage(cacheDir, "digest", ".ext2", func(path string) error {
+			_ = os.WriteFile(path, []byte("partial"), 0o600)
+			return errors.New("build failed")
+		})
+		assert.Error(t, err)
+		entries, err := os.ReadDir(cacheDir)
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+}
+
+func TestPruneCache(t *testing.T) {
+	t.Run("unused images", func(t *testing.T) {
+		t.Parallel()
+		cacheDir := t.TempDir()
+		old := time.Now().Add(-2 * time.Hour)
+		for _, name := range []string{"old.ext2", "old.cpio.123.tmp", "new.cpio"} {
+			path := filepath.Join(cacheDir, name)
+			if err := os.WriteFile(path, []byte("image"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if strings.HasPrefix(name, "old") {
+				if err := os.Chtimes(path, old, old); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		assert.NoError(t, pruneCache(cacheDir, time.Hour))
+		entries, err := os.ReadDir(cacheDir)
+		assert.NoError(t, err)
+		if len(entries) != 1 {
+			t.Fatalf("expected 1 image, got %d", len(entries))
+		}
+		assert.Equal(t, "new.cpio", entries[0].Name())
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		t.Parallel()
+		assert.NoError(t, pruneCache(filepath.Join(t.TempDir(), "missing"), time.Hour))
+	})
+}
@@ -0,0 +1,335 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/containerd/cgroups/v3"
+	"github.com/containerd/cgroups/v3/cgroup1"
+	"github.com/containerd/cgroups/v3/cgroup2"
+	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
+	"github.com/godbus/dbus/v5"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+const (
+	defaultSystemdSlice  = "system.slice"
+	defaultSystemdPrefix = "urunc"
+	systemdUnitTimeout   = 30 * time.Second
+)
+
+var ErrCgroupsUnavailable = errors.New("cgroups are not available")
+
+// CgroupState holds the information required to find the cgroup of the
+// container after its creation.
+type CgroupState struct {
+	Path    string `json:"path"`    // The cgroupsPath of the container's spec
+	Systemd bool   `json:"systemd"` // The cgroup is managed through systemd
+}
+
+// systemdUnit parses a cgroupsPath of the form "slice:prefix:name" and
+// returns the slice and the name of the unit for the container.
+func systemdUnit(cgroupsPath string, containerID string) (slice string, unit string, err error) {
+	parts := strings.Split(cgroupsPath, ":")
+	if cgroupsPath != "" && len(parts) != 3 {
+		return "", "", fmt.Errorf("expected cgroupsPath of the form \"slice:prefix:name\" but got %q", cgroupsPath)
+	}
+	slice, prefix, name := defaultSystemdSlice, defaultSystemdPrefix, containerID
+	if len(parts) == 3 {
+		if parts[0] != "" {
+			slice = parts[0]
+		}
+		if parts[1] != "" {
+			prefix = parts[1]
+		}
+		if parts[2] != "" {
+			name = parts[2]
+		}
+	}
+	if strings.HasSuffix(name, ".slice") {
+		return slice, name, nil
+	}
+	return slice, prefix + "-" + name + ".scope", nil
+}
+
+// monitorResources returns the resources of the container that get applied
+// to the cgroup of the monitor. The memory limit defines the memory of the
+// guest and the monitor itself requires additional memory on top of it,
+// therefore it is not applied. Furthermore, the devices that the monitor
+// can access are already restricted by its rootfs.
+func monitorResources(resources *specs.LinuxResources) *specs.LinuxResources {
+	if resources == nil {
+		return &specs.LinuxResources{}
+	}
+	return &specs.LinuxResources{
+		CPU:     resources.CPU,
+		Pids:    resources.Pids,
+		BlockIO: resources.BlockIO,
+	}
+}
+
+// newSystemdProperty creates a property for a systemd unit
+func newSystemdProperty(name string, value any) systemdDbus.Property {
+	return systemdDbus.Property{
+		Name:  name,
+		Value: dbus.MakeVariant(value),
+	}
+}
+
+// systemdResourceProperties converts the resources to the respective
+// properties of a systemd unit. Systemd owns these values and it might
+// overwrite them, if they are only set through the cgroup filesystem.
+func systemdResourceProperties(resources *specs.LinuxResources) []systemdDbus.Property {
+	var properties []systemdDbus.Property
+	if cpu := resources.CPU; cpu != nil {
+		if cpu.Shares != nil && *cpu.Shares >= 2 {
+			weight := 1 + ((*cpu.Shares-2)*9999)/262142
+			properties = append(properties, newSystemdProperty("CPUWeight", weight))
+		}
+		if cpu.Quota != nil && cpu.Period != nil && *cpu.Period > 0 {
+			// USEC_INFINITY for no limit
+			quotaPerSec := uint64(math.MaxUint64)
+			if *cpu.Quota > 0 {
+				// Systemd supports a granularity of 10ms
+				quotaPerSec = uint64(*cpu.Quota) * 1000000 / *cpu.Period // nolint:gosec
+				if quotaPerSec%10000 != 0 {
+					quotaPerSec = (quotaPerSec/10000 + 1) * 10000
+				}
+			}
+			properties = append(properties, newSystemdProperty("CPUQuotaPerSecUSec", quotaPerSec))
+		}
+	}
+	if resources.Pids != nil && resources.Pids.Limit > 0 {
+		properties = append(properties,
+			newSystemdProperty("TasksAccounting", true),
+			newSystemdProperty("TasksMax", uint64(resources.Pids.Limit)))
+	}
+	return properties
+}
+
+// startSystemdUnit creates a transient systemd unit under slice with the
+// process pid in it and waits for systemd to start it.
+func startSystemdUnit(slice string, unit string, pid int, resources *specs.LinuxResources) error {
+	ctx := context.Background()
+	conn, err := systemdDbus.NewWithContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to systemd: %w", err)
+	}
+	defer conn.Close()
+
+	properties := []systemdDbus.Property{
+		systemdDbus.PropDescription("urunc container " + unit),
+		systemdDbus.PropPids(uint32(pid)), // nolint:gosec
+		newSystemdProperty("DefaultDependencies", false),
+		newSystemdProperty("Delegate", true),
+		newSystemdProperty("CPUAccounting", true),
+		newSystemdProperty("IOAccounting", true),
+	}
+	if strings.HasSuffix(unit, ".slice") {
+		properties = append(properties, systemdDbus.PropWants(slice))
+	} else {
+		properties = append(properties, systemdDbus.PropSlice(slice))
+	}
+	properties = append(properties, systemdResourceProperties(resources)...)
+
+	statusChan := make(chan string, 1)
+	_, err = conn.StartTransientUnitContext(ctx, unit, "replace", properties, statusChan)
+	if err != nil {
+		return fmt.Errorf("failed to start systemd unit %s: %w", unit, err)
+	}
+	select {
+	case status := <-statusChan:
+		if status != "done" {
+			return fmt.Errorf("failed to start systemd unit %s: %s", unit, status)
+		}
+	case <-time.After(systemdUnitTimeout):
+		return fmt.Errorf("timed out waiting for systemd unit %s to start", unit)
+	}
+	return nil
+}
+
+// stopSystemdUnit stops the systemd unit of the container, if it still
+// exists. Systemd removes the scope units on its own, as soon as all their
+// processes exit.
+func stopSystemdUnit(unit string) error {
+	ctx := context.Background()
+	conn, err := systemdDbus.NewWithContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to systemd: %w", err)
+	}
+	defer conn.Close()
+
+	statusChan := make(chan string, 1)
+	_, err = conn.StopUnitContext(ctx, unit, "replace", statusChan)
+	if err != nil {
+		var dbusErr dbus.Error
+		if errors.As(err, &dbusErr) && strings.Contains(dbusErr.Name, "NoSuchUnit") {
+			return nil
+		}
+		return fmt.Errorf("failed to stop systemd unit %s: %w", unit, err)
+	}
+	select {
+	case <-statusChan:
+	case <-time.After(systemdUnitTimeout):
+		return fmt.Errorf("timed out waiting for systemd unit %s to stop", unit)
+	}
+	return nil
+}
+
+// cgroupfsPath returns the absolute path of the cgroup inside the cgroup
+// hierarchy. Relative paths are treated as relative to the root cgroup.
+func cgroupfsPath(cgroupsPath string) string {
+	return filepath.Join("/", cgroupsPath)
+}
+
+// applyCgroup creates the cgroup of the container, applies the resources
+// and moves the process pid in it.
+func applyCgroup(cgroupState CgroupState, containerID string, pid int, resources *specs.LinuxResources) error {
+	switch cgroups.Mode() {
+	case cgroups.Unified:
+		if cgroupState.Systemd {
+			slice, unit, err := systemdUnit(cgroupState.Path, containerID)
+			if err != nil {
+				return err
+			}
+			err = startSystemdUnit(slice, unit, pid, resources)
+			if err != nil {
+				return err
+			}
+			// Systemd does not know all the resources. Set them
+			// through the cgroup filesystem too.
+			group, err := cgroup2.PidGroupPath(pid)
+			if err != nil {
+				return err
+			}
+			manager, err := cgroup2.Load(group)
+			if err != nil {
+				return err
+			}
+			return manager.Update(cgroup2.ToResources(resources))
+		}
+		manager, err := cgroup2.NewManager("/sys/fs/cgroup", cgroupfsPath(cgroupState.Path), cgroup2.ToResources(resources))
+		if err != nil {
+			return err
+		}
+		return manager.AddProc(uint64(pid)) // nolint:gosec
+	case cgroups.Legacy, cgroups.Hybrid:
+		path, opts, err := cgroup1Path(cgroupState, containerID)
+		if err != nil {
+			return err
+		}
+		cgroup, err := cgroup1.New(path, resources, opts...)
+		if err != nil {
+			return err
+		}
+		return cgroup.AddProc(uint64(pid)) // nolint:gosec
+	default:
+		return ErrCgroupsUnavailable
+	}
+}
+
+// deleteCgroup removes the cgroup of the container. The cgroup should not
+// have any processes.
+func deleteCgroup(cgroupState CgroupState, containerID string) error {
+	switch cgroups.Mode() {
+	case cgroups.Unified:
+		if cgroupState.Systemd {
+			_, unit, err := systemdUnit(cgroupState.Path, containerID)
+			if err != nil {
+				return err
+			}
+			return stopSystemdUnit(unit)
+		}
+		manager, err := cgroup2.Load(cgroupfsPath(cgroupState.Path))
+		if err != nil {
+			return err
+		}
+		err = manager.Delete()
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	case cgroups.Legacy, cgroups.Hybrid:
+		path, opts, err := cgroup1Path(cgroupState, containerID)
+		if err != nil {
+			return err
+		}
+		cgroup, err := cgroup1.Load(path, opts...)
+		if errors.Is(err, cgroup1.ErrCgroupDeleted) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return cgroup.Delete()
+	default:
+		return ErrCgroupsUnavailable
+	}
+}
+
+// cgroup1Path returns the path of the cgroup in cgroup v1 and the options
+// to manage it.
+func cgroup1Path(cgroupState CgroupState, containerID string) (cgroup1.Path, []cgroup1.InitOpts, error) {
+	if !cgroupState.Systemd {
+		return cgroup1.StaticPath(cgroupfsPath(cgroupState.Path)), nil, nil
+	}
+	slice, unit, err := systemdUnit(cgroupState.Path, containerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cgroup1.Slice(slice, unit), []cgroup1.InitOpts{cgroup1.WithHierarchy(cgroup1.Systemd)}, nil
+}
+
+// SetupCgroup places the process with the given pid in the cgroup that the
+// spec of the container requests and applies the CPU, pids and block I/O
+// resources of the container to it. Every process that this process spawns
+// later, including the monitor, inherits the cgroup. If rootless is true,
+// permission errors are ignored.
+func (u *Unikontainer) SetupCgroup(pid int, systemd bool, rootless bool) error {
+	if u.Spec.Linux == nil || (u.Spec.Linux.CgroupsPath == "" && !systemd) {
+		uniklog.Debug("no cgroup was requested")
+		return nil
+	}
+	cgroupState := CgroupState{
+		Path:    u.Spec.Linux.CgroupsPath,
+		Systemd: systemd,
+	}
+	resources := monitorResources(u.Spec.Linux.Resources)
+	err := applyCgroup(cgroupState, u.State.ID, pid, resources)
+	if err != nil {
+		if rootless && (errors.Is(err, os.ErrPermission) || errors.Is(err, ErrCgroupsUnavailable)) {
+			uniklog.WithError(err).Warn("ignoring cgroup error in rootless mode")
+			return nil
+		}
+		return fmt.Errorf("failed to setup cgroup %s: %w", cgroupState.Path, err)
+	}
+	u.Runtime.Cgroup = &cgroupState
+	return nil
+}
+
+// removeCgroup removes the cgroup of the container, if urunc created one
+func (u *Unikontainer) removeCgroup() error {
+	if u.Runtime == nil || u.Runtime.Cgroup == nil {
+		return nil
+	}
+	return deleteCgroup(*u.Runtime.Cgroup, u.State.ID)
+}
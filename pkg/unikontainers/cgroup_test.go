@@ -0,0 +1,125 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"testing"
+
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSystemdUnit(t *testing.T) {
+	t.Run("full cgroupsPath", func(t *testing.T) {
+		t.Parallel()
+		slice, unit, err := systemdUnit("kubepods.slice:cri-containerd:abc", "id")
+		assert.NoError(t, err)
+		assert.Equal(t, "kubepods.slice", slice)
+		assert.Equal(t, "cri-containerd-abc.scope", unit)
+	})
+
+	t.Run("empty cgroupsPath", func(t *testing.T) {
+		t.Parallel()
+		slice, unit, err := systemdUnit("", "id")
+		assert.NoError(t, err)
+		assert.Equal(t, defaultSystemdSlice, slice)
+		assert.Equal(t, "urunc-id.scope", unit)
+	})
+
+	t.Run("empty fields use defaults", func(t *testing.T) {
+		t.Parallel()
+		slice, unit, err := systemdUnit("::", "id")
+		assert.NoError(t, err)
+		assert.Equal(t, defaultSystemdSlice, slice)
+		assert.Equal(t, "urunc-id.scope", unit)
+	})
+
+	t.Run("slice as unit", func(t *testing.T) {
+		t.Parallel()
+		slice, unit, err := systemdUnit("machine.slice::test.slice", "id")
+		assert.NoError(t, err)
+		assert.Equal(t, "machine.slice", slice)
+		assert.Equal(t, "test.slice", unit)
+	})
+
+	t.Run("invalid cgroupsPath", func(t *testing.T) {
+		t.Parallel()
+		_, _, err := systemdUnit("/kubepods/abc", "id")
+		assert.Error(t, err)
+	})
+}
+
+func TestMonitorResources(t *testing.T) {
+	t.Run("nil resources", func(t *testing.T) {
+		t.Parallel()
+		res := monitorResources(nil)
+		assert.NotNil(t, res)
+		assert.Nil(t, res.CPU)
+	})
+
+	t.Run("memory and devices are dropped", func(t *testing.T) {
+		t.Parallel()
+		limit := int64(256 * 1024 * 1024)
+		shares := uint64(512)
+		res := monitorResources(&specs.LinuxResources{
+			Memory:  &specs.LinuxMemory{Limit: &limit},
+			Devices: []specs.LinuxDeviceCgroup{{Allow: false, Access: "rwm"}},
+			CPU:     &specs.LinuxCPU{Shares: &shares},
+			Pids:    &specs.LinuxPids{Limit: 10},
+		})
+		assert.Nil(t, res.Memory)
+		assert.Nil(t, res.Devices)
+		assert.Equal(t, &shares, res.CPU.Shares)
+		assert.Equal(t, int64(10), res.Pids.Limit)
+	})
+}
+
+func TestSystemdResourceProperties(t *testing.T) {
+	t.Run("cpu and pids", func(t *testing.T) {
+		t.Parallel()
+		shares := uint64(1024)
+		quota := int64(150000)
+		period := uint64(100000)
+		props := systemdResourceProperties(&specs.LinuxResources{
+			CPU:  &specs.LinuxCPU{Shares: &shares, Quota: &quota, Period: &period},
+			Pids: &specs.LinuxPids{Limit: 32},
+		})
+		values := make(map[string]any)
+		for _, p := range props {
+			values[p.Name] = p.Value.Value()
+		}
+		assert.Equal(t, uint64(39), values["CPUWeight"])
+		assert.Equal(t, uint64(1500000), values["CPUQuotaPerSecUSec"])
+		assert.Equal(t, uint64(32), values["TasksMax"])
+	})
+
+	t.Run("quota is rounded up to 10ms", func(t *testing.T) {
+		t.Parallel()
+		quota := int64(12345)
+		period := uint64(100000)
+		props := systemdResourceProperties(&specs.LinuxResources{
+			CPU: &specs.LinuxCPU{Quota: &quota, Period: &period},
+		})
+		if assert.Len(t, props, 1) {
+			assert.Equal(t, uint64(130000), props[0].Value.Value())
+		}
+	})
+
+	t.Run("no resources", func(t *testing.T) {
+		t.Parallel()
+		props := systemdResourceProperties(&specs.LinuxResources{})
+		assert.Empty(t, props)
+	})
+}
@@ -45,19 +45,71 @@ const (
 	annotBlock         = "com.urunc.unikernel.block"
 	annotBlockMntPoint = "com.urunc.unikernel.blkMntPoint"
 	annotUseDMBlock    = "com.urunc.unikernel.useDMBlock"
+	annotRootfsMode    = "com.urunc.unikernel.rootfsMode"
+	// The compression of the initrd that urunc creates from the rootfs:
+	// none or gzip
+	annotInitrdCompression = "com.urunc.unikernel.initrdCompression"
+)
+
+// The values of annotRootfsMode, which choose how the rootfs of the
+// container reaches the guest, instead of the initrd and block annotations
+// or devmapper.
+const (
+	// The directory of the rootfs gets shared with the guest over 9p or
+	// virtio-fs
+	rootfsModeSharedFS = "shared-fs"
+	// An ext2 image of the rootfs gets attached as a block device
+	rootfsModeBlock = "block-from-rootfs"
+	// A cpio archive of the rootfs gets passed as the initrd
+	rootfsModeInitrd = "initrd-from-rootfs"
+)
+
+// Annotations that configure the runtime behavior of urunc. Contrary to the
+// above, they are not part of the image's urunc configuration and they are
+// read as is from the container's spec.
+const (
+	annotStopTimeout = "com.urunc.unikernel.stopTimeout"
+	annotFCAPISocket = "com.urunc.unikernel.firecrackerApiSocket"
+	annotVCPUs       = "com.urunc.unikernel.vcpus"
+
+	// A comma-separated list of the interfaces of the network namespace
+	// that get a network device in the guest, in the same order
+	annotNetInterfaces = "com.urunc.network.interfaces"
+	// The network mode of the unikernel: dynamic, static or macvtap
+	annotNetworkMode = "com.urunc.network.mode"
+	// The IPv4 subnet (in CIDR notation), the IP of the tap device and the
+	// IP of the unikernel in the static network mode
+	annotStaticSubnet  = "com.urunc.network.static.subnet"
+	annotStaticTapIP   = "com.urunc.network.static.tapIP"
+	annotStaticGuestIP = "com.urunc.network.static.guestIP"
+	// A comma-separated list of the ports of the pod that get forwarded to
+	// the unikernel in the static network mode, as <port>[:<guest port>][/<protocol>]
+	annotPorts = "com.urunc.network.ports"
+	// The bandwidth limits of the network of the unikernel, in the format
+	// of the respective Kubernetes annotations, which they override
+	annotIngressBandwidth = "com.urunc.network.ingressBandwidth"
+	annotEgressBandwidth  = "com.urunc.network.egressBandwidth"
+	// Whether urunc serves the network configuration to the unikernel over
+	// DHCP, overriding the default of the unikernel type
+	annotDHCP = "com.urunc.network.dhcp"
+
+	annotK8sIngressBandwidth = "kubernetes.io/ingress-bandwidth"
+	annotK8sEgressBandwidth  = "kubernetes.io/egress-bandwidth"
 )
 
 // A UnikernelConfig struct holds the info provided by bima image on how to execute our unikernel
 type UnikernelConfig struct {
-	UnikernelType    string `json:"com.urunc.unikernel.unikernelType"`
-	UnikernelVersion string `json:"com.urunc.unikernel.unikernelVersion"`
-	UnikernelCmd     string `json:"com.urunc.unikernel.cmdline,omitempty"`
-	UnikernelBinary  string `json:"com.urunc.unikernel.binary"`
-	Hypervisor       string `json:"com.urunc.unikernel.hypervisor"`
-	Initrd           string `json:"com.urunc.unikernel.initrd,omitempty"`
-	Block            string `json:"com.urunc.unikernel.block,omitempty"`
-	BlkMntPoint      string `json:"com.urunc.unikernel.blkMntPoint,omitempty"`
-	UseDMBlock       string `json:"com.urunc.unikernel.useDMBlock"`
+	UnikernelType     string `json:"com.urunc.unikernel.unikernelType"`
+	UnikernelVersion  string `json:"com.urunc.unikernel.unikernelVersion"`
+	UnikernelCmd      string `json:"com.urunc.unikernel.cmdline,omitempty"`
+	UnikernelBinary   string `json:"com.urunc.unikernel.binary"`
+	Hypervisor        string `json:"com.urunc.unikernel.hypervisor"`
+	Initrd            string `json:"com.urunc.unikernel.initrd,omitempty"`
+	Block             string `json:"com.urunc.unikernel.block,omitempty"`
+	BlkMntPoint       string `json:"com.urunc.unikernel.blkMntPoint,omitempty"`
+	UseDMBlock        string `json:"com.urunc.unikernel.useDMBlock"`
+	RootfsMode        string `json:"com.urunc.unikernel.rootfsMode,omitempty"`
+	InitrdCompression string `json:"com.urunc.unikernel.initrdCompression,omitempty"`
 }
 
 // GetUnikernelConfig tries to get the Unikernel config from the bundle annotations.
@@ -104,16 +156,20 @@ func getConfigFromSpec(spec *specs.Spec) (*UnikernelConfig, error) {
 	block := spec.Annotations[annotBlock]
 	blkMntPoint := spec.Annotations[annotBlockMntPoint]
 	useDMBlock := spec.Annotations[annotUseDMBlock]
+	rootfsMode := spec.Annotations[annotRootfsMode]
+	initrdCompression := spec.Annotations[annotInitrdCompression]
 	uniklog.WithFields(logrus.Fields{
-		"unikernelType":    tryDecode(unikernelType),
-		"unikernelVersion": tryDecode(unikernelVersion),
-		"unikernelCmd":     tryDecode(unikernelCmd),
-		"unikernelBinary":  tryDecode(unikernelBinary),
-		"hypervisor":       tryDecode(hypervisor),
-		"initrd":           tryDecode(initrd),
-		"block":            tryDecode(block),
-		"blkMntPoint":      tryDecode(blkMntPoint),
-		"useDMBlock":       tryDecode(useDMBlock),
+		"unikernelType":     tryDecode(unikernelType),
+		"unikernelVersion":  tryDecode(unikernelVersion),
+		"unikernelCmd":      tryDecode(unikernelCmd),
+		"unikernelBinary":   tryDecode(unikernelBinary),
+		"hypervisor":        tryDecode(hypervisor),
+		"initrd":            tryDecode(initrd),
+		"block":             tryDecode(block),
+		"blkMntPoint":       tryDecode(blkMntPoint),
+		"useDMBlock":        tryDecode(useDMBlock),
+		"rootfsMode":        tryDecode(rootfsMode),
+		"initrdCompression": tryDecode(initrdCompression),
 	}).WithField("source", "spec").Debug("urunc annotations")
 
 	// TODO: We need to use a better check to see if annotations were empty
@@ -122,15 +178,17 @@ func getConfigFromSpec(spec *specs.Spec) (*UnikernelConfig, error) {
 		return nil, ErrEmptyAnnotations
 	}
 	return &UnikernelConfig{
-		UnikernelBinary:  unikernelBinary,
-		UnikernelVersion: unikernelVersion,
-		UnikernelType:    unikernelType,
-		UnikernelCmd:     unikernelCmd,
-		Hypervisor:       hypervisor,
-		Initrd:           initrd,
-		Block:            block,
-		BlkMntPoint:      blkMntPoint,
-		UseDMBlock:       useDMBlock,
+		UnikernelBinary:   unikernelBinary,
+		UnikernelVersion:  unikernelVersion,
+		UnikernelType:     unikernelType,
+		UnikernelCmd:      unikernelCmd,
+		Hypervisor:        hypervisor,
+		Initrd:            initrd,
+		Block:             block,
+		BlkMntPoint:       blkMntPoint,
+		UseDMBlock:        useDMBlock,
+		RootfsMode:        rootfsMode,
+		InitrdCompression: initrdCompression,
 	}, nil
 }
 
@@ -161,15 +219,17 @@ func getConfigFromJSON(jsonFilePath string) (*UnikernelConfig, error) {
 		return nil, err
 	}
 	uniklog.WithFields(logrus.Fields{
-		"unikernelType":    tryDecode(conf.UnikernelType),
-		"unikernelVersion": tryDecode(conf.UnikernelVersion),
-		"unikernelCmd":     tryDecode(conf.UnikernelCmd),
-		"unikernelBinary":  tryDecode(conf.UnikernelBinary),
-		"hypervisor":       tryDecode(conf.Hypervisor),
-		"initrd":           tryDecode(conf.Initrd),
-		"block":            tryDecode(conf.Block),
-		"blkMntPoint":      tryDecode(conf.BlkMntPoint),
-		"useDMBlock":       tryDecode(conf.UseDMBlock),
+		"unikernelType":     tryDecode(conf.UnikernelType),
+		"unikernelVersion":  tryDecode(conf.UnikernelVersion),
+		"unikernelCmd":      tryDecode(conf.UnikernelCmd),
+		"unikernelBinary":   tryDecode(conf.UnikernelBinary),
+		"hypervisor":        tryDecode(conf.Hypervisor),
+		"initrd":            tryDecode(conf.Initrd),
+		"block":             tryDecode(conf.Block),
+		"blkMntPoint":       tryDecode(conf.BlkMntPoint),
+		"useDMBlock":        tryDecode(conf.UseDMBlock),
+		"rootfsMode":        tryDecode(conf.RootfsMode),
+		"initrdCompression": tryDecode(conf.InitrdCompression),
 	}).WithField("source", uruncJSONFilename).Debug("urunc annotations")
 
 	return &conf, nil
@@ -240,6 +300,18 @@ func (c *UnikernelConfig) decode() error {
 	}
 	c.UseDMBlock = string(decoded)
 
+	decoded, err = base64.StdEncoding.DecodeString(c.RootfsMode)
+	if err != nil {
+		return fmt.Errorf("failed to decode RootfsMode: %v", err)
+	}
+	c.RootfsMode = string(decoded)
+
+	decoded, err = base64.StdEncoding.DecodeString(c.InitrdCompression)
+	if err != nil {
+		return fmt.Errorf("failed to decode InitrdCompression: %v", err)
+	}
+	c.InitrdCompression = string(decoded)
+
 	return nil
 }
 
@@ -270,6 +342,12 @@ func (c *UnikernelConfig) Map() map[string]string {
 	if c.BlkMntPoint != "" {
 		myMap[annotBlockMntPoint] = c.BlkMntPoint
 	}
+	if c.RootfsMode != "" {
+		myMap[annotRootfsMode] = c.RootfsMode
+	}
+	if c.InitrdCompression != "" {
+		myMap[annotInitrdCompression] = c.InitrdCompression
+	}
 	if c.UseDMBlock != "" {
 		myMap[annotUseDMBlock] = c.UseDMBlock
 	} else {
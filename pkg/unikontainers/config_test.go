@@ -30,26 +30,30 @@ func TestGetConfigFromSpec(t *testing.T) {
 		t.Parallel()
 		spec := &specs.Spec{
 			Annotations: map[string]string{
-				annotType:          "type1",
-				annotCmdLine:       "cmd1",
-				annotBinary:        "binary1",
-				annotHypervisor:    "hypervisor1",
-				annotInitrd:        "initrd1",
-				annotBlock:         "block1",
-				annotBlockMntPoint: "point1",
-				annotUseDMBlock:    "true",
+				annotType:              "type1",
+				annotCmdLine:           "cmd1",
+				annotBinary:            "binary1",
+				annotHypervisor:        "hypervisor1",
+				annotInitrd:            "initrd1",
+				annotBlock:             "block1",
+				annotBlockMntPoint:     "point1",
+				annotUseDMBlock:        "true",
+				annotRootfsMode:        "mode1",
+				annotInitrdCompression: "gzip",
 			},
 		}
 
 		expectedConfig := &UnikernelConfig{
-			UnikernelBinary: "binary1",
-			UnikernelType:   "type1",
-			UnikernelCmd:    "cmd1",
-			Hypervisor:      "hypervisor1",
-			Initrd:          "initrd1",
-			Block:           "block1",
-			BlkMntPoint:     "point1",
-			UseDMBlock:      "true",
+			UnikernelBinary:   "binary1",
+			UnikernelType:     "type1",
+			UnikernelCmd:      "cmd1",
+			Hypervisor:        "hypervisor1",
+			Initrd:            "initrd1",
+			Block:             "block1",
+			BlkMntPoint:       "point1",
+			UseDMBlock:        "true",
+			RootfsMode:        "mode1",
+			InitrdCompression: "gzip",
 		}
 
 		config, err := getConfigFromSpec(spec)
@@ -95,14 +99,16 @@ func TestGetConfigFromJSON(t *testing.T) {
 
 		// Create a valid urunc.json file
 		expectedConfig := &UnikernelConfig{
-			UnikernelBinary: "binary1",
-			UnikernelType:   "type1",
-			UnikernelCmd:    "cmd1",
-			Hypervisor:      "hypervisor1",
-			Initrd:          "initrd1",
-			Block:           "block1",
-			BlkMntPoint:     "point1",
-			UseDMBlock:      "true",
+			UnikernelBinary:   "binary1",
+			UnikernelType:     "type1",
+			UnikernelCmd:      "cmd1",
+			Hypervisor:        "hypervisor1",
+			Initrd:            "initrd1",
+			Block:             "block1",
+			BlkMntPoint:       "point1",
+			UseDMBlock:        "true",
+			RootfsMode:        "mode1",
+			InitrdCompression: "gzip",
 		}
 		configData, err := json.Marshal(expectedConfig)
 		assert.NoError(t, err)
@@ -183,13 +189,17 @@ func TestDecode(t *testing.T) {
 		encodedType := base64.StdEncoding.EncodeToString([]byte("testType"))
 		encodedBinary := base64.StdEncoding.EncodeToString([]byte("testBinary"))
 		encodedInitrd := base64.StdEncoding.EncodeToString([]byte("testInitrd"))
+		encodedRootfsMode := base64.StdEncoding.EncodeToString([]byte("testRootfsMode"))
+		encodedCompression := base64.StdEncoding.EncodeToString([]byte("testCompression"))
 
 		config := &UnikernelConfig{
-			UnikernelCmd:    encodedCmd,
-			Hypervisor:      encodedHypervisor,
-			UnikernelType:   encodedType,
-			UnikernelBinary: encodedBinary,
-			Initrd:          encodedInitrd,
+			UnikernelCmd:      encodedCmd,
+			Hypervisor:        encodedHypervisor,
+			UnikernelType:     encodedType,
+			UnikernelBinary:   encodedBinary,
+			Initrd:            encodedInitrd,
+			RootfsMode:        encodedRootfsMode,
+			InitrdCompression: encodedCompression,
 		}
 
 		// Call the decode method
@@ -202,6 +212,8 @@ func TestDecode(t *testing.T) {
 		assert.Equal(t, "testType", config.UnikernelType)
 		assert.Equal(t, "testBinary", config.UnikernelBinary)
 		assert.Equal(t, "testInitrd", config.Initrd)
+		assert.Equal(t, "testRootfsMode", config.RootfsMode)
+		assert.Equal(t, "testCompression", config.InitrdCompression)
 	})
 
 	t.Run("decode invalid base64", func(t *testing.T) {
@@ -228,24 +240,28 @@ func TestMap(t *testing.T) {
 	t.Run("unikernelConfig map success", func(t *testing.T) {
 		t.Parallel()
 		config := &UnikernelConfig{
-			UnikernelBinary: "binary_value",
-			UnikernelType:   "type_value",
-			UnikernelCmd:    "cmd_value",
-			Hypervisor:      "hypervisor_value",
-			Initrd:          "initrd_value",
-			Block:           "block_value",
-			BlkMntPoint:     "point_value",
-			UseDMBlock:      "false",
+			UnikernelBinary:   "binary_value",
+			UnikernelType:     "type_value",
+			UnikernelCmd:      "cmd_value",
+			Hypervisor:        "hypervisor_value",
+			Initrd:            "initrd_value",
+			Block:             "block_value",
+			BlkMntPoint:       "point_value",
+			UseDMBlock:        "false",
+			RootfsMode:        "mode_value",
+			InitrdCompression: "compression_value",
 		}
 		expectedMap := map[string]string{
-			annotCmdLine:       "cmd_value",
-			annotType:          "type_value",
-			annotHypervisor:    "hypervisor_value",
-			annotBinary:        "binary_value",
-			annotInitrd:        "initrd_value",
-			annotBlock:         "block_value",
-			annotBlockMntPoint: "point_value",
-			annotUseDMBlock:    "false",
+			annotCmdLine:           "cmd_value",
+			annotType:              "type_value",
+			annotHypervisor:        "hypervisor_value",
+			annotBinary:            "binary_value",
+			annotInitrd:            "initrd_value",
+			annotBlock:             "block_value",
+			annotBlockMntPoint:     "point_value",
+			annotUseDMBlock:        "false",
+			annotRootfsMode:        "mode_value",
+			annotInitrdCompression: "compression_value",
 		}
 		resultMap := config.Map()
 		assert.Equal(t, expectedMap, resultMap)
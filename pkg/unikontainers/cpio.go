@@ -0,0 +1,298 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	cpioNewcMagic   = "070701"
+	cpioTrailerName = "TRAILER!!!"
+
+	// The compressions of the initrd of the rootfs
+	initrdCompressionNone = "none"
+	initrdCompressionGzip = "gzip"
+
+	// The path of the initrd of the rootfs in the rootfs of the monitor
+	monitorRootfsInitrd = "/.urunc/initrd.cpio"
+)
+
+// The modes of the entries of a cpio archive, as in struct stat
+const (
+	cpioModeDir     = 0o040000
+	cpioModeRegular = 0o100000
+	cpioModeSymlink = 0o120000
+	cpioModeChar    = 0o020000
+	cpioModeBlock   = 0o060000
+	cpioModeFIFO    = 0o010000
+	cpioModeSocket  = 0o140000
+)
+
+// cpioWriter writes a cpio archive in the newc format, which the initramfs
+// of Linux and the initrd of Unikraft expect.
+type cpioWriter struct {
+	w       io.Writer
+	written int64
+	ino     uint32
+}
+
+// cpioHeader holds the fields of the header of an entry that vary
+type cpioHeader struct {
+	mode      uint32
+	uid       uint32
+	gid       uint32
+	mtime     int64
+	size      int64
+	rdevMajor uint32
+	rdevMinor uint32
+}
+
+func (c *cpioWriter) write(data []byte) error {
+	n, err := c.w.Write(data)
+	c.written += int64(n)
+	return err
+}
+
+// pad aligns the archive to 4 bytes, as newc requires after the name and
+// after the data of every entry
+func (c *cpioWriter) pad() error {
+	if c.written%4 == 0 {
+		return nil
+	}
+	return c.write(make([]byte, 4-c.written%4))
+}
+
+// writeHeader writes the header and the name of an entry
+func (c *cpioWriter) writeHeader(name string, hdr cpioHeader) error {
+	if hdr.size > math.MaxUint32 {
+		return fmt.Errorf("%s is too large for a cpio archive", name)
+	}
+	mtime := hdr.mtime
+	if mtime < 0 || mtime > math.MaxUint32 {
+		mtime = 0
+	}
+	c.ino++
+	header := fmt.Sprintf("%s%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x",
+		cpioNewcMagic, c.ino, hdr.mode, hdr.uid, hdr.gid, 1, mtime, hdr.size,
+		0, 0, hdr.rdevMajor, hdr.rdevMinor, len(name)+1, 0)
+	err := c.write([]byte(header + name + "\x00"))
+	if err != nil {
+		return err
+	}
+	return c.pad()
+}
+
+// writeEntry writes an entry with the content of data
+func (c *cpioWriter) writeEntry(name string, hdr cpioHeader, data io.Reader) error {
+	err := c.writeHeader(name, hdr)
+	if err != nil {
+		return err
+	}
+	if hdr.size == 0 {
+		return nil
+	}
+	n, err := io.Copy(c.w, io.LimitReader(data, hdr.size))
+	c.written += n
+	if err != nil {
+		return err
+	}
+	if n != hdr.size {
+		return fmt.Errorf("%s changed while it was archived", name)
+	}
+	return c.pad()
+}
+
+// close writes the trailer of the archive
+func (c *cpioWriter) close() error {
+	return c.writeEntry(cpioTrailerName, cpioHeader{}, nil)
+}
+
+// cpioMode returns the mode of a file, as in struct stat
+func cpioMode(mode fs.FileMode) (uint32, bool) {
+	perm := uint32(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		perm |= 0o4000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		perm |= 0o2000
+	}
+	if mode&fs.ModeSticky != 0 {
+		perm |= 0o1000
+	}
+	switch {
+	case mode.IsRegular():
+		return cpioModeRegular | perm, true
+	case mode.IsDir():
+		return cpioModeDir | perm, true
+	case mode&fs.ModeSymlink != 0:
+		return cpioModeSymlink | perm, true
+	case mode&fs.ModeCharDevice != 0:
+		return cpioModeChar | perm, true
+	case mode&fs.ModeDevice != 0:
+		return cpioModeBlock | perm, true
+	case mode&fs.ModeNamedPipe != 0:
+		return cpioModeFIFO | perm, true
+	case mode&fs.ModeSocket != 0:
+		return cpioModeSocket | perm, true
+	default:
+		return 0, false
+	}
+}
+
+// writeCPIO writes the tree of dir to w as a newc cpio archive, without the
+// files in exclude, which are relative to dir. Hard links get archived as
+// separate files.
+func writeCPIO(w io.Writer, dir string, exclude []string) error {
+	archive := &cpioWriter{w: w}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			return nil
+		}
+		if slices.Contains(exclude, name) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		mode, ok := cpioMode(info.Mode())
+		if !ok {
+			uniklog.WithField("file", path).Warn("ignoring file of unknown type")
+			return nil
+		}
+		hdr := cpioHeader{mode: mode, mtime: info.ModTime().Unix()}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			hdr.uid = stat.Uid
+			hdr.gid = stat.Gid
+			if info.Mode()&fs.ModeDevice != 0 {
+				hdr.rdevMajor = unix.Major(stat.Rdev)
+				hdr.rdevMinor = unix.Minor(stat.Rdev)
+			}
+		}
+		switch {
+		case info.Mode().IsRegular():
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			hdr.size = info.Size()
+			return archive.writeEntry(name, hdr, file)
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			hdr.size = int64(len(target))
+			return archive.writeEntry(name, hdr, strings.NewReader(target))
+		default:
+			return archive.writeHeader(name, hdr)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to archive %s: %w", dir, err)
+	}
+	return archive.close()
+}
+
+// buildInitrd creates a cpio archive at initrd with the tree of srcDir,
+// without the files in exclude, compressed according to compression.
+func buildInitrd(srcDir string, initrd string, exclude []string, compression string) error {
+	// The monitor might not run as root
+	file, err := os.OpenFile(initrd, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", initrd, err)
+	}
+	defer file.Close()
+	buffered := bufio.NewWriter(file)
+	var w io.Writer = buffered
+	var gz *gzip.Writer
+	if compression == initrdCompressionGzip {
+		gz = gzip.NewWriter(buffered)
+		w = gz
+	}
+	err = writeCPIO(w, srcDir, exclude)
+	if err != nil {
+		return err
+	}
+	if gz != nil {
+		err = gz.Close()
+		if err != nil {
+			return fmt.Errorf("failed to compress %s: %w", initrd, err)
+		}
+	}
+	err = buffered.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", initrd, err)
+	}
+	return file.Close()
+}
+
+// rootfsInitrd returns the path of the cached initrd of the rootfs of the
+// container, without the unikernel binary and the urunc.json file. The initrd
+// gets created, if it is not cached. The key of the cache covers the digest of
+// the rootfs, the excluded files and the compression.
+func rootfsInitrd(rootfsDir string, unikernelPath string, compression string) (string, error) {
+	switch compression {
+	case "", initrdCompressionNone:
+		compression = initrdCompressionNone
+	case initrdCompressionGzip:
+	default:
+		return "", fmt.Errorf("invalid %s annotation %q", annotInitrdCompression, compression)
+	}
+	exclude := []string{uruncJSONFilename}
+	if unikernelPath != "" {
+		exclude = append(exclude, filepath.Clean(filepath.Join(".", unikernelPath)))
+	}
+	digest, err := rootfsDigest(rootfsDir)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	_, _ = fmt.Fprintf(hash, "%s\x00%s\x00%q", digest, compression, exclude)
+	key := hex.EncodeToString(hash.Sum(nil))
+	ext := ".cpio"
+	if compression == initrdCompressionGzip {
+		ext += ".gz"
+	}
+	return cachedImage(rootfsCacheDir, key, ext, func(path string) error {
+		return buildInitrd(rootfsDir, path, exclude, compression)
+	})
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// cpioEntry is an entry of a newc cpio archive, as parsed by readCPIO
+type cpioEntry struct {
+	mode uint64
+	data string
+}
+
+// readCPIO parses a newc cpio archive, until its trailer
+func readCPIO(t *testing.T, archive []byte) map[string]cpioEntry {
+	entries := make(map[string]cpioEntry)
+	offset := 0
+	align := func(n int) int {
+		return (n + 3) &^ 3
+	}
+	for {
+		if offset+110 > len(archive) || string(archive[offset:offset+6]) != cpioNewcMagic {
+			t.Fatalf("invalid header at offset %d", offset)
+		}
+		field := func(i int) uint64 {
+			value, err := strconv.ParseUint(string(archive[offset+6+8*i:offset+14+8*i]), 16, 32)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return value
+		}
+		mode, size, nameSize := field(1), int(field(6)), int(field(11))
+		name := string(archive[offset+110 : offset+110+nameSize-1])
+		dataStart := align(offset + 110 + nameSize)
+		if name == cpioTrailerName {
+			return entries
+		}
+		entries[name] = cpioEntry{mode: mode, data: string(archive[dataStart : dataStart+size])}
+		offset = align(dataStart + size)
+	}
+}
+
+func TestWriteCPIO(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"unikernel/app": "binary",
+		"urunc.json":    "{}",
+		"etc/config":    "config",
+		"empty":         "",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("etc/config", filepath.Join(dir, "config")); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	err := writeCPIO(&archive, dir, []string{"urunc.json", "unikernel/app"})
+	assert.NoError(t, err)
+	assert.Zero(t, archive.Len()%4)
+
+	entries := readCPIO(t, archive.Bytes())
+	assert.Len(t, entries, 5)
+	assert.Equal(t, cpioEntry{mode: cpioModeRegular | 0o640, data: "config"}, entries["etc/config"])
+	assert.Equal(t, cpioEntry{mode: cpioModeRegular | 0o640}, entries["empty"])
+	assert.Equal(t, cpioEntry{mode: cpioModeSymlink | 0o777, data: "etc/config"}, entries["config"])
+	assert.Equal(t, uint64(cpioModeDir|0o755), entries["etc"].mode)
+	assert.Contains(t, entries, "unikernel")
+	assert.NotContains(t, entries, "unikernel/app")
+	assert.NotContains(t, entries, "urunc.json")
+}
+
+func TestBuildInitrd(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file"), []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("gzip", func(t *testing.T) {
+		t.Parallel()
+		initrd := filepath.Join(t.TempDir(), "initrd.cpio.gz")
+		assert.NoError(t, buildInitrd(dir, initrd, nil, initrdCompressionGzip))
+		file, err := os.Open(initrd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		archive, err := io.ReadAll(gz)
+		assert.NoError(t, err)
+		assert.Equal(t, "data", readCPIO(t, archive)["file"].data)
+	})
+
+	t.Run("invalid compression", func(t *testing.T) {
+		t.Parallel()
+		_, err := rootfsInitrd(dir, "/unikernel/app", "xz")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"syscall"
+
+	"github.com/nubificus/urunc/pkg/unikontainers/hypervisors"
+	"github.com/nubificus/urunc/pkg/unikontainers/unikernels"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// ExitHandler decodes the exit status of the monitor process and records the
+// exit code of the guest in the container state. It is created before the
+// monitor starts, in order to catch any errors early.
+type ExitHandler struct {
+	u       *Unikontainer
+	vmm     hypervisors.VMM
+	ukernel unikernels.Unikernel
+}
+
+// NewExitHandler creates a new ExitHandler for the Unikontainer
+func (u *Unikontainer) NewExitHandler() (*ExitHandler, error) {
+	vmmType := u.State.Annotations[annotHypervisor]
+	vmm, err := hypervisors.NewVMM(hypervisors.VmmType(vmmType))
+	if err != nil {
+		return nil, err
+	}
+	unikernelType := u.State.Annotations[annotType]
+	unikernel, err := unikernels.New(unikernelType)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExitHandler{
+		u:       u,
+		vmm:     vmm,
+		ukernel: unikernel,
+	}, nil
+}
+
+// HandleExit decodes the exit status of the monitor to the exit code of the
+// guest, sets the status of the container as stopped and saves the exit code
+// in state.json. It returns the exit code of the guest.
+func (h *ExitHandler) HandleExit(status syscall.WaitStatus) (int, error) {
+	exitCode := h.vmm.GuestExitCode(status, h.ukernel)
+	uniklog.WithField("id", h.u.State.ID).
+		WithField("monitor status", int(status)).
+		WithField("exit code", exitCode).
+		Debug("monitor exited")
+
+	// Other urunc processes might have updated the state in the meantime.
+	// Make sure we only change the exit related fields.
+	err := h.u.updateState(func(state *specs.State, runtime *RuntimeState) {
+		state.Status = specs.StateStopped
+		runtime.ExitCode = &exitCode
+	})
+	return exitCode, err
+}
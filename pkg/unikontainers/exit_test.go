@@ -0,0 +1,89 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/nubificus/urunc/pkg/unikontainers/hypervisors"
+	"github.com/nubificus/urunc/pkg/unikontainers/unikernels"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestExitHandler(t *testing.T, vmm hypervisors.VMM, unikernelType string) *ExitHandler {
+	t.Helper()
+	baseDir := t.TempDir()
+	u := &Unikontainer{
+		BaseDir: baseDir,
+		State: &specs.State{
+			ID:          "test",
+			Status:      specs.StateRunning,
+			Pid:         1234,
+			Annotations: map[string]string{annotType: unikernelType},
+		},
+		Runtime: &RuntimeState{},
+		Spec:    &specs.Spec{},
+	}
+	err := u.saveContainerState()
+	assert.NoError(t, err)
+
+	ukernel, err := unikernels.New(unikernelType)
+	assert.NoError(t, err)
+
+	return &ExitHandler{u: u, vmm: vmm, ukernel: ukernel}
+}
+
+func TestHandleExit(t *testing.T) {
+	t.Run("qemu isa-debug-exit", func(t *testing.T) {
+		t.Parallel()
+		h := newTestExitHandler(t, &hypervisors.Qemu{}, unikernels.MewzUnikernel)
+		// The guest wrote 1 to isa-debug-exit, hence QEMU exited with 3
+		exitCode, err := h.HandleExit(syscall.WaitStatus(3 << 8))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, exitCode)
+
+		state, err := loadUnikontainerState(filepath.Join(h.u.BaseDir, stateFilename))
+		assert.NoError(t, err)
+		assert.Equal(t, specs.StateStopped, state.Status)
+		assert.Equal(t, 1234, state.Pid)
+		if assert.NotNil(t, state.Runtime.ExitCode) {
+			assert.Equal(t, 1, *state.Runtime.ExitCode)
+		}
+	})
+	t.Run("qemu failed to start", func(t *testing.T) {
+		t.Parallel()
+		h := newTestExitHandler(t, &hypervisors.Qemu{}, unikernels.MewzUnikernel)
+		exitCode, err := h.HandleExit(syscall.WaitStatus(1 << 8))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, exitCode)
+	})
+	t.Run("qemu without isa-debug-exit", func(t *testing.T) {
+		t.Parallel()
+		h := newTestExitHandler(t, &hypervisors.Qemu{}, unikernels.LinuxUnikernel)
+		exitCode, err := h.HandleExit(syscall.WaitStatus(3 << 8))
+		assert.NoError(t, err)
+		assert.Equal(t, 3, exitCode)
+	})
+	t.Run("solo5 killed by signal", func(t *testing.T) {
+		t.Parallel()
+		h := newTestExitHandler(t, &hypervisors.HVT{}, unikernels.RumprunUnikernel)
+		exitCode, err := h.HandleExit(syscall.WaitStatus(syscall.SIGKILL))
+		assert.NoError(t, err)
+		assert.Equal(t, 128+int(syscall.SIGKILL), exitCode)
+	})
+}
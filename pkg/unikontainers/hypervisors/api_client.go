@@ -0,0 +1,106 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hypervisors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nubificus/urunc/internal/unixsock"
+)
+
+// apiClient is a client for the REST APIs that VMMs serve over a unix socket
+type apiClient struct {
+	client *http.Client
+}
+
+// apiFault is the JSON body that some VMMs reply with, when a request fails
+type apiFault struct {
+	FaultMessage string `json:"fault_message"`
+}
+
+func newAPIClient(socketPath string, timeout time.Duration) *apiClient {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return unixsock.DialContext(ctx, socketPath)
+		},
+	}
+	return &apiClient{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+		},
+	}
+}
+
+// checkAPISocket returns notSupported if the API socket does not exist,
+// meaning that the VMM was started without an API.
+func checkAPISocket(socketPath string, notSupported error) error {
+	_, err := os.Stat(socketPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return notSupported
+	}
+	return err
+}
+
+// do sends a request to the API of the VMM. If out is not nil, the reply
+// is decoded in it.
+func (c *apiClient) do(method string, path string, in any, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, "http://localhost"+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		data, _ := io.ReadAll(resp.Body)
+		message := strings.TrimSpace(string(data))
+		var fault apiFault
+		if json.Unmarshal(data, &fault) == nil && fault.FaultMessage != "" {
+			message = fault.FaultMessage
+		}
+		return fmt.Errorf("%s %s failed with %d: %s", method, path, resp.StatusCode, message)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hypervisors
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/nubificus/urunc/internal/unixsock"
+)
+
+// apiRequest is a request received by the stand-in API server
+type apiRequest struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+// fakeAPIServer is a stand-in for the REST API server of a VMM, which
+// records every request it receives. The replies are written by reply,
+// while the server holds its lock.
+type fakeAPIServer struct {
+	mu       sync.Mutex
+	requests []apiRequest
+	reply    func(w http.ResponseWriter, req apiRequest)
+}
+
+func newFakeAPIServer(t *testing.T, socketPath string, reply func(w http.ResponseWriter, req apiRequest)) *fakeAPIServer {
+	t.Helper()
+	listener, err := unixsock.Listen(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeAPIServer{reply: reply}
+	server := &http.Server{Handler: s} //nolint: gosec
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(func() { server.Close() })
+	return s
+}
+
+func (s *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	req := apiRequest{Method: r.Method, Path: r.URL.Path, Body: string(body)}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, req)
+	s.reply(w, req)
+}
+
+func (s *fakeAPIServer) received() []apiRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]apiRequest(nil), s.requests...)
+}
@@ -0,0 +1,268 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hypervisors
+
+import (
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nubificus/urunc/pkg/unikontainers/unikernels"
+)
+
+const (
+	CloudHypervisorVmm    VmmType = "cloud-hypervisor"
+	CloudHypervisorBinary string  = "cloud-hypervisor"
+	CHSocketName          string  = "ch.sock" // The name of the API socket inside the control directory
+	chRequestTimeout              = 5 * time.Second
+)
+
+type CloudHypervisor struct {
+	binaryPath string
+	binary     string
+}
+
+// chVMInfo is the reply of the vm.info endpoint
+type chVMInfo struct {
+	State string `json:"state"`
+}
+
+// chClient is a client for the REST API of Cloud Hypervisor
+type chClient struct {
+	*apiClient
+}
+
+// chSocketPath returns the path of the API socket in the control directory
+func chSocketPath(controlDir string) string {
+	return filepath.Join(controlDir, CHSocketName)
+}
+
+// newCHClientFor returns a client for the API socket in the control
+// directory, or notSupported if Cloud Hypervisor was started without it.
+func newCHClientFor(controlDir string, notSupported error) (*chClient, error) {
+	socketPath := chSocketPath(controlDir)
+	err := checkAPISocket(socketPath, notSupported)
+	if err != nil {
+		return nil, err
+	}
+	return &chClient{newAPIClient(socketPath, chRequestTimeout)}, nil
+}
+
+func (c *chClient) put(endpoint string) error {
+	return c.do(http.MethodPut, "/api/v1/"+endpoint, nil, nil)
+}
+
+func (c *chClient) VMInfo() (chVMInfo, error) {
+	var info chVMInfo
+	err := c.do(http.MethodGet, "/api/v1/vm.info", nil, &info)
+	return info, err
+}
+
+// VMCounters returns the counters of every device of the VM. The keys of
+// the map are the device IDs.
+func (c *chClient) VMCounters() (map[string]map[string]uint64, error) {
+	var counters map[string]map[string]uint64
+	err := c.do(http.MethodGet, "/api/v1/vm.counters", nil, &counters)
+	return counters, err
+}
+
+// Stop asks the guest to shut down, by pressing the ACPI power button
+func (ch *CloudHypervisor) Stop(args ControlArgs) error {
+	c, err := newCHClientFor(args.ControlDir, ErrStopNotSupported)
+	if err != nil {
+		return err
+	}
+	return c.put("vm.power-button")
+}
+
+// Pause stops the execution of the guest's vCPUs
+func (ch *CloudHypervisor) Pause(args ControlArgs) error {
+	c, err := newCHClientFor(args.ControlDir, ErrPauseNotSupported)
+	if err != nil {
+		return err
+	}
+	return c.put("vm.pause")
+}
+
+// Resume continues the execution of a paused guest
+func (ch *CloudHypervisor) Resume(args ControlArgs) error {
+	c, err := newCHClientFor(args.ControlDir, ErrPauseNotSupported)
+	if err != nil {
+		return err
+	}
+	return c.put("vm.resume")
+}
+
+// Stats returns the state of the guest and the statistics of its block
+// devices, as reported by the counters of Cloud Hypervisor.
+func (ch *CloudHypervisor) Stats(args ControlArgs) (VMStats, error) {
+	var stats VMStats
+	c, err := newCHClientFor(args.ControlDir, ErrStatsNotSupported)
+	if err != nil {
+		return stats, err
+	}
+	info, err := c.VMInfo()
+	if err != nil {
+		return stats, err
+	}
+	stats.Status = strings.ToLower(info.State)
+	stats.Running = info.State == "Running"
+
+	counters, err := c.VMCounters()
+	if err != nil {
+		return stats, err
+	}
+	for device, counter := range counters {
+		// Only block devices report read_ops
+		if _, ok := counter["read_ops"]; !ok {
+			continue
+		}
+		stats.Blocks = append(stats.Blocks, BlockDeviceStat{
+			Device:     device,
+			ReadBytes:  counter["read_bytes"],
+			WriteBytes: counter["write_bytes"],
+			ReadOps:    counter["read_ops"],
+			WriteOps:   counter["write_ops"],
+		})
+	}
+	sort.Slice(stats.Blocks, func(i, j int) bool {
+		return stats.Blocks[i].Device < stats.Blocks[j].Device
+	})
+	return stats, nil
+}
+
+func (ch *CloudHypervisor) Ok() error {
+	return nil
+}
+
+// UsesKVM returns a bool value depending on if the monitor uses KVM
+func (ch *CloudHypervisor) UsesKVM() bool {
+	return true
+}
+
+func (ch *CloudHypervisor) Path() string {
+	return ch.binaryPath
+}
+
+// GuestExitCode returns the exit status of Cloud Hypervisor. Cloud
+// Hypervisor exits successfully when the guest shuts down and it does not
+// propagate any guest specific exit code.
+func (ch *CloudHypervisor) GuestExitCode(status syscall.WaitStatus, _ unikernels.Unikernel) int {
+	return monitorExitCode(status)
+}
+
+func (ch *CloudHypervisor) Execve(args ExecArgs, ukernel unikernels.Unikernel) error {
+	chString := string(CloudHypervisorVmm)
+	chMem := bytesToStringMB(args.MemSizeB)
+	cmdString := ch.binaryPath + " --memory size=" + chMem + "M"
+	if usesVirtioFS(args.SharedDirs) {
+		cmdString += ",shared=on"
+	}
+	chVCPUs := args.VCPUs
+	if chVCPUs == 0 {
+		chVCPUs = 1
+	}
+	cmdString += " --cpus boot=" + strconv.FormatUint(uint64(chVCPUs), 10)
+	cmdString += " --kernel " + args.UnikernelPath
+	if !args.Seccomp {
+		cmdString += " --seccomp false"
+	}
+	if args.ControlDir != "" {
+		cmdString += " --api-socket path=" + chSocketPath(args.ControlDir)
+	}
+
+	if args.TapDevice != "" {
+		var netcli string
+		if args.TapCharDevice != "" {
+			fd, err := openTapCharDevice(args.TapCharDevice)
+			if err != nil {
+				return err
+			}
+			netcli = " --net fd=" + strconv.Itoa(fd)
+		} else {
+			netcli = ukernel.MonitorNetCli(chString)
+			if netcli == "" {
+				netcli = " --net tap="
+			}
+			netcli += args.TapDevice
+		}
+		netcli = appendNonEmpty(netcli, ",mac=", args.GuestMAC)
+		// Every value after --net describes another device
+		for _, extraNet := range args.ExtraNetworks {
+			if extraNet.CharDevice != "" {
+				fd, err := openTapCharDevice(extraNet.CharDevice)
+				if err != nil {
+					return err
+				}
+				netcli += " fd=" + strconv.Itoa(fd)
+			} else {
+				netcli += " tap=" + extraNet.TapDevice
+			}
+			netcli = appendNonEmpty(netcli, ",mac=", extraNet.GuestMAC)
+		}
+		cmdString += netcli
+	}
+	if args.BlockDevice != "" {
+		blockCli := ukernel.MonitorBlockCli(chString)
+		if blockCli == "" {
+			blockCli = " --disk path="
+		}
+		blockCli += args.BlockDevice
+		cmdString += blockCli
+	}
+	if len(args.Volumes) > 0 {
+		// Every value after --disk describes another device
+		if args.BlockDevice == "" {
+			cmdString += " --disk"
+		}
+		for _, volume := range args.Volumes {
+			cmdString += " path=" + volume.Path
+			if volume.ReadOnly {
+				cmdString += ",readonly=on"
+			}
+		}
+	}
+	// Cloud Hypervisor shares directories only over virtio-fs
+	fsCli := ""
+	for _, dir := range args.SharedDirs {
+		if dir.Socket == "" {
+			vmmLog.WithField("tag", dir.Tag).Warn("cloud-hypervisor does not support 9p, ignoring shared directory")
+			continue
+		}
+		// Every value after --fs describes another device
+		fsCli += " tag=" + dir.Tag + ",socket=" + dir.Socket
+	}
+	if fsCli != "" {
+		cmdString += " --fs" + fsCli
+	}
+	if args.InitrdPath != "" {
+		cmdString += " --initramfs " + args.InitrdPath
+	}
+	cli := ukernel.MonitorCli(chString)
+	if cli == "" {
+		// Use the serial device as the console of the guest
+		cli = " --serial tty --console off"
+	}
+	cmdString += cli
+
+	exArgs := strings.Split(cmdString, " ")
+	exArgs = append(exArgs, "--cmdline", args.Command)
+	vmmLog.WithField("cloud-hypervisor command", exArgs).Debug("Ready to execve cloud-hypervisor")
+	return syscall.Exec(ch.Path(), exArgs, args.Environment) //nolint: gosec
+}
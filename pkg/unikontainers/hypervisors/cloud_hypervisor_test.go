@@ -0,0 +1,89 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hypervisors
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newFakeCHServer starts a stand-in for the API server of Cloud Hypervisor,
+// which replies with the given bodies and records the requests.
+func newFakeCHServer(t *testing.T, replies map[string]string) (*fakeAPIServer, string) {
+	t.Helper()
+	controlDir := newControlDir(t)
+	server := newFakeAPIServer(t, chSocketPath(controlDir), func(w http.ResponseWriter, req apiRequest) {
+		reply, ok := replies[req.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		_, _ = w.Write([]byte(reply))
+	})
+	return server, controlDir
+}
+
+func TestCloudHypervisorControl(t *testing.T) {
+	tests := []struct {
+		name    string
+		control func(ch *CloudHypervisor, args ControlArgs) error
+		request apiRequest
+	}{
+		{"stop", (*CloudHypervisor).Stop, apiRequest{http.MethodPut, "/api/v1/vm.power-button", ""}},
+		{"pause", (*CloudHypervisor).Pause, apiRequest{http.MethodPut, "/api/v1/vm.pause", ""}},
+		{"resume", (*CloudHypervisor).Resume, apiRequest{http.MethodPut, "/api/v1/vm.resume", ""}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			server, controlDir := newFakeCHServer(t, nil)
+			err := tc.control(&CloudHypervisor{}, ControlArgs{ControlDir: controlDir})
+			assert.NoError(t, err)
+			assert.Equal(t, []apiRequest{tc.request}, server.received())
+		})
+	}
+	t.Run("without api socket", func(t *testing.T) {
+		t.Parallel()
+		ch := &CloudHypervisor{}
+		err := ch.Stop(ControlArgs{ControlDir: t.TempDir()})
+		assert.ErrorIs(t, err, ErrStopNotSupported)
+	})
+}
+
+func TestCloudHypervisorStats(t *testing.T) {
+	t.Parallel()
+	_, controlDir := newFakeCHServer(t, map[string]string{
+		"/api/v1/vm.info": `{"state": "Running", "config": {}}`,
+		"/api/v1/vm.counters": `{
+			"_disk0": {"read_bytes": 10, "write_bytes": 20, "read_ops": 1, "write_ops": 2},
+			"_net1": {"rx_bytes": 100, "tx_bytes": 200, "rx_frames": 3, "tx_frames": 4}
+		}`,
+	})
+	stats, err := (&CloudHypervisor{}).Stats(ControlArgs{ControlDir: controlDir})
+	assert.NoError(t, err)
+	assert.Equal(t, VMStats{
+		Status:  "running",
+		Running: true,
+		Blocks: []BlockDeviceStat{{
+			Device:     "_disk0",
+			ReadBytes:  10,
+			WriteBytes: 20,
+			ReadOps:    1,
+			WriteOps:   2,
+		}},
+	}, stats)
+}
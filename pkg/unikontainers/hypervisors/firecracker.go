@@ -23,6 +23,7 @@ import (
 	"strings"
 	"syscall"
 
+	"github.com/nubificus/urunc/internal/fsutil"
 	"github.com/nubificus/urunc/pkg/unikontainers/unikernels"
 )
 
@@ -30,6 +31,8 @@ const (
 	FirecrackerVmm    VmmType = "firecracker"
 	FirecrackerBinary string  = "firecracker"
 	FCJsonFilename    string  = "fc.json"
+	// Firecracker rejects machine configurations with more vCPUs
+	firecrackerMaxVCPUs = 32
 )
 
 type Firecracker struct {
@@ -70,10 +73,6 @@ type FirecrackerConfig struct {
 	NetIfs  []FirecrackerNet      `json:"network-interfaces"`
 }
 
-func (fc *Firecracker) Stop(_ string) error {
-	return nil
-}
-
 func (fc *Firecracker) Ok() error {
 	return nil
 }
@@ -86,6 +85,14 @@ func (fc *Firecracker) Path() string {
 	return fc.binaryPath
 }
 
+// GuestExitCode returns the exit status of Firecracker. Firecracker exits
+// successfully when the guest shuts down or reboots and it does not propagate
+// any guest specific exit code. Any other exit code refers to a Firecracker
+// error.
+func (fc *Firecracker) GuestExitCode(status syscall.WaitStatus, _ unikernels.Unikernel) int {
+	return monitorExitCode(status)
+}
+
 func (fc *Firecracker) Execve(args ExecArgs, _ unikernels.Unikernel) error {
 	// FIXME: Note for getting unikernel specific options.
 	// Due to the way FC operates, we have not encountered any guest specific
@@ -93,13 +100,73 @@ func (fc *Firecracker) Execve(args ExecArgs, _ unikernels.Unikernel) error {
 	// options in FC, since the string return value of the Monitor related
 	// functions in the unikernel interface do not integrate well with FC's
 	// json configuration.
-	cmdString := fc.Path() + " --no-api --config-file "
-	JSONConfigFile := filepath.Join("/tmp/", FCJsonFilename)
-	cmdString += JSONConfigFile
+	FCConfig := fc.buildConfig(args)
+
+	var cmdString string
+	if args.APISocket && args.ControlDir != "" {
+		// The VM gets configured and started through the API by
+		// the urunc process that supervises Firecracker.
+		err := saveAPIConfig(args.ControlDir, FCConfig)
+		if err != nil {
+			return err
+		}
+		cmdString = fc.Path() + " --api-sock " + fcSocketPath(args.ControlDir)
+	} else {
+		JSONConfigFile, err := saveConfigFile(args.ControlDir, FCConfig)
+		if err != nil {
+			return err
+		}
+		cmdString = fc.Path() + " --no-api --config-file " + JSONConfigFile
+	}
 	if !args.Seccomp {
 		cmdString += " --no-seccomp"
 	}
 
+	exArgs := strings.Split(cmdString, " ")
+	vmmLog.WithField("Firecracker command", exArgs).Debug("Ready to execve Firecracker")
+
+	return syscall.Exec(fc.Path(), exArgs, args.Environment) //nolint: gosec
+}
+
+// saveConfigFile writes the configuration of the VM in the control directory
+// of the container and returns its path. The control directory lives in the
+// directory of the container on the host, hence the file remains available
+// for debugging until the container gets deleted. If there is no control
+// directory, the file is written in /tmp of the monitor's rootfs.
+func saveConfigFile(controlDir string, config *FirecrackerConfig) (string, error) {
+	if controlDir == "" {
+		controlDir = "/tmp"
+	}
+	JSONConfigFile := filepath.Join(controlDir, FCJsonFilename)
+	FCConfigJSON, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	err = fsutil.WriteFileAtomic(JSONConfigFile, FCConfigJSON, 0o644)
+	if err != nil {
+		return "", fmt.Errorf("failed to save Firecracker json config: %w", err)
+	}
+	vmmLog.WithField("Json", string(FCConfigJSON)).
+		WithField("path", JSONConfigFile).
+		Debug("Firecracker json config")
+	return JSONConfigFile, nil
+}
+
+// ConfigFile returns the path of the configuration that Execve generated in
+// the control directory, either for the config file or for the API mode.
+func (fc *Firecracker) ConfigFile(args ControlArgs) string {
+	for _, name := range []string{FCJsonFilename, fcAPIConfigFilename} {
+		path := filepath.Join(args.ControlDir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// buildConfig creates the configuration of the VM, either for the config
+// file or for the API of Firecracker.
+func (fc *Firecracker) buildConfig(args ExecArgs) *FirecrackerConfig {
 	// VM config for Firecracker
 	fcMem := DefaultMemory
 	if args.MemSizeB != 0 {
@@ -109,8 +176,12 @@ func (fc *Firecracker) Execve(args ExecArgs, _ unikernels.Unikernel) error {
 			fcMem = DefaultMemory
 		}
 	}
+	fcVCPUs := args.VCPUs
+	if fcVCPUs == 0 {
+		fcVCPUs = 1
+	}
 	FCMachine := FirecrackerMachine{
-		VcpuCount:       1, // TODO: Use value from configuration or Environment variable
+		VcpuCount:       fcVCPUs,
 		MemSizeMiB:      fcMem,
 		Smt:             false,
 		TrackDirtyPages: false,
@@ -123,7 +194,17 @@ func (fc *Firecracker) Execve(args ExecArgs, _ unikernels.Unikernel) error {
 		GuestMAC: args.GuestMAC,
 		HostIF:   args.TapDevice,
 	}
-	FCNet = append(FCNet, AnIF)
+	// The API rejects network interfaces without a host device
+	if AnIF.HostIF != "" || !args.APISocket {
+		FCNet = append(FCNet, AnIF)
+	}
+	for i, extraNet := range args.ExtraNetworks {
+		FCNet = append(FCNet, FirecrackerNet{
+			IfaceID:  fmt.Sprintf("net%d", i+2),
+			GuestMAC: extraNet.GuestMAC,
+			HostIF:   extraNet.TapDevice,
+		})
+	}
 
 	// Block config for Firecracker
 	// TODO: Add support for block devices in FIrecracker
@@ -138,6 +219,13 @@ func (fc *Firecracker) Execve(args ExecArgs, _ unikernels.Unikernel) error {
 		}
 		FCDrives = append(FCDrives, aBlock)
 	}
+	for i, volume := range args.Volumes {
+		FCDrives = append(FCDrives, FirecrackerDrive{
+			DriveID:  fmt.Sprintf("vol%d", i),
+			IsRO:     volume.ReadOnly,
+			HostPath: volume.Path,
+		})
+	}
 	// TODO: Check if this check causes any performance drop
 	// or explore alternative implementations
 	if runtime.GOARCH == "arm64" {
@@ -150,20 +238,10 @@ func (fc *Firecracker) Execve(args ExecArgs, _ unikernels.Unikernel) error {
 		BootArgs:   args.Command,
 		InitrdPath: args.InitrdPath,
 	}
-	FCConfig := &FirecrackerConfig{
+	return &FirecrackerConfig{
 		Source:  FCSource,
 		Machine: FCMachine,
 		Drives:  FCDrives,
 		NetIfs:  FCNet,
 	}
-	FCConfigJSON, _ := json.Marshal(FCConfig)
-	if err := os.WriteFile(JSONConfigFile, FCConfigJSON, 0o644); err != nil { //nolint: gosec
-		return fmt.Errorf("failed to save Firecracker json config: %w", err)
-	}
-	vmmLog.WithField("Json", string(FCConfigJSON)).Debug("Firecracker json config")
-
-	exArgs := strings.Split(cmdString, " ")
-	vmmLog.WithField("Firecracker command", exArgs).Debug("Ready to execve Firecracker")
-
-	return syscall.Exec(fc.Path(), exArgs, args.Environment) //nolint: gosec
 }
@@ -0,0 +1,418 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hypervisors
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nubificus/urunc/internal/fsutil"
+)
+
+const (
+	FCSocketName        = "firecracker.sock" // The name of the API socket inside the control directory
+	fcAPIConfigFilename = "fc-api.json"      // The VM configuration to apply through the API
+	fcMetricsFilename   = "fc-metrics.json"  // The file where Firecracker flushes its metrics
+	fcRequestTimeout    = 5 * time.Second
+	fcBootTimeout       = 30 * time.Second
+)
+
+// FirecrackerAction is the body of the /actions endpoint
+type FirecrackerAction struct {
+	ActionType string `json:"action_type"`
+}
+
+// FirecrackerVM is the body of the /vm endpoint
+type FirecrackerVM struct {
+	State string `json:"state"`
+}
+
+// FirecrackerMetrics is the body of the /metrics endpoint
+type FirecrackerMetrics struct {
+	MetricsPath string `json:"metrics_path"`
+}
+
+// FirecrackerSnapshot is the body of the /snapshot/create endpoint
+type FirecrackerSnapshot struct {
+	SnapshotType string `json:"snapshot_type,omitempty"`
+	SnapshotPath string `json:"snapshot_path"`
+	MemFilePath  string `json:"mem_file_path"`
+}
+
+// FirecrackerInstanceInfo is the reply of the / endpoint
+type FirecrackerInstanceInfo struct {
+	ID         string `json:"id"`
+	State      string `json:"state"`
+	VMMVersion string `json:"vmm_version"`
+}
+
+// firecrackerAPIConfig is saved by Execve in the control directory and it is
+// used to configure Firecracker through its API, once it has started.
+// All paths are relative to the root of the monitor.
+type firecrackerAPIConfig struct {
+	Config      FirecrackerConfig `json:"config"`
+	MetricsPath string            `json:"metrics_path"`
+	ControlDir  string            `json:"control_dir"`
+}
+
+// fcClient is a client for the REST API that Firecracker serves over a
+// unix socket.
+type fcClient struct {
+	*apiClient
+}
+
+func newFCClient(socketPath string) *fcClient {
+	return &fcClient{newAPIClient(socketPath, fcRequestTimeout)}
+}
+
+// fcSocketPath returns the path of the API socket in the control directory
+func fcSocketPath(controlDir string) string {
+	return filepath.Join(controlDir, FCSocketName)
+}
+
+// newFCClientFor returns a client for the API socket in the control
+// directory, or notSupported if Firecracker was not started in API mode.
+func newFCClientFor(controlDir string, notSupported error) (*fcClient, error) {
+	socketPath := fcSocketPath(controlDir)
+	err := checkAPISocket(socketPath, notSupported)
+	if err != nil {
+		return nil, err
+	}
+	return newFCClient(socketPath), nil
+}
+
+func (c *fcClient) InstanceInfo() (FirecrackerInstanceInfo, error) {
+	var info FirecrackerInstanceInfo
+	err := c.do(http.MethodGet, "/", nil, &info)
+	return info, err
+}
+
+func (c *fcClient) PutBootSource(source FirecrackerBootSource) error {
+	return c.do(http.MethodPut, "/boot-source", source, nil)
+}
+
+func (c *fcClient) PutMachineConfig(machine FirecrackerMachine) error {
+	return c.do(http.MethodPut, "/machine-config", machine, nil)
+}
+
+func (c *fcClient) PutDrive(drive FirecrackerDrive) error {
+	return c.do(http.MethodPut, "/drives/"+drive.DriveID, drive, nil)
+}
+
+func (c *fcClient) PutNetworkInterface(netIf FirecrackerNet) error {
+	return c.do(http.MethodPut, "/network-interfaces/"+netIf.IfaceID, netIf, nil)
+}
+
+func (c *fcClient) PutMetrics(metrics FirecrackerMetrics) error {
+	return c.do(http.MethodPut, "/metrics", metrics, nil)
+}
+
+func (c *fcClient) Action(actionType string) error {
+	return c.do(http.MethodPut, "/actions", FirecrackerAction{ActionType: actionType}, nil)
+}
+
+func (c *fcClient) PatchVM(state string) error {
+	return c.do(http.MethodPatch, "/vm", FirecrackerVM{State: state}, nil)
+}
+
+func (c *fcClient) CreateSnapshot(snapshot FirecrackerSnapshot) error {
+	return c.do(http.MethodPut, "/snapshot/create", snapshot, nil)
+}
+
+// waitReady waits until the API of Firecracker replies. If the monitor
+// process exits in the meantime, it returns immediately.
+func (c *fcClient) waitReady(pid int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		_, err := c.InstanceInfo()
+		if err == nil {
+			return nil
+		}
+		if exited(pid) {
+			return fmt.Errorf("firecracker exited before its API was ready")
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for the firecracker API: %w", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// exited returns true if the monitor process with pid does not exist any
+// more. A pid of 0 stands for an unknown monitor, which never exits.
+func exited(pid int) bool {
+	return pid > 0 && syscall.Kill(pid, syscall.Signal(0)) != nil
+}
+
+// saveAPIConfig saves the configuration of the VM in the control directory,
+// in order to be applied later through the API of Firecracker. It also
+// creates the metrics file, since Firecracker does not create it.
+func saveAPIConfig(controlDir string, config *FirecrackerConfig) error {
+	metricsPath := filepath.Join(controlDir, fcMetricsFilename)
+	err := os.WriteFile(metricsPath, nil, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create Firecracker metrics file: %w", err)
+	}
+	apiConfig := firecrackerAPIConfig{
+		Config:      *config,
+		MetricsPath: metricsPath,
+		ControlDir:  controlDir,
+	}
+	data, err := json.Marshal(apiConfig)
+	if err != nil {
+		return err
+	}
+	err = fsutil.WriteFileAtomic(filepath.Join(controlDir, fcAPIConfigFilename), data, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to save Firecracker API config: %w", err)
+	}
+	vmmLog.WithField("Json", string(data)).Debug("Firecracker API config")
+	return nil
+}
+
+// loadAPIConfig loads the configuration that Execve saved in the control
+// directory.
+func loadAPIConfig(controlDir string) (*firecrackerAPIConfig, error) {
+	data, err := os.ReadFile(filepath.Join(controlDir, fcAPIConfigFilename))
+	if err != nil {
+		return nil, err
+	}
+	var apiConfig firecrackerAPIConfig
+	err = json.Unmarshal(data, &apiConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Firecracker API config: %w", err)
+	}
+	return &apiConfig, nil
+}
+
+// awaitAPIConfig waits until the monitor process saves the configuration of
+// the VM, which happens right before it execve's Firecracker. If the monitor
+// exits or the timeout passes first, Firecracker would never get configured,
+// hence it returns an error.
+func awaitAPIConfig(controlDir string, pid int, timeout time.Duration) (*firecrackerAPIConfig, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		apiConfig, err := loadAPIConfig(controlDir)
+		if !errors.Is(err, os.ErrNotExist) {
+			return apiConfig, err
+		}
+		if exited(pid) {
+			return nil, fmt.Errorf("the monitor exited before saving the Firecracker API config")
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for the Firecracker API config: %w", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Boot configures the VM through the API of Firecracker and starts it. It
+// gets called only when Firecracker runs in API mode, right after the
+// monitor process starts, hence it waits for the configuration of the VM
+// and for the API.
+func (fc *Firecracker) Boot(args ControlArgs) error {
+	start := time.Now()
+	apiConfig, err := awaitAPIConfig(args.ControlDir, args.Pid, fcBootTimeout)
+	if err != nil {
+		return err
+	}
+
+	c := newFCClient(fcSocketPath(args.ControlDir))
+	err = c.waitReady(args.Pid, fcBootTimeout-time.Since(start))
+	if err != nil {
+		return err
+	}
+	config := apiConfig.Config
+	err = c.PutBootSource(config.Source)
+	if err != nil {
+		return err
+	}
+	err = c.PutMachineConfig(config.Machine)
+	if err != nil {
+		return err
+	}
+	for _, drive := range config.Drives {
+		err = c.PutDrive(drive)
+		if err != nil {
+			return err
+		}
+	}
+	for _, netIf := range config.NetIfs {
+		err = c.PutNetworkInterface(netIf)
+		if err != nil {
+			return err
+		}
+	}
+	err = c.PutMetrics(FirecrackerMetrics{MetricsPath: apiConfig.MetricsPath})
+	if err != nil {
+		return err
+	}
+	return c.Action("InstanceStart")
+}
+
+// Stop asks the guest to shut down, by sending a Ctrl+Alt+Del keystroke.
+// It is supported only when Firecracker is started in API mode.
+func (fc *Firecracker) Stop(args ControlArgs) error {
+	c, err := newFCClientFor(args.ControlDir, ErrStopNotSupported)
+	if err != nil {
+		return err
+	}
+	return c.Action("SendCtrlAltDel")
+}
+
+// Pause stops the execution of the guest's vCPUs
+func (fc *Firecracker) Pause(args ControlArgs) error {
+	c, err := newFCClientFor(args.ControlDir, ErrPauseNotSupported)
+	if err != nil {
+		return err
+	}
+	return c.PatchVM("Paused")
+}
+
+// Resume continues the execution of a paused guest
+func (fc *Firecracker) Resume(args ControlArgs) error {
+	c, err := newFCClientFor(args.ControlDir, ErrPauseNotSupported)
+	if err != nil {
+		return err
+	}
+	return c.PatchVM("Resumed")
+}
+
+// Snapshot creates a full snapshot of the paused guest. The state of the
+// VM and its memory are stored in the control directory under the given
+// name, with the .vmstate and .mem suffixes respectively.
+func (fc *Firecracker) Snapshot(args ControlArgs, name string) error {
+	c, err := newFCClientFor(args.ControlDir, ErrSnapshotNotSupported)
+	if err != nil {
+		return err
+	}
+	apiConfig, err := loadAPIConfig(args.ControlDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrSnapshotNotSupported
+	} else if err != nil {
+		return err
+	}
+	// The paths are resolved by Firecracker, hence they need to be
+	// relative to the root of the monitor.
+	return c.CreateSnapshot(FirecrackerSnapshot{
+		SnapshotType: "Full",
+		SnapshotPath: filepath.Join(apiConfig.ControlDir, name+".vmstate"),
+		MemFilePath:  filepath.Join(apiConfig.ControlDir, name+".mem"),
+	})
+}
+
+// Stats returns the state of the guest and the statistics of its block
+// devices, as reported in the latest metrics that Firecracker flushed.
+func (fc *Firecracker) Stats(args ControlArgs) (VMStats, error) {
+	var stats VMStats
+	c, err := newFCClientFor(args.ControlDir, ErrStatsNotSupported)
+	if err != nil {
+		return stats, err
+	}
+	info, err := c.InstanceInfo()
+	if err != nil {
+		return stats, err
+	}
+	stats.Status = strings.ToLower(info.State)
+	stats.Running = info.State == "Running"
+
+	err = c.Action("FlushMetrics")
+	if err != nil {
+		return stats, err
+	}
+	metrics, err := lastFCMetrics(filepath.Join(args.ControlDir, fcMetricsFilename))
+	if err != nil {
+		return stats, err
+	}
+	stats.Blocks = fcBlockStats(metrics)
+	return stats, nil
+}
+
+// fcBlockMetrics holds the metrics of a block device of Firecracker
+type fcBlockMetrics struct {
+	ReadBytes  uint64 `json:"read_bytes"`
+	WriteBytes uint64 `json:"write_bytes"`
+	ReadCount  uint64 `json:"read_count"`
+	WriteCount uint64 `json:"write_count"`
+}
+
+// lastFCMetrics returns the latest metrics that Firecracker flushed in the
+// metrics file. Every flush appends a single JSON line in the file.
+func lastFCMetrics(path string) (map[string]json.RawMessage, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var last []byte
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) > 0 {
+			last = append(last[:0], scanner.Bytes()...)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if last == nil {
+		return nil, fmt.Errorf("no metrics found in %s", path)
+	}
+
+	var metrics map[string]json.RawMessage
+	err = json.Unmarshal(last, &metrics)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Firecracker metrics: %w", err)
+	}
+	return metrics, nil
+}
+
+// fcBlockStats extracts the per drive statistics from the metrics of
+// Firecracker, which are reported under the block_<drive_id> keys.
+func fcBlockStats(metrics map[string]json.RawMessage) []BlockDeviceStat {
+	var blocks []BlockDeviceStat
+	for key, value := range metrics {
+		drive, ok := strings.CutPrefix(key, "block_")
+		if !ok {
+			continue
+		}
+		var m fcBlockMetrics
+		if json.Unmarshal(value, &m) != nil {
+			continue
+		}
+		blocks = append(blocks, BlockDeviceStat{
+			Device:     drive,
+			ReadBytes:  m.ReadBytes,
+			WriteBytes: m.WriteBytes,
+			ReadOps:    m.ReadCount,
+			WriteOps:   m.WriteCount,
+		})
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].Device < blocks[j].Device
+	})
+	return blocks
+}
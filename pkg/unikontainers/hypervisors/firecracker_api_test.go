@@ -0,0 +1,220 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hypervisors
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeFCServer is a stand-in for the API server of Firecracker. It keeps
+// the state of the VM, which the guest changes once it starts.
+type fakeFCServer struct {
+	*fakeAPIServer
+	state string
+}
+
+func newFakeFCServer(t *testing.T) (*fakeFCServer, string) {
+	t.Helper()
+	controlDir := newControlDir(t)
+	s := &fakeFCServer{state: "Not started"}
+	s.fakeAPIServer = newFakeAPIServer(t, fcSocketPath(controlDir), s.reply)
+	return s, controlDir
+}
+
+func (s *fakeFCServer) reply(w http.ResponseWriter, req apiRequest) {
+	if req.Method == http.MethodGet && req.Path == "/" {
+		_ = json.NewEncoder(w).Encode(FirecrackerInstanceInfo{ID: "test", State: s.state})
+		return
+	}
+	if req.Path == "/drives/broken" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"fault_message": "invalid drive"}`))
+		return
+	}
+	if req.Path == "/actions" && req.Body == `{"action_type":"InstanceStart"}` {
+		s.state = "Running"
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// received returns the requests of the server, except for the ones that
+// poll the state of the VM
+func (s *fakeFCServer) received() []apiRequest {
+	requests := []apiRequest{}
+	for _, req := range s.fakeAPIServer.received() {
+		if req.Method != http.MethodGet || req.Path != "/" {
+			requests = append(requests, req)
+		}
+	}
+	return requests
+}
+
+func TestFirecrackerBoot(t *testing.T) {
+	t.Run("api mode", func(t *testing.T) {
+		t.Parallel()
+		server, controlDir := newFakeFCServer(t)
+		fc := &Firecracker{}
+		config := fc.buildConfig(ExecArgs{
+			UnikernelPath: "/unikernel/app",
+			Command:       "console=ttyS0",
+			BlockDevice:   "/dev/dm-1",
+			TapDevice:     "tap0_urunc",
+			GuestMAC:      "aa:bb:cc:dd:ee:ff",
+			APISocket:     true,
+		})
+		assert.NoError(t, saveAPIConfig(controlDir, config))
+
+		err := fc.Boot(ControlArgs{ControlDir: controlDir})
+		assert.NoError(t, err)
+		paths := []string{}
+		for _, req := range server.received() {
+			assert.Equal(t, http.MethodPut, req.Method)
+			paths = append(paths, req.Path)
+		}
+		assert.Equal(t, []string{
+			"/boot-source",
+			"/machine-config",
+			"/drives/rootfs",
+			"/network-interfaces/net1",
+			"/metrics",
+			"/actions",
+		}, paths)
+		assert.FileExists(t, filepath.Join(controlDir, fcMetricsFilename))
+	})
+	t.Run("config saved after boot starts", func(t *testing.T) {
+		t.Parallel()
+		server, controlDir := newFakeFCServer(t)
+		fc := &Firecracker{}
+		config := fc.buildConfig(ExecArgs{UnikernelPath: "/unikernel/app", APISocket: true})
+		saved := make(chan error, 1)
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			saved <- saveAPIConfig(controlDir, config)
+		}()
+
+		err := fc.Boot(ControlArgs{ControlDir: controlDir})
+		assert.NoError(t, err)
+		assert.NoError(t, <-saved)
+		requests := server.received()
+		if len(requests) == 0 {
+			t.Fatal("expected the VM to get configured")
+		}
+		assert.Equal(t, apiRequest{http.MethodPut, "/actions", `{"action_type":"InstanceStart"}`}, requests[len(requests)-1])
+	})
+	t.Run("monitor exits without config", func(t *testing.T) {
+		t.Parallel()
+		server, controlDir := newFakeFCServer(t)
+		monitor := exec.Command("true")
+		if err := monitor.Run(); err != nil {
+			t.Fatal(err)
+		}
+		fc := &Firecracker{}
+		err := fc.Boot(ControlArgs{ControlDir: controlDir, Pid: monitor.Process.Pid})
+		assert.ErrorContains(t, err, "the monitor exited before saving the Firecracker API config")
+		assert.Empty(t, server.received())
+	})
+	t.Run("api error", func(t *testing.T) {
+		t.Parallel()
+		_, controlDir := newFakeFCServer(t)
+		fc := &Firecracker{}
+		config := fc.buildConfig(ExecArgs{UnikernelPath: "/unikernel/app", APISocket: true})
+		config.Drives = append(config.Drives, FirecrackerDrive{DriveID: "broken"})
+		assert.NoError(t, saveAPIConfig(controlDir, config))
+
+		err := fc.Boot(ControlArgs{ControlDir: controlDir})
+		assert.ErrorContains(t, err, "invalid drive")
+	})
+}
+
+func TestFirecrackerControl(t *testing.T) {
+	tests := []struct {
+		name    string
+		control func(fc *Firecracker, args ControlArgs) error
+		request apiRequest
+	}{
+		{"stop", (*Firecracker).Stop, apiRequest{http.MethodPut, "/actions", `{"action_type":"SendCtrlAltDel"}`}},
+		{"pause", (*Firecracker).Pause, apiRequest{http.MethodPatch, "/vm", `{"state":"Paused"}`}},
+		{"resume", (*Firecracker).Resume, apiRequest{http.MethodPatch, "/vm", `{"state":"Resumed"}`}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			server, controlDir := newFakeFCServer(t)
+			err := tc.control(&Firecracker{}, ControlArgs{ControlDir: controlDir})
+			assert.NoError(t, err)
+			assert.Equal(t, []apiRequest{tc.request}, server.received())
+		})
+	}
+	t.Run("without api socket", func(t *testing.T) {
+		t.Parallel()
+		fc := &Firecracker{}
+		args := ControlArgs{ControlDir: t.TempDir()}
+		assert.ErrorIs(t, fc.Stop(args), ErrStopNotSupported)
+		assert.ErrorIs(t, fc.Pause(args), ErrPauseNotSupported)
+		assert.ErrorIs(t, fc.Snapshot(args, "snap"), ErrSnapshotNotSupported)
+	})
+	t.Run("snapshot", func(t *testing.T) {
+		t.Parallel()
+		server, controlDir := newFakeFCServer(t)
+		fc := &Firecracker{}
+		// The monitor saves the config with its own path of the control
+		// directory
+		assert.NoError(t, saveAPIConfig(controlDir, fc.buildConfig(ExecArgs{APISocket: true})))
+		err := fc.Snapshot(ControlArgs{ControlDir: controlDir}, "snap")
+		assert.NoError(t, err)
+		body := fmt.Sprintf(`{"snapshot_type":"Full","snapshot_path":"%s/snap.vmstate","mem_file_path":"%s/snap.mem"}`, controlDir, controlDir)
+		assert.Equal(t, []apiRequest{{http.MethodPut, "/snapshot/create", body}}, server.received())
+	})
+	t.Run("snapshot without api config", func(t *testing.T) {
+		t.Parallel()
+		_, controlDir := newFakeFCServer(t)
+		err := (&Firecracker{}).Snapshot(ControlArgs{ControlDir: controlDir}, "snap")
+		assert.ErrorIs(t, err, ErrSnapshotNotSupported)
+	})
+}
+
+func TestFirecrackerStats(t *testing.T) {
+	t.Parallel()
+	server, controlDir := newFakeFCServer(t)
+	server.state = "Paused"
+	metrics := `{"block_rootfs": {"read_bytes": 1, "write_bytes": 2, "read_count": 3, "write_count": 4}}` + "\n" +
+		`{"block_rootfs": {"read_bytes": 10, "write_bytes": 20, "read_count": 30, "write_count": 40}, "net": {}}` + "\n"
+	err := os.WriteFile(filepath.Join(controlDir, fcMetricsFilename), []byte(metrics), 0o600)
+	assert.NoError(t, err)
+
+	stats, err := (&Firecracker{}).Stats(ControlArgs{ControlDir: controlDir})
+	assert.NoError(t, err)
+	assert.Equal(t, VMStats{
+		Status:  "paused",
+		Running: false,
+		Blocks: []BlockDeviceStat{{
+			Device:     "rootfs",
+			ReadBytes:  10,
+			WriteBytes: 20,
+			ReadOps:    30,
+			WriteOps:   40,
+		}},
+	}, stats)
+	assert.Equal(t, []apiRequest{{http.MethodPut, "/actions", `{"action_type":"FlushMetrics"}`}}, server.received())
+}
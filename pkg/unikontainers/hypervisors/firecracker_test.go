@@ -0,0 +1,112 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hypervisors
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFirecrackerConfigFile(t *testing.T) {
+	t.Run("config is saved in the control directory", func(t *testing.T) {
+		t.Parallel()
+		controlDir := t.TempDir()
+		fc := &Firecracker{}
+		config := fc.buildConfig(ExecArgs{
+			UnikernelPath: "/unikernel",
+			Command:       "console=ttyS0",
+			TapDevice:     "tap0",
+			VCPUs:         2,
+		})
+
+		path, err := saveConfigFile(controlDir, config)
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join(controlDir, FCJsonFilename), path)
+
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		var saved FirecrackerConfig
+		assert.NoError(t, json.Unmarshal(data, &saved))
+		assert.Equal(t, uint(2), saved.Machine.VcpuCount)
+		assert.Equal(t, "/unikernel", saved.Source.ImagePath)
+
+		// No temporary files are left behind
+		entries, err := os.ReadDir(controlDir)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+
+		assert.Equal(t, path, fc.ConfigFile(ControlArgs{ControlDir: controlDir}))
+	})
+
+	t.Run("config is overwritten", func(t *testing.T) {
+		t.Parallel()
+		controlDir := t.TempDir()
+		fc := &Firecracker{}
+		_, err := saveConfigFile(controlDir, fc.buildConfig(ExecArgs{VCPUs: 1}))
+		assert.NoError(t, err)
+		path, err := saveConfigFile(controlDir, fc.buildConfig(ExecArgs{VCPUs: 4}))
+		assert.NoError(t, err)
+
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		var saved FirecrackerConfig
+		assert.NoError(t, json.Unmarshal(data, &saved))
+		assert.Equal(t, uint(4), saved.Machine.VcpuCount)
+	})
+
+	t.Run("no config", func(t *testing.T) {
+		t.Parallel()
+		fc := &Firecracker{}
+		assert.Empty(t, fc.ConfigFile(ControlArgs{ControlDir: t.TempDir()}))
+	})
+}
+
+func TestFirecrackerNetworkInterfaces(t *testing.T) {
+	t.Run("extra network devices", func(t *testing.T) {
+		t.Parallel()
+		fc := &Firecracker{}
+		config := fc.buildConfig(ExecArgs{
+			TapDevice: "tap0_urunc",
+			GuestMAC:  "02:00:00:00:00:01",
+			ExtraNetworks: []NetArgs{
+				{TapDevice: "tap1_urunc", GuestMAC: "02:00:00:00:00:02"},
+			},
+		})
+		assert.Equal(t, []FirecrackerNet{
+			{IfaceID: "net1", GuestMAC: "02:00:00:00:00:01", HostIF: "tap0_urunc"},
+			{IfaceID: "net2", GuestMAC: "02:00:00:00:00:02", HostIF: "tap1_urunc"},
+		}, config.NetIfs)
+	})
+}
+
+func TestFirecrackerVolumes(t *testing.T) {
+	fc := &Firecracker{}
+	config := fc.buildConfig(ExecArgs{
+		BlockDevice: "/dev/dm-1",
+		Volumes: []BlockArgs{
+			{Path: "/.urunc/volumes/0", ReadOnly: true},
+			{Path: "/.urunc/volumes/1"},
+		},
+	})
+	assert.Equal(t, []FirecrackerDrive{
+		{DriveID: "rootfs", IsRootDev: true, HostPath: "/dev/dm-1"},
+		{DriveID: "vol0", IsRO: true, HostPath: "/.urunc/volumes/0"},
+		{DriveID: "vol1", HostPath: "/.urunc/volumes/1"},
+	}, config.Drives)
+}
@@ -16,6 +16,7 @@ package hypervisors
 
 import (
 	"fmt"
+	"syscall"
 
 	hedge "github.com/nubificus/hedge_cli/hedge_api"
 	"github.com/nubificus/urunc/pkg/unikontainers/unikernels"
@@ -33,7 +34,7 @@ func (h *Hedge) Ok() error {
 	return fmt.Errorf("hedge not implemented yet")
 }
 
-func (h *Hedge) Stop(_ string) error {
+func (h *Hedge) Stop(_ ControlArgs) error {
 	return fmt.Errorf("hedge not implemented yet")
 }
 
@@ -45,6 +46,10 @@ func (h *Hedge) Path() string {
 	return ""
 }
 
+func (h *Hedge) GuestExitCode(status syscall.WaitStatus, _ unikernels.Unikernel) int {
+	return monitorExitCode(status)
+}
+
 func (h *Hedge) Execve(_ ExecArgs, _ unikernels.Unikernel) error {
 	return fmt.Errorf("hedge not implemented yet")
 }
@@ -118,10 +118,10 @@ func applySeccompFilter() error {
 	return nil
 }
 
-// Stop is an empty function to satisfy VMM interface compatibility requirements.
-// It does not perform any actions and always returns nil.
-func (h *HVT) Stop(_ string) error {
-	return nil
+// Stop sends a SIGTERM to the Solo5 tender. There is no way to notify
+// Solo5 guests for a shutdown, hence this is the most graceful way to stop.
+func (h *HVT) Stop(args ControlArgs) error {
+	return syscall.Kill(args.Pid, syscall.SIGTERM)
 }
 
 // UsesKVM returns a bool value depending on if the monitor uses KVM
@@ -134,6 +134,13 @@ func (h *HVT) Path() string {
 	return h.binaryPath
 }
 
+// GuestExitCode returns the exit status of the Solo5 tender, which is the
+// status that the guest passed to solo5_exit(). In the case of an abort the
+// tender exits with 255.
+func (h *HVT) GuestExitCode(status syscall.WaitStatus, _ unikernels.Unikernel) int {
+	return monitorExitCode(status)
+}
+
 // Ok checks if the hvt binary is available in the system's PATH.
 func (h *HVT) Ok() error {
 	if _, err := exec.LookPath(HvtBinary); err != nil {
@@ -147,6 +154,9 @@ func (h *HVT) Execve(args ExecArgs, ukernel unikernels.Unikernel) error {
 	hvtMem := bytesToStringMB(args.MemSizeB)
 	cmdString := h.binaryPath + " --mem=" + hvtMem
 	cmdString = appendNonEmpty(cmdString, " "+ukernel.MonitorNetCli(hvtString), args.TapDevice)
+	if len(args.ExtraNetworks) > 0 {
+		vmmLog.Warnf("%s supports a single network device, ignoring %d more", hvtString, len(args.ExtraNetworks))
+	}
 	cmdString = appendNonEmpty(cmdString, " "+ukernel.MonitorBlockCli(hvtString), args.BlockDevice)
 	cmdString = appendNonEmpty(cmdString, " ", ukernel.MonitorCli(hvtString))
 	cmdString += " " + args.UnikernelPath + " " + args.Command
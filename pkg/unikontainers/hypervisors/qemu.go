@@ -16,6 +16,7 @@ package hypervisors
 
 import (
 	"runtime"
+	"strconv"
 	"strings"
 	"syscall"
 
@@ -32,8 +33,28 @@ type Qemu struct {
 	binary     string
 }
 
-func (q *Qemu) Stop(_ string) error {
-	return nil
+// Stop asks the guest to shut down, by sending an ACPI power down event
+// over QMP.
+func (q *Qemu) Stop(args ControlArgs) error {
+	_, err := qmpExecute(args.ControlDir, "system_powerdown", nil)
+	return err
+}
+
+// Pause stops the execution of the guest's vCPUs
+func (q *Qemu) Pause(args ControlArgs) error {
+	_, err := qmpExecute(args.ControlDir, "stop", nil)
+	return err
+}
+
+// Resume continues the execution of a paused guest
+func (q *Qemu) Resume(args ControlArgs) error {
+	_, err := qmpExecute(args.ControlDir, "cont", nil)
+	return err
+}
+
+// Stats returns the status and block device statistics of the guest
+func (q *Qemu) Stats(args ControlArgs) (VMStats, error) {
+	return qmpStats(args.ControlDir)
 }
 
 func (q *Qemu) Ok() error {
@@ -49,14 +70,43 @@ func (q *Qemu) Path() string {
 	return q.binaryPath
 }
 
+// GuestExitCode decodes the exit status of QEMU. If the guest uses the
+// isa-debug-exit device to exit, QEMU exits with (value << 1) | 1, where
+// value is the one that the guest wrote to the device. Otherwise, the exit
+// status of QEMU is returned as is.
+//
+// QEMU itself exits with 1 when it fails to start (e.g. bad arguments or no
+// KVM), which is indistinguishable from a guest that wrote 0. Hence, 1 is
+// never decoded and it gets reported as a failure.
+func (q *Qemu) GuestExitCode(status syscall.WaitStatus, ukernel unikernels.Unikernel) int {
+	code := monitorExitCode(status)
+	if !status.Exited() {
+		return code
+	}
+	if strings.Contains(ukernel.MonitorCli(string(QemuVmm)), "isa-debug-exit") && code >= 3 && code&1 == 1 {
+		return code >> 1
+	}
+	return code
+}
+
 func (q *Qemu) Execve(args ExecArgs, ukernel unikernels.Unikernel) error {
 	qemuString := string(QemuVmm)
 	qemuMem := bytesToStringMB(args.MemSizeB)
 	cmdString := q.binaryPath + " -m " + qemuMem + "M"
+	if usesVirtioFS(args.SharedDirs) {
+		cmdString += " -object memory-backend-memfd,id=mem,size=" + qemuMem + "M,share=on"
+		cmdString += " -numa node,memdev=mem"
+	}
+	if args.VCPUs > 1 {
+		cmdString += " -smp " + strconv.FormatUint(uint64(args.VCPUs), 10)
+	}
 	cmdString += " -L /usr/share/qemu"   // Set the path for qemu bios/data
 	cmdString += " -cpu host"            // Choose CPU
 	cmdString += " -enable-kvm"          // Enable KVM to use CPU virt extensions
 	cmdString += " -nographic -vga none" // Disable graphic output
+	if args.ControlDir != "" {
+		cmdString += " -qmp unix:" + qmpSocketPath(args.ControlDir) + ",server=on,wait=off"
+	}
 
 	if args.Seccomp {
 		// Enable Seccomp in QEMU
@@ -79,7 +129,15 @@ func (q *Qemu) Execve(args ExecArgs, ukernel unikernels.Unikernel) error {
 	}
 
 	cmdString += " -kernel " + args.UnikernelPath
-	if args.TapDevice != "" {
+	if args.TapDevice != "" && args.TapCharDevice != "" {
+		// QEMU does not accept the options of tap devices, such as
+		// ifname, along with a file descriptor.
+		fd, err := openTapCharDevice(args.TapCharDevice)
+		if err != nil {
+			return err
+		}
+		cmdString += qemuTapFdNetCli(0, fd, args.GuestMAC)
+	} else if args.TapDevice != "" {
 		netcli := ukernel.MonitorNetCli(qemuString)
 		if netcli == "" {
 			netcli += " -net nic,model=virtio"
@@ -87,6 +145,19 @@ func (q *Qemu) Execve(args ExecArgs, ukernel unikernels.Unikernel) error {
 		}
 		netcli += args.TapDevice
 		cmdString += netcli
+	}
+	if args.TapDevice != "" {
+		for i, extraNet := range args.ExtraNetworks {
+			if extraNet.CharDevice == "" {
+				cmdString += qemuExtraNetCli(i+1, extraNet)
+				continue
+			}
+			fd, err := openTapCharDevice(extraNet.CharDevice)
+			if err != nil {
+				return err
+			}
+			cmdString += qemuTapFdNetCli(i+1, fd, extraNet.GuestMAC)
+		}
 	} else {
 		cmdString += " -nic none"
 	}
@@ -99,6 +170,16 @@ func (q *Qemu) Execve(args ExecArgs, ukernel unikernels.Unikernel) error {
 		blockCli += args.BlockDevice
 		cmdString += blockCli
 	}
+	for i, volume := range args.Volumes {
+		cmdString += qemuVolumeCli(i, volume)
+	}
+	for i, dir := range args.SharedDirs {
+		if dir.Socket != "" {
+			cmdString += qemuVirtioFSCli(i, dir)
+		} else {
+			cmdString += qemu9pCli(i, dir)
+		}
+	}
 	if args.InitrdPath != "" {
 		cmdString += " -initrd " + args.InitrdPath
 	}
@@ -108,3 +189,54 @@ func (q *Qemu) Execve(args ExecArgs, ukernel unikernels.Unikernel) error {
 	vmmLog.WithField("qemu command", exArgs).Debug("Ready to execve qemu")
 	return syscall.Exec(q.Path(), exArgs, args.Environment) //nolint: gosec
 }
+
+// qemuExtraNetCli returns the QEMU command line arguments that attach an
+// additional virtio network device to the guest.
+func qemuExtraNetCli(index int, net NetArgs) string {
+	id := "unet" + strconv.Itoa(index)
+	netcli := " -netdev tap,id=" + id + ",script=no,downscript=no,ifname=" + net.TapDevice
+	netcli += " -device virtio-net-pci,netdev=" + id
+	return appendNonEmpty(netcli, ",mac=", net.GuestMAC)
+}
+
+// qemuTapFdNetCli returns the QEMU command line arguments that attach a
+// virtio network device to the guest, using the tap file descriptor fd that
+// QEMU inherits.
+func qemuTapFdNetCli(index int, fd int, mac string) string {
+	id := "unet" + strconv.Itoa(index)
+	netcli := " -netdev tap,id=" + id + ",fd=" + strconv.Itoa(fd)
+	netcli += " -device virtio-net-pci,netdev=" + id
+	return appendNonEmpty(netcli, ",mac=", mac)
+}
+
+// qemuVolumeCli returns the QEMU command line arguments that attach an
+// additional virtio block device to the guest.
+func qemuVolumeCli(index int, volume BlockArgs) string {
+	id := "vol" + strconv.Itoa(index)
+	blockCli := " -drive format=raw,if=none,id=" + id + ",file=" + volume.Path
+	if volume.ReadOnly {
+		blockCli += ",readonly=on"
+	}
+	return blockCli + " -device virtio-blk-pci,drive=" + id
+}
+
+// qemu9pCli returns the QEMU command line arguments that share a directory
+// with the guest over 9p. The monitor might not run as root, hence it does
+// not try to map the ownership of the files.
+func qemu9pCli(index int, dir SharedDirArgs) string {
+	id := "fs" + strconv.Itoa(index)
+	fsCli := " -fsdev local,id=" + id + ",path=" + dir.Path + ",security_model=none"
+	if dir.ReadOnly {
+		fsCli += ",readonly=on"
+	}
+	return fsCli + " -device virtio-9p-pci,fsdev=" + id + ",mount_tag=" + dir.Tag
+}
+
+// qemuVirtioFSCli returns the QEMU command line arguments that share a
+// directory with the guest over virtio-fs, through the virtiofsd that
+// listens on the socket of dir.
+func qemuVirtioFSCli(index int, dir SharedDirArgs) string {
+	id := "vfs" + strconv.Itoa(index)
+	fsCli := " -chardev socket,id=" + id + ",path=" + dir.Socket
+	return fsCli + " -device vhost-user-fs-pci,chardev=" + id + ",tag=" + dir.Tag
+}
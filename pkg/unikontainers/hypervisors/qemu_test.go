@@ -0,0 +1,77 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hypervisors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQemuExtraNetCli(t *testing.T) {
+	t.Run("with MAC", func(t *testing.T) {
+		t.Parallel()
+		netcli := qemuExtraNetCli(1, NetArgs{TapDevice: "tap1_urunc", GuestMAC: "02:00:00:00:00:02"})
+		assert.Equal(t, " -netdev tap,id=unet1,script=no,downscript=no,ifname=tap1_urunc"+
+			" -device virtio-net-pci,netdev=unet1,mac=02:00:00:00:00:02", netcli)
+	})
+	t.Run("without MAC", func(t *testing.T) {
+		t.Parallel()
+		netcli := qemuExtraNetCli(2, NetArgs{TapDevice: "tap2_urunc"})
+		assert.Equal(t, " -netdev tap,id=unet2,script=no,downscript=no,ifname=tap2_urunc"+
+			" -device virtio-net-pci,netdev=unet2", netcli)
+	})
+}
+
+func TestQemuTapFdNetCli(t *testing.T) {
+	t.Run("first device", func(t *testing.T) {
+		t.Parallel()
+		netcli := qemuTapFdNetCli(0, 3, "02:00:00:00:00:01")
+		assert.Equal(t, " -netdev tap,id=unet0,fd=3"+
+			" -device virtio-net-pci,netdev=unet0,mac=02:00:00:00:00:01", netcli)
+	})
+	t.Run("without MAC", func(t *testing.T) {
+		t.Parallel()
+		netcli := qemuTapFdNetCli(1, 7, "")
+		assert.Equal(t, " -netdev tap,id=unet1,fd=7 -device virtio-net-pci,netdev=unet1", netcli)
+	})
+}
+
+func TestQemuVolumeCli(t *testing.T) {
+	t.Run("read-write", func(t *testing.T) {
+		t.Parallel()
+		blockCli := qemuVolumeCli(0, BlockArgs{Path: "/.urunc/volumes/0"})
+		assert.Equal(t, " -drive format=raw,if=none,id=vol0,file=/.urunc/volumes/0"+
+			" -device virtio-blk-pci,drive=vol0", blockCli)
+	})
+	t.Run("read-only", func(t *testing.T) {
+		t.Parallel()
+		blockCli := qemuVolumeCli(1, BlockArgs{Path: "/.urunc/volumes/1", ReadOnly: true})
+		assert.Equal(t, " -drive format=raw,if=none,id=vol1,file=/.urunc/volumes/1,readonly=on"+
+			" -device virtio-blk-pci,drive=vol1", blockCli)
+	})
+}
+
+func TestQemu9pCli(t *testing.T) {
+	fsCli := qemu9pCli(0, SharedDirArgs{Tag: "vol0", Path: "/.urunc/volumes/0", ReadOnly: true})
+	assert.Equal(t, " -fsdev local,id=fs0,path=/.urunc/volumes/0,security_model=none,readonly=on"+
+		" -device virtio-9p-pci,fsdev=fs0,mount_tag=vol0", fsCli)
+}
+
+func TestQemuVirtioFSCli(t *testing.T) {
+	fsCli := qemuVirtioFSCli(0, SharedDirArgs{Tag: "rootfs", Path: "/.urunc/rootfs", Socket: "/tmp/urunc/virtiofsd.sock"})
+	assert.Equal(t, " -chardev socket,id=vfs0,path=/tmp/urunc/virtiofsd.sock"+
+		" -device vhost-user-fs-pci,chardev=vfs0,tag=rootfs", fsCli)
+}
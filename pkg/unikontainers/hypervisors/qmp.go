@@ -0,0 +1,215 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hypervisors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path/filepath"
+	"time"
+
+	"github.com/nubificus/urunc/internal/unixsock"
+)
+
+const (
+	QmpSocketName = "qmp.sock"      // The name of the QMP socket inside the control directory
+	qmpTimeout    = 5 * time.Second // Timeout for each QMP session
+)
+
+// qmpClient is a minimal client of the QEMU Machine Protocol (QMP).
+// It supports only synchronous commands and it ignores any asynchronous
+// events that QEMU sends in the meantime.
+type qmpClient struct {
+	conn net.Conn
+	dec  *json.Decoder
+	enc  *json.Encoder
+}
+
+// qmpCommand is a QMP command sent to QEMU
+type qmpCommand struct {
+	Execute   string `json:"execute"`
+	Arguments any    `json:"arguments,omitempty"`
+}
+
+// qmpError is the error returned by QEMU, when a command fails
+type qmpError struct {
+	Class string `json:"class"`
+	Desc  string `json:"desc"`
+}
+
+func (e *qmpError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Class, e.Desc)
+}
+
+// qmpResponse is any message that QEMU sends over QMP. Only one of the
+// fields is set, depending on the type of the message.
+type qmpResponse struct {
+	Greeting json.RawMessage `json:"QMP"`
+	Return   json.RawMessage `json:"return"`
+	Error    *qmpError       `json:"error"`
+	Event    string          `json:"event"`
+}
+
+// qmpSocketPath returns the path of the QMP socket in the control directory
+func qmpSocketPath(controlDir string) string {
+	return filepath.Join(controlDir, QmpSocketName)
+}
+
+// dialQMP connects to the QMP socket in path, reads the greeting of QEMU
+// and negotiates the capabilities, entering the command mode.
+func dialQMP(path string) (*qmpClient, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), qmpTimeout)
+	defer cancel()
+	conn, err := unixsock.DialContext(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to QMP socket %s: %w", path, err)
+	}
+	err = conn.SetDeadline(time.Now().Add(qmpTimeout))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c := &qmpClient{
+		conn: conn,
+		dec:  json.NewDecoder(conn),
+		enc:  json.NewEncoder(conn),
+	}
+
+	var greeting qmpResponse
+	err = c.dec.Decode(&greeting)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read QMP greeting: %w", err)
+	}
+	if greeting.Greeting == nil {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected QMP greeting")
+	}
+	_, err = c.execute("qmp_capabilities", nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// execute sends a command to QEMU and waits for its reply. Any events
+// received before the reply are ignored.
+func (c *qmpClient) execute(command string, arguments any) (json.RawMessage, error) {
+	err := c.enc.Encode(qmpCommand{Execute: command, Arguments: arguments})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send QMP command %s: %w", command, err)
+	}
+	for {
+		var resp qmpResponse
+		err = c.dec.Decode(&resp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read reply of QMP command %s: %w", command, err)
+		}
+		if resp.Event != "" {
+			vmmLog.WithField("event", resp.Event).Debug("received QMP event")
+			continue
+		}
+		if resp.Error != nil {
+			return nil, fmt.Errorf("QMP command %s failed: %w", command, resp.Error)
+		}
+		return resp.Return, nil
+	}
+}
+
+func (c *qmpClient) Close() error {
+	return c.conn.Close()
+}
+
+// qmpExecute connects to the QMP socket of controlDir, executes a single
+// command and closes the connection.
+func qmpExecute(controlDir string, command string, arguments any) (json.RawMessage, error) {
+	c, err := dialQMP(qmpSocketPath(controlDir))
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	return c.execute(command, arguments)
+}
+
+// qmpStatus is the reply of query-status
+type qmpStatus struct {
+	Running bool   `json:"running"`
+	Status  string `json:"status"`
+}
+
+// qmpBlockStats is an entry of the reply of query-blockstats
+type qmpBlockStats struct {
+	Device string `json:"device"`
+	QDev   string `json:"qdev"`
+	Stats  struct {
+		ReadBytes       uint64 `json:"rd_bytes"`
+		WriteBytes      uint64 `json:"wr_bytes"`
+		ReadOperations  uint64 `json:"rd_operations"`
+		WriteOperations uint64 `json:"wr_operations"`
+	} `json:"stats"`
+}
+
+// qmpStats collects the status and block statistics of the guest
+func qmpStats(controlDir string) (VMStats, error) {
+	var stats VMStats
+
+	c, err := dialQMP(qmpSocketPath(controlDir))
+	if err != nil {
+		return stats, err
+	}
+	defer c.Close()
+
+	reply, err := c.execute("query-status", nil)
+	if err != nil {
+		return stats, err
+	}
+	var status qmpStatus
+	err = json.Unmarshal(reply, &status)
+	if err != nil {
+		return stats, fmt.Errorf("failed to parse reply of query-status: %w", err)
+	}
+	stats.Status = status.Status
+	stats.Running = status.Running
+
+	reply, err = c.execute("query-blockstats", nil)
+	if err != nil {
+		return stats, err
+	}
+	var blockStats []qmpBlockStats
+	err = json.Unmarshal(reply, &blockStats)
+	if err != nil {
+		return stats, fmt.Errorf("failed to parse reply of query-blockstats: %w", err)
+	}
+	for _, b := range blockStats {
+		device := b.Device
+		if device == "" {
+			device = b.QDev
+		}
+		stats.Blocks = append(stats.Blocks, BlockDeviceStat{
+			Device:     device,
+			ReadBytes:  b.Stats.ReadBytes,
+			WriteBytes: b.Stats.WriteBytes,
+			ReadOps:    b.Stats.ReadOperations,
+			WriteOps:   b.Stats.WriteOperations,
+		})
+	}
+
+	return stats, nil
+}
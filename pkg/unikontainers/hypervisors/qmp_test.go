@@ -0,0 +1,163 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hypervisors
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/nubificus/urunc/internal/unixsock"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeQMPServer is a stand-in for the QMP server of QEMU. It replies to
+// every command with the reply registered for it and it keeps track of
+// the commands it received.
+type fakeQMPServer struct {
+	listener net.Listener
+	replies  map[string]string
+	mu       sync.Mutex
+	commands []string
+}
+
+func newFakeQMPServer(t *testing.T, replies map[string]string) (*fakeQMPServer, string) {
+	t.Helper()
+	controlDir := newControlDir(t)
+	listener, err := unixsock.Listen(qmpSocketPath(controlDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeQMPServer{listener: listener, replies: replies}
+	t.Cleanup(func() { listener.Close() })
+	go s.serve()
+	return s, controlDir
+}
+
+func (s *fakeQMPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeQMPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	_, err := conn.Write([]byte(`{"QMP": {"version": {"qemu": {"micro": 0, "minor": 2, "major": 8}}, "capabilities": []}}` + "\n"))
+	if err != nil {
+		return
+	}
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var cmd qmpCommand
+		err = json.Unmarshal(scanner.Bytes(), &cmd)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, cmd.Execute)
+		s.mu.Unlock()
+
+		reply, ok := s.replies[cmd.Execute]
+		if !ok {
+			reply = `{"return": {}}`
+		}
+		_, err = conn.Write([]byte(reply + "\n"))
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeQMPServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+func TestQemuControl(t *testing.T) {
+	tests := []struct {
+		name    string
+		control func(q *Qemu, args ControlArgs) error
+		command string
+	}{
+		{"stop", (*Qemu).Stop, "system_powerdown"},
+		{"pause", (*Qemu).Pause, "stop"},
+		{"resume", (*Qemu).Resume, "cont"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			server, controlDir := newFakeQMPServer(t, nil)
+			err := tc.control(&Qemu{}, ControlArgs{ControlDir: controlDir})
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"qmp_capabilities", tc.command}, server.received())
+		})
+	}
+}
+
+func TestQMPExecute(t *testing.T) {
+	t.Run("events are skipped", func(t *testing.T) {
+		t.Parallel()
+		_, controlDir := newFakeQMPServer(t, map[string]string{
+			"query-status": `{"event": "RESUME", "timestamp": {"seconds": 1, "microseconds": 2}}` + "\n" +
+				`{"return": {"running": true, "status": "running"}}`,
+		})
+		reply, err := qmpExecute(controlDir, "query-status", nil)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"running": true, "status": "running"}`, string(reply))
+	})
+	t.Run("command error", func(t *testing.T) {
+		t.Parallel()
+		_, controlDir := newFakeQMPServer(t, map[string]string{
+			"cont": `{"error": {"class": "GenericError", "desc": "guest is not paused"}}`,
+		})
+		_, err := qmpExecute(controlDir, "cont", nil)
+		assert.ErrorContains(t, err, "guest is not paused")
+	})
+	t.Run("no socket", func(t *testing.T) {
+		t.Parallel()
+		_, err := qmpExecute(t.TempDir(), "stop", nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestQemuStats(t *testing.T) {
+	t.Parallel()
+	_, controlDir := newFakeQMPServer(t, map[string]string{
+		"query-status": `{"return": {"running": false, "status": "paused"}}`,
+		"query-blockstats": `{"return": [{"device": "", "qdev": "/machine/peripheral/blk0/virtio-backend",
+			"stats": {"rd_bytes": 4096, "wr_bytes": 512, "rd_operations": 8, "wr_operations": 1}}]}`,
+	})
+	q := &Qemu{}
+	stats, err := q.Stats(ControlArgs{ControlDir: controlDir})
+	assert.NoError(t, err)
+	assert.Equal(t, VMStats{
+		Status:  "paused",
+		Running: false,
+		Blocks: []BlockDeviceStat{{
+			Device:     "/machine/peripheral/blk0/virtio-backend",
+			ReadBytes:  4096,
+			WriteBytes: 512,
+			ReadOps:    8,
+			WriteOps:   1,
+		}},
+	}, stats)
+}
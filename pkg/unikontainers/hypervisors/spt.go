@@ -32,10 +32,10 @@ type SPT struct {
 	binary     string
 }
 
-// Stop is an empty function to satisfy VMM interface compatibility requirements.
-// It does not perform any actions and always returns nil.
-func (s *SPT) Stop(_ string) error {
-	return nil
+// Stop sends a SIGTERM to the Solo5 tender. There is no way to notify
+// Solo5 guests for a shutdown, hence this is the most graceful way to stop.
+func (s *SPT) Stop(args ControlArgs) error {
+	return syscall.Kill(args.Pid, syscall.SIGTERM)
 }
 
 // UsesKVM returns a bool value depending on if the monitor uses KVM
@@ -48,6 +48,13 @@ func (s *SPT) Path() string {
 	return s.binaryPath
 }
 
+// GuestExitCode returns the exit status of the Solo5 tender, which is the
+// status that the guest passed to solo5_exit(). In the case of an abort the
+// tender exits with 255.
+func (s *SPT) GuestExitCode(status syscall.WaitStatus, _ unikernels.Unikernel) int {
+	return monitorExitCode(status)
+}
+
 // Ok checks if the spt binary is available in the system's PATH.
 func (s *SPT) Ok() error {
 	if _, err := exec.LookPath(SptBinary); err != nil {
@@ -61,6 +68,9 @@ func (s *SPT) Execve(args ExecArgs, ukernel unikernels.Unikernel) error {
 	sptMem := bytesToStringMB(args.MemSizeB)
 	cmdString := s.binaryPath + " --mem=" + sptMem
 	cmdString = appendNonEmpty(cmdString, " "+ukernel.MonitorNetCli(sptString), args.TapDevice)
+	if len(args.ExtraNetworks) > 0 {
+		vmmLog.Warnf("%s supports a single network device, ignoring %d more", sptString, len(args.ExtraNetworks))
+	}
 	cmdString = appendNonEmpty(cmdString, " "+ukernel.MonitorBlockCli(sptString), args.BlockDevice)
 	cmdString = appendNonEmpty(cmdString, " ", ukernel.MonitorCli(sptString))
 	cmdString += " " + args.UnikernelPath + " " + args.Command
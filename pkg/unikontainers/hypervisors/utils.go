@@ -15,8 +15,12 @@
 package hypervisors
 
 import (
+	"fmt"
 	"runtime"
 	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
 )
 
 func cpuArch() string {
@@ -37,6 +41,17 @@ func appendNonEmpty(body, prefix, value string) string {
 	return body
 }
 
+// openTapCharDevice opens the char device of a macvtap and returns its file
+// descriptor. The descriptor is not closed on exec, hence the monitor inherits
+// it.
+func openTapCharDevice(path string) (int, error) {
+	fd, err := unix.Open(path, unix.O_RDWR, 0)
+	if err != nil {
+		return -1, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return fd, nil
+}
+
 func bytesToMiB(bytes uint64) uint64 {
 	const bytesInMiB = 1024 * 1024
 	return bytes / bytesInMiB
@@ -60,3 +75,13 @@ func bytesToStringMB(argMem uint64) string {
 
 	return stringMem
 }
+
+// monitorExitCode returns the exit code of the monitor process as a shell
+// would report it. If the monitor was killed by a signal, the exit code is
+// 128 plus the signal number.
+func monitorExitCode(status syscall.WaitStatus) int {
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
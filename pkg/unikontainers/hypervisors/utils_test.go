@@ -0,0 +1,36 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hypervisors
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newControlDir returns a control directory as deep as the one of a
+// container under the root of the containerd shim
+// (/run/containerd/runc/k8s.io/<container ID>/control), where the paths of
+// the sockets do not fit in sun_path.
+func newControlDir(t *testing.T) string {
+	t.Helper()
+	controlDir := filepath.Join(t.TempDir(), "runc", "k8s.io", strings.Repeat("f", 64), "control")
+	err := os.MkdirAll(controlDir, 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return controlDir
+}
@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"os/exec"
+	"syscall"
 
 	"github.com/nubificus/urunc/pkg/unikontainers/unikernels"
 	"github.com/sirupsen/logrus"
@@ -28,30 +29,182 @@ const DefaultMemory uint64 = 256 // The default memory for every hypervisor: 256
 // ExecArgs holds the data required by Execve to start the VMM
 // FIXME: add extra fields if required by additional VMM's
 type ExecArgs struct {
-	Container     string   // The container ID
-	UnikernelPath string   // The path of the unikernel inside rootfs
-	TapDevice     string   // The TAP device name
-	BlockDevice   string   // The block device path
-	InitrdPath    string   // The path to the initrd of the unikernel
-	Command       string   // The unikernel's command line
-	IPAddress     string   // The IP address of the TAP device
-	GuestMAC      string   // The MAC address of the guest network device
-	Seccomp       bool     // Enable or disable seccomp filters for the VMM
-	MemSizeB      uint64   // The size of the memory provided to the VM in bytes
-	Environment   []string // Environment
+	Container     string          // The container ID
+	UnikernelPath string          // The path of the unikernel inside rootfs
+	TapDevice     string          // The TAP device name
+	BlockDevice   string          // The block device path
+	InitrdPath    string          // The path to the initrd of the unikernel
+	Command       string          // The unikernel's command line
+	IPAddress     string          // The IP address of the TAP device
+	GuestMAC      string          // The MAC address of the guest network device
+	Seccomp       bool            // Enable or disable seccomp filters for the VMM
+	MemSizeB      uint64          // The size of the memory provided to the VM in bytes
+	VCPUs         uint            // The number of vCPUs of the VM. If 0, the VM gets a single vCPU
+	ControlDir    string          // The directory for the control sockets of the VMM
+	APISocket     bool            // Configure the VMM through its API socket, if supported
+	Environment   []string        // Environment
+	ExtraNetworks []NetArgs       // Additional network devices of the guest, after the one of TapDevice
+	TapCharDevice string          // The char device of the macvtap TapDevice, if any
+	Volumes       []BlockArgs     // Additional block devices of the guest, after the one of BlockDevice
+	SharedDirs    []SharedDirArgs // Directories that get shared with the guest
+}
+
+// BlockArgs describes an additional block device of the guest
+type BlockArgs struct {
+	Path     string // The path of the image or the block device
+	ReadOnly bool   // Attach the block device as read-only
+}
+
+// SharedDirArgs describes a directory that gets shared with the guest
+type SharedDirArgs struct {
+	Tag      string // The tag that the guest uses to mount the directory
+	Path     string // The path of the directory
+	ReadOnly bool   // Share the directory as read-only
+	Socket   string // The vhost-user socket of the virtiofsd that shares the directory over virtio-fs, instead of 9p
+}
+
+// NetArgs describes a network device of the guest
+type NetArgs struct {
+	TapDevice  string // The TAP device name
+	IPAddress  string // The IP address of the guest network device
+	GuestMAC   string // The MAC address of the guest network device
+	CharDevice string // The char device of the macvtap TapDevice, if any
+}
+
+// ControlArgs holds the data required to control a running VMM
+type ControlArgs struct {
+	Container  string // The container ID
+	ControlDir string // The directory of the VMM's control sockets on the host
+	Pid        int    // The PID of the monitor process
 }
 
 type VmmType string
 
 var ErrVMMNotInstalled = errors.New("vmm not found")
+var ErrStopNotSupported = errors.New("graceful stop is not supported")
+var ErrPauseNotSupported = errors.New("pause is not supported")
+var ErrSnapshotNotSupported = errors.New("snapshots are not supported")
+var ErrStatsNotSupported = errors.New("statistics are not supported")
 var vmmLog = logrus.WithField("subsystem", "hypervisors")
 
 type VMM interface {
 	Execve(args ExecArgs, ukernel unikernels.Unikernel) error
-	Stop(t string) error
+	Stop(args ControlArgs) error
 	Path() string
 	UsesKVM() bool
 	Ok() error
+	GuestExitCode(status syscall.WaitStatus, ukernel unikernels.Unikernel) int
+}
+
+// Booter is implemented by the VMMs that need to be configured through their
+// API after they start, in order to boot the guest
+type Booter interface {
+	Boot(args ControlArgs) error
+}
+
+// Snapshotter is implemented by the VMMs that can snapshot a paused guest
+type Snapshotter interface {
+	Snapshot(args ControlArgs, name string) error
+}
+
+// Pauser is implemented by the VMMs that can pause and resume a running guest
+type Pauser interface {
+	Pause(args ControlArgs) error
+	Resume(args ControlArgs) error
+}
+
+// VMStats holds the statistics of a running guest, as reported by the VMM
+type VMStats struct {
+	Status  string            `json:"status"`
+	Running bool              `json:"running"`
+	Blocks  []BlockDeviceStat `json:"blocks,omitempty"`
+}
+
+// BlockDeviceStat holds the I/O statistics of a guest block device
+type BlockDeviceStat struct {
+	Device     string `json:"device"`
+	ReadBytes  uint64 `json:"read_bytes"`
+	WriteBytes uint64 `json:"write_bytes"`
+	ReadOps    uint64 `json:"read_ops"`
+	WriteOps   uint64 `json:"write_ops"`
+}
+
+// StatsReporter is implemented by the VMMs that can report statistics of a
+// running guest
+type StatsReporter interface {
+	Stats(args ControlArgs) (VMStats, error)
+}
+
+// ConfigReporter is implemented by the VMMs that generate a configuration
+// file for the guest. It returns the path of the file on the host, or an
+// empty string if there is no such file.
+type ConfigReporter interface {
+	ConfigFile(args ControlArgs) string
+}
+
+// MaxVCPUs returns the maximum number of vCPUs that a monitor supports, or 0
+// if the monitor does not impose any limit.
+func MaxVCPUs(vmmType VmmType) uint {
+	switch vmmType {
+	case HvtVmm, SptVmm:
+		// Solo5 does not support SMP
+		return 1
+	case FirecrackerVmm:
+		return firecrackerMaxVCPUs
+	default:
+		return 0
+	}
+}
+
+// SupportsTapCharDevices returns true, if the monitor can use the char device
+// of a macvtap as the backend of a guest network device. The rest of the
+// monitors open tap devices only by name.
+func SupportsTapCharDevices(vmmType VmmType) bool {
+	switch vmmType {
+	case QemuVmm, CloudHypervisorVmm:
+		return true
+	default:
+		return false
+	}
+}
+
+// SupportsInitrd returns true, if the monitor can load an initrd for the
+// guest
+func SupportsInitrd(vmmType VmmType) bool {
+	switch vmmType {
+	case QemuVmm, CloudHypervisorVmm, FirecrackerVmm:
+		return true
+	default:
+		return false
+	}
+}
+
+// SupportsMount returns true, if the monitor can pass filesystems of
+// mountType to the guest. Solo5 names its block devices after the ones of
+// the unikernel, hence it does not support any extra devices.
+func SupportsMount(vmmType VmmType, mountType string) bool {
+	switch mountType {
+	case unikernels.MountBlock:
+		return vmmType == QemuVmm || vmmType == CloudHypervisorVmm || vmmType == FirecrackerVmm
+	case unikernels.Mount9P:
+		return vmmType == QemuVmm
+	case unikernels.MountVirtioFS:
+		return vmmType == QemuVmm || vmmType == CloudHypervisorVmm
+	default:
+		return false
+	}
+}
+
+// usesVirtioFS returns true, if any of the directories gets shared over
+// virtio-fs. The vhost-user backend of virtio-fs accesses the memory of the
+// guest, hence the memory needs to be shared.
+func usesVirtioFS(dirs []SharedDirArgs) bool {
+	for _, dir := range dirs {
+		if dir.Socket != "" {
+			return true
+		}
+	}
+	return false
 }
 
 func NewVMM(vmmType VmmType) (vmm VMM, err error) {
@@ -85,6 +238,12 @@ func NewVMM(vmmType VmmType) (vmm VMM, err error) {
 			return nil, ErrVMMNotInstalled
 		}
 		return &Firecracker{binary: FirecrackerBinary, binaryPath: vmmPath}, nil
+	case CloudHypervisorVmm:
+		vmmPath, err := exec.LookPath(CloudHypervisorBinary)
+		if err != nil {
+			return nil, ErrVMMNotInstalled
+		}
+		return &CloudHypervisor{binary: CloudHypervisorBinary, binaryPath: vmmPath}, nil
 	case HedgeVmm:
 		hedge := Hedge{}
 		err := hedge.Ok()
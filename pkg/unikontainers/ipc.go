@@ -23,6 +23,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/nubificus/urunc/internal/unixsock"
 	"github.com/sirupsen/logrus"
 )
 
@@ -45,16 +46,6 @@ func getUruncSockAddr(containerDir string) string {
 	return getSockAddr(containerDir, uruncSock)
 }
 
-func ensureValidSockAddr(sockAddr string) error {
-	if sockAddr == "" {
-		return fmt.Errorf("socket address is empty")
-	}
-	if len(sockAddr) > 108 {
-		return fmt.Errorf("socket address \"%s\" is too long", sockAddr)
-	}
-	return nil
-}
-
 // sockAddrExists returns true if if given sock address exists
 // returns false if any error is encountered
 func SockAddrExists(sockAddr string) bool {
@@ -86,7 +77,7 @@ func SendIPCMessage(socketAddress string, message IPCMessage) error {
 // sendIPCMessageWithRetry attempts to connect to socketAddress. if successful, sends the message and closes the connection
 func sendIPCMessageWithRetry(socketAddress string, message IPCMessage, mustBeValid bool) error {
 	if mustBeValid {
-		err := ensureValidSockAddr(socketAddress)
+		err := unixsock.EnsureValidAddr(socketAddress)
 		if err != nil {
 			return err
 		}
@@ -121,7 +112,7 @@ func sendIPCMessageWithRetry(socketAddress string, message IPCMessage, mustBeVal
 // createListener sets up a listener for new connection to socketAddress
 func CreateListener(socketAddress string, mustBeValid bool) (*net.UnixListener, error) {
 	if mustBeValid {
-		err := ensureValidSockAddr(socketAddress)
+		err := unixsock.EnsureValidAddr(socketAddress)
 		if err != nil {
 			return nil, err
 		}
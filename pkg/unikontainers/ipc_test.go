@@ -40,16 +40,6 @@ func TestGetUruncSockAddr(t *testing.T) {
 	assert.Equal(t, expected, result, "Expected %s, but got %s", expected, result)
 }
 
-func TestEnsureValidSockAddr(t *testing.T) {
-	validSockAddr := "/tmp/valid.sock"
-	emptySockAddr := ""
-	longSockAddr := string(make([]byte, 109))
-
-	assert.NoError(t, ensureValidSockAddr(validSockAddr), "Expected no error for valid socket address")
-	assert.Error(t, ensureValidSockAddr(emptySockAddr), "Expected error for empty socket address")
-	assert.Error(t, ensureValidSockAddr(longSockAddr), "Expected error for long socket address")
-}
-
 func TestSockAddrExists(t *testing.T) {
 	existingSockAddr := "/tmp/existing.sock"
 	nonExistingSockAddr := "/tmp/non_existing.sock"
@@ -0,0 +1,167 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// procStat holds the fields of /proc/<pid>/stat that urunc cares about
+type procStat struct {
+	Pid   int    // The process ID
+	Comm  string // The filename of the executable
+	State byte   // The state of the process (R, S, D, Z, T etc.)
+	PPid  int    // The PID of the parent process
+}
+
+// parseProcStat parses the content of a /proc/<pid>/stat file.
+// The comm field is enclosed in parentheses and might contain spaces or
+// even parentheses, therefore we split on the last closing parenthesis.
+func parseProcStat(data string) (procStat, error) {
+	var stat procStat
+
+	start := strings.IndexByte(data, '(')
+	end := strings.LastIndexByte(data, ')')
+	if start < 0 || end < start {
+		return stat, fmt.Errorf("invalid stat format: missing comm field")
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(data[:start]))
+	if err != nil {
+		return stat, fmt.Errorf("invalid pid in stat: %w", err)
+	}
+	stat.Pid = pid
+	stat.Comm = data[start+1 : end]
+
+	// After comm, the fields are: state ppid pgrp ...
+	fields := strings.Fields(data[end+1:])
+	if len(fields) < 2 {
+		return stat, fmt.Errorf("invalid stat format: too few fields")
+	}
+	if len(fields[0]) != 1 {
+		return stat, fmt.Errorf("invalid process state %q", fields[0])
+	}
+	stat.State = fields[0][0]
+	stat.PPid, err = strconv.Atoi(fields[1])
+	if err != nil {
+		return stat, fmt.Errorf("invalid ppid in stat: %w", err)
+	}
+
+	return stat, nil
+}
+
+// readProcStat reads and parses /proc/<pid>/stat
+func readProcStat(pid int) (procStat, error) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return procStat{}, err
+	}
+	return parseProcStat(string(data))
+}
+
+// pidAlive returns true if a process with the given pid exists and it is
+// not a zombie. A zombie process still replies to signal 0, but it has
+// already exited and it is simply waiting for its parent to reap it.
+func pidAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	if syscall.Kill(pid, syscall.Signal(0)) != nil {
+		return false
+	}
+	stat, err := readProcStat(pid)
+	if err != nil {
+		// We can signal the process, but we can not read its stat.
+		// Assume it is still alive.
+		return true
+	}
+	return stat.State != 'Z' && stat.State != 'X'
+}
+
+// waitPidExit polls until the process with the given pid exits or the timeout
+// expires. It returns true if the process has exited.
+func waitPidExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for pidAlive(pid) {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(waitTime)
+	}
+	return true
+}
+
+// Process describes a process that belongs to a unikernel container
+type Process struct {
+	Pid     int    `json:"pid"`
+	PPid    int    `json:"ppid"`
+	Command string `json:"command"`
+}
+
+// listProcStats returns the stat of every process found in /proc
+func listProcStats() ([]procStat, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]procStat, 0, len(entries))
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := readProcStat(pid)
+		if err != nil {
+			// The process might have exited in the meantime
+			continue
+		}
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+// processTree returns the process with the given pid, followed by all its
+// descendants in breadth-first order.
+func processTree(pid int, stats []procStat) []Process {
+	children := make(map[int][]procStat)
+	var root *procStat
+	for i, stat := range stats {
+		children[stat.PPid] = append(children[stat.PPid], stat)
+		if stat.Pid == pid {
+			root = &stats[i]
+		}
+	}
+	if root == nil {
+		return nil
+	}
+
+	tree := []Process{{Pid: root.Pid, PPid: root.PPid, Command: root.Comm}}
+	queue := []int{root.Pid}
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+		for _, child := range children[parent] {
+			tree = append(tree, Process{Pid: child.Pid, PPid: child.PPid, Command: child.Comm})
+			queue = append(queue, child.Pid)
+		}
+	}
+	return tree
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProcStat(t *testing.T) {
+	t.Run("simple comm", func(t *testing.T) {
+		t.Parallel()
+		stat, err := parseProcStat("1234 (solo5-hvt) S 1200 1234 1234 0 -1 4194560")
+		assert.NoError(t, err)
+		assert.Equal(t, 1234, stat.Pid)
+		assert.Equal(t, "solo5-hvt", stat.Comm)
+		assert.Equal(t, byte('S'), stat.State)
+		assert.Equal(t, 1200, stat.PPid)
+	})
+	t.Run("comm with spaces and parentheses", func(t *testing.T) {
+		t.Parallel()
+		stat, err := parseProcStat("42 (qemu (x) 1) Z 1 42 42 0 -1")
+		assert.NoError(t, err)
+		assert.Equal(t, "qemu (x) 1", stat.Comm)
+		assert.Equal(t, byte('Z'), stat.State)
+		assert.Equal(t, 1, stat.PPid)
+	})
+	t.Run("invalid stat", func(t *testing.T) {
+		t.Parallel()
+		_, err := parseProcStat("42 qemu Z 1")
+		assert.Error(t, err)
+		_, err = parseProcStat("42 (qemu) Z")
+		assert.Error(t, err)
+	})
+}
+
+func TestPidAlive(t *testing.T) {
+	assert.True(t, pidAlive(os.Getpid()), "Expected current process to be alive")
+	assert.False(t, pidAlive(-1), "Expected negative pid to not be alive")
+	assert.False(t, pidAlive(0), "Expected pid 0 to not be alive")
+}
+
+func TestProcessTree(t *testing.T) {
+	stats := []procStat{
+		{Pid: 1, Comm: "init", State: 'S', PPid: 0},
+		{Pid: 10, Comm: "containerd-shim", State: 'S', PPid: 1},
+		{Pid: 20, Comm: "qemu-system-x86", State: 'S', PPid: 10},
+		{Pid: 21, Comm: "virtiofsd", State: 'S', PPid: 20},
+		{Pid: 22, Comm: "virtiofsd", State: 'S', PPid: 21},
+		{Pid: 30, Comm: "other", State: 'S', PPid: 10},
+	}
+
+	t.Run("monitor with children", func(t *testing.T) {
+		t.Parallel()
+		tree := processTree(20, stats)
+		assert.Equal(t, []Process{
+			{Pid: 20, PPid: 10, Command: "qemu-system-x86"},
+			{Pid: 21, PPid: 20, Command: "virtiofsd"},
+			{Pid: 22, PPid: 21, Command: "virtiofsd"},
+		}, tree)
+	})
+	t.Run("monitor not found", func(t *testing.T) {
+		t.Parallel()
+		assert.Nil(t, processTree(99, stats))
+	})
+}
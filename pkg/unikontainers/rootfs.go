@@ -26,6 +26,7 @@ import (
 
 	"golang.org/x/sys/unix"
 
+	"github.com/nubificus/urunc/pkg/network"
 	"github.com/opencontainers/runtime-spec/specs-go"
 )
 
@@ -107,8 +108,9 @@ func changeRoot(rootfsDir string, pivot bool) error {
 
 // prepareMonRootfs prepares the rootfs where the monitor will execute. It
 // essentially sets up the devices (KVM, snapshotter block device) that are required
-// for the guest execution and any other files (e.g. binaries).
-func prepareMonRootfs(monRootfs string, monitorPath string, dmPath string, needsKVM bool, needsTAP bool) error {
+// for the guest execution and any other files (e.g. binaries). The char
+// devices of any macvtap devices of the guest get created too.
+func prepareMonRootfs(monRootfs string, monitorPath string, dmPath string, controlDir string, needsKVM bool, needsTAP bool, tapCharDevices []network.CharDevice) error {
 	err := fileFromHost(monRootfs, monitorPath, "", false)
 	if err != nil {
 		return err
@@ -167,6 +169,16 @@ func prepareMonRootfs(monRootfs string, monitorPath string, dmPath string, needs
 		return err
 	}
 
+	// Expose the control directory of the container to the monitor, in
+	// order to create any control sockets there.
+	if controlDir != "" {
+		dstPath := filepath.Join(monRootfs, monitorControlDir)
+		err = bindMountFile(controlDir, dstPath, "", 0, true)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = setupDev(monRootfs, "/dev/null")
 	if err != nil {
 		return err
@@ -184,6 +196,13 @@ func prepareMonRootfs(monRootfs string, monitorPath string, dmPath string, needs
 		}
 	}
 
+	for _, charDevice := range tapCharDevices {
+		err = setupCharDev(monRootfs, charDevice)
+		if err != nil {
+			return err
+		}
+	}
+
 	if dmPath != "" {
 		err = setupDev(monRootfs, dmPath)
 		if err != nil {
@@ -301,6 +320,30 @@ func setupDev(monRootfs string, devPath string) error {
 	return nil
 }
 
+// setupCharDev creates the node of a char device inside monRootfs. Contrary
+// to setupDev, the node does not need to exist in the host, since the char
+// devices of macvtap devices in other network namespaces might not have a
+// node in the /dev of the host.
+func setupCharDev(monRootfs string, charDevice network.CharDevice) error {
+	dstPath := filepath.Join(monRootfs, charDevice.Path)
+	err := os.MkdirAll(filepath.Dir(dstPath), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", filepath.Dir(dstPath), err)
+	}
+	dev := unix.Mkdev(charDevice.Major, charDevice.Minor)
+	err = unix.Mknod(dstPath, unix.S_IFCHR|0o600, int(dev)) //nolint: gosec
+	if err != nil {
+		return fmt.Errorf("failed to make device node %s: %w", dstPath, err)
+	}
+	// As in setupDev, any user can read/write the device, in order to
+	// support non-root monitor execution
+	err = unix.Chmod(dstPath, 0o666)
+	if err != nil {
+		return fmt.Errorf("failed to chmod %s: %w", dstPath, err)
+	}
+	return nil
+}
+
 // fileFromHost set ups a mirror of file from the host's rootfs inside the
 // container's rootfs. Also, it preserves the permissions and ownership of the
 // file in the host's rootfs.
@@ -0,0 +1,175 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"syscall"
+
+	"github.com/nubificus/urunc/internal/unixsock"
+	"github.com/nubificus/urunc/pkg/unikontainers/hypervisors"
+	"github.com/nubificus/urunc/pkg/unikontainers/unikernels"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// The tag of the shared directory of the rootfs
+	sharedRootfsTag = "rootfs"
+	// The directory of the rootfs of the monitor, where the rootfs of the
+	// container gets mounted once more, in order to share it with the guest
+	// without the files of the monitor
+	monitorSharedRootfsDir = "/.urunc/rootfs"
+
+	virtiofsdBinary     = "virtiofsd"
+	virtiofsdSocketName = "virtiofsd.sock"
+)
+
+// Distributions install virtiofsd out of PATH, since it is meant to be
+// spawned by the monitors
+var virtiofsdPaths = []string{
+	"/usr/libexec/virtiofsd",
+	"/usr/lib/qemu/virtiofsd",
+}
+
+// findVirtiofsd returns the path of the virtiofsd binary
+func findVirtiofsd() (string, error) {
+	path, err := exec.LookPath(virtiofsdBinary)
+	if err == nil {
+		return path, nil
+	}
+	for _, path = range virtiofsdPaths {
+		info, statErr := os.Stat(path)
+		if statErr == nil && !info.IsDir() && info.Mode()&0o111 != 0 {
+			return path, nil
+		}
+	}
+	return "", err
+}
+
+// sharedRootfsType returns how the directory of the rootfs gets shared with
+// the guest, depending on what the unikernel and the monitor support.
+// virtio-fs performs better, but it requires virtiofsd, hence 9p is the
+// fallback.
+func sharedRootfsType(unikernel unikernels.Unikernel, vmmType hypervisors.VmmType) (string, error) {
+	mounter, ok := unikernel.(unikernels.VolumeMounter)
+	if !ok {
+		return "", errors.New("the unikernel does not support a shared rootfs")
+	}
+	supports := func(mountType string) bool {
+		return mounter.SupportsMount(mountType) && hypervisors.SupportsMount(vmmType, mountType)
+	}
+	var virtiofsdErr error
+	if supports(unikernels.MountVirtioFS) {
+		_, virtiofsdErr = findVirtiofsd()
+		if virtiofsdErr == nil {
+			return unikernels.MountVirtioFS, nil
+		}
+	}
+	if supports(unikernels.Mount9P) {
+		return unikernels.Mount9P, nil
+	}
+	if virtiofsdErr != nil {
+		return "", fmt.Errorf("%s is required to share the rootfs over virtio-fs: %w", virtiofsdBinary, virtiofsdErr)
+	}
+	return "", fmt.Errorf("%s and the unikernel do not support a shared rootfs", vmmType)
+}
+
+// setupSharedRootfs mounts the rootfs of the container once more inside the
+// rootfs of the monitor. The mount is not recursive and it is private, hence
+// the mounts of the monitor (e.g. its devices) do not reach the guest.
+func setupSharedRootfs(monRootfs string) error {
+	dstPath := filepath.Join(monRootfs, monitorSharedRootfsDir)
+	err := os.MkdirAll(dstPath, 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dstPath, err)
+	}
+	err = unix.Mount(monRootfs, dstPath, "", unix.MS_BIND, "")
+	if err != nil {
+		return fmt.Errorf("failed to bind mount %s: %w", monRootfs, err)
+	}
+	err = unix.Mount("", dstPath, "", unix.MS_PRIVATE, "")
+	if err != nil {
+		return fmt.Errorf("failed to make %s private: %w", dstPath, err)
+	}
+	return nil
+}
+
+// startVirtiofsd spawns a virtiofsd that shares sharedDir over the vhost-user
+// socket at socketPath. The socket gets created here and virtiofsd inherits
+// it, since the control directory of the container can be too deep for
+// sun_path, which virtiofsd would need in order to bind it. Since the socket
+// already listens, the monitor can connect to it right away. The socket gets
+// owned by uid and gid, in order to let a non-root monitor connect to it.
+//
+// virtiofsd gets its own mount namespace, so that the pivot to the rootfs of
+// the monitor does not affect it. It gets killed along with the monitor
+// through the parent death signal, which the kernel sends when the thread
+// that spawned it exits. Hence, the calling thread gets locked and it has to
+// be the one that execve's the monitor.
+func startVirtiofsd(sharedDir string, socketPath string, readOnly bool, uid uint32, gid uint32) error {
+	virtiofsdPath, err := findVirtiofsd()
+	if err != nil {
+		return fmt.Errorf("%s is required to share the rootfs over virtio-fs: %w", virtiofsdBinary, err)
+	}
+	err = os.Remove(socketPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale socket %s: %w", socketPath, err)
+	}
+	listener, err := unixsock.Listen(socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", socketPath, err)
+	}
+	defer listener.Close()
+	socket, err := listener.File()
+	if err != nil {
+		return fmt.Errorf("failed to get the descriptor of %s: %w", socketPath, err)
+	}
+	defer socket.Close()
+	err = os.Chown(socketPath, int(uid), int(gid))
+	if err != nil {
+		return fmt.Errorf("failed to set owner of %s: %w", socketPath, err)
+	}
+	args := []string{
+		// The first of the extra files of the command
+		"--fd=3",
+		"--shared-dir=" + sharedDir,
+		"--cache=auto",
+		"--log-level=warn",
+	}
+	if readOnly {
+		args = append(args, "--readonly")
+	}
+
+	runtime.LockOSThread()
+	cmd := exec.Command(virtiofsdPath, args...) //nolint: gosec
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{socket}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: unix.CLONE_NEWNS,
+		Pdeathsig:  unix.SIGKILL,
+	}
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("failed to start %s: %w", virtiofsdBinary, err)
+	}
+	uniklog.WithField("pid", cmd.Process.Pid).Debugf("%s shares %s", virtiofsdBinary, sharedDir)
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nubificus/urunc/pkg/unikontainers/hypervisors"
+	"github.com/nubificus/urunc/pkg/unikontainers/unikernels"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSharedRootfsType(t *testing.T) {
+	unikraft, err := unikernels.New(unikernels.UnikraftUnikernel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("9p", func(t *testing.T) {
+		t.Parallel()
+		mountType, err := sharedRootfsType(unikraft, hypervisors.QemuVmm)
+		assert.NoError(t, err)
+		assert.Equal(t, unikernels.Mount9P, mountType)
+	})
+
+	t.Run("unsupported monitor", func(t *testing.T) {
+		t.Parallel()
+		_, err := sharedRootfsType(unikraft, hypervisors.CloudHypervisorVmm)
+		assert.Error(t, err)
+	})
+
+	t.Run("unsupported unikernel", func(t *testing.T) {
+		t.Parallel()
+		mirage, err := unikernels.New(unikernels.MirageUnikernel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = sharedRootfsType(mirage, hypervisors.QemuVmm)
+		assert.Error(t, err)
+	})
+}
+
+func TestRemoveMonitorMountpoints(t *testing.T) {
+	t.Run("volumes and shared rootfs", func(t *testing.T) {
+		t.Parallel()
+		monRootfs := t.TempDir()
+		for _, dir := range []string{monitorSharedRootfsDir, filepath.Join(monitorVolumesDir, "0")} {
+			err := os.MkdirAll(filepath.Join(monRootfs, dir), 0o755)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		assert.NoError(t, removeMonitorMountpoints(monRootfs))
+		assert.NoDirExists(t, filepath.Join(monRootfs, filepath.Dir(monitorVolumesDir)))
+	})
+
+	t.Run("mounted volume", func(t *testing.T) {
+		t.Parallel()
+		monRootfs := t.TempDir()
+		volume := filepath.Join(monRootfs, monitorVolumesDir, "0")
+		err := os.MkdirAll(volume, 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(volume, "data"), []byte("data"), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Error(t, removeMonitorMountpoints(monRootfs))
+		assert.FileExists(t, filepath.Join(volume, "data"))
+	})
+
+	t.Run("no mount points", func(t *testing.T) {
+		t.Parallel()
+		assert.NoError(t, removeMonitorMountpoints(t.TempDir()))
+	})
+}
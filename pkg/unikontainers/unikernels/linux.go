@@ -21,18 +21,29 @@ import (
 
 const LinuxUnikernel string = "linux"
 
+// The filesystem of a block device that urunit mounts, if it is not known
+const linuxDefaultBlockFsType = "ext4"
+
 type Linux struct {
 	App        string
 	Command    string
 	Env        []string
 	Net        LinuxNet
 	RootFsType string
+	Hostname   string
+	Mounts     []MountParams
+	SharedFS   MountParams
 }
 
 type LinuxNet struct {
-	Address string
-	Gateway string
-	Mask    string
+	Address     string
+	Gateway     string
+	Mask        string
+	IPv6        string
+	IPv6Len     int
+	IPv6Gateway string
+	DNS         []string
+	Search      []string
 }
 
 func (l *Linux) CommandString() (string, error) {
@@ -45,14 +56,46 @@ func (l *Linux) CommandString() (string, error) {
 		rootParams := "root=/dev/ram0 rw"
 		rdinit = "rd"
 		bootParams += " " + rootParams
+	} else if l.RootFsType == "shared-fs" {
+		bootParams += " " + linuxSharedRootParams(l.SharedFS)
 	}
 	if l.Net.Address != "" {
-		netParams := fmt.Sprintf("ip=%s::%s:%s:urunc:eth0:off",
+		hostname := l.Hostname
+		if hostname == "" {
+			hostname = "urunc"
+		}
+		netParams := fmt.Sprintf("ip=%s::%s:%s:%s:eth0:off",
 			l.Net.Address,
 			l.Net.Gateway,
-			l.Net.Mask)
+			l.Net.Mask,
+			hostname)
+		// The kernel accepts up to two IPv4 nameservers and exposes
+		// them in /proc/net/pnp, in the format of resolv.conf
+		nameservers := ipv4Addresses(l.Net.DNS, 2)
+		if len(nameservers) > 0 {
+			netParams += ":" + strings.Join(nameservers, ":")
+		}
 		bootParams += " " + netParams
 	}
+	if len(l.Net.Search) > 0 {
+		bootParams += " URUNIT_DNS_SEARCH=" + strings.Join(l.Net.Search, ",")
+	}
+	// The kernel configures only IPv4 addresses through ip=, therefore
+	// urunit configures the IPv6 address of eth0.
+	if l.Net.IPv6 != "" {
+		bootParams += fmt.Sprintf(" URUNIT_IPV6=%s/%d", l.Net.IPv6, l.Net.IPv6Len)
+		if l.Net.IPv6Gateway != "" {
+			bootParams += " URUNIT_IPV6_GW=" + l.Net.IPv6Gateway
+		}
+	}
+	// urunit mounts the volumes, as described in URUNIT_MOUNTS
+	if len(l.Mounts) > 0 {
+		mounts := make([]string, 0, len(l.Mounts))
+		for _, mount := range l.Mounts {
+			mounts = append(mounts, linuxMountEntry(mount))
+		}
+		bootParams += " URUNIT_MOUNTS=" + strings.Join(mounts, ";")
+	}
 	for _, eVar := range l.Env {
 		bootParams += " " + eVar
 	}
@@ -72,6 +115,18 @@ func (l *Linux) SupportsFS(_ string) bool {
 	return true
 }
 
+// SupportsMount returns true for block devices and shared directories over
+// 9p, which urunit mounts, and for shared directories over virtio-fs, which
+// the kernel can mount as its rootfs.
+func (l *Linux) SupportsMount(mountType string) bool {
+	switch mountType {
+	case MountBlock, Mount9P, MountVirtioFS:
+		return true
+	default:
+		return false
+	}
+}
+
 func (l *Linux) MonitorNetCli(_ string) string {
 	return ""
 }
@@ -82,6 +137,8 @@ func (l *Linux) MonitorBlockCli(monitor string) string {
 		bcli := " -device virtio-blk-pci,id=blk0,drive=hd0"
 		bcli += " -drive format=raw,if=none,id=hd0,file="
 		return bcli
+	case "cloud-hypervisor":
+		return " --disk path="
 	default:
 		return ""
 	}
@@ -91,6 +148,9 @@ func (l *Linux) MonitorCli(monitor string) string {
 	switch monitor {
 	case "qemu":
 		return " -no-reboot -serial stdio -nodefaults"
+	case "cloud-hypervisor":
+		// The kernel uses ttyS0 as its console
+		return " --serial tty --console off"
 	default:
 		return ""
 	}
@@ -127,12 +187,85 @@ func (l *Linux) Init(data UnikernelParams) error {
 	l.Net.Address = data.EthDeviceIP
 	l.Net.Gateway = data.EthDeviceGateway
 	l.Net.Mask = data.EthDeviceMask
+	l.Net.IPv6 = data.EthDeviceIPv6
+	l.Net.IPv6Len = data.EthDeviceIPv6Len
+	l.Net.IPv6Gateway = data.EthDeviceIPv6Gw
+	l.Net.DNS = data.DNSServers
+	l.Net.Search = data.DNSSearch
+	l.Hostname = data.Hostname
 
 	l.RootFsType = data.RootFSType
 	l.Env = data.EnvVars
+	l.Mounts = data.Mounts
+	// The block device is the rootfs, unless it gets mounted elsewhere,
+	// on top of an initrd
+	if data.BlockMntPoint != "" && data.BlockMntPoint != "/" {
+		if l.RootFsType != "initrd" {
+			return fmt.Errorf("linux can mount the block device at %s only along with an initrd", data.BlockMntPoint)
+		}
+		fsType := data.BlockFsType
+		if fsType == "" {
+			fsType = linuxDefaultBlockFsType
+		}
+		l.Mounts = append([]MountParams{{
+			Type:        MountBlock,
+			BlockIndex:  0,
+			FsType:      fsType,
+			Destination: data.BlockMntPoint,
+		}}, l.Mounts...)
+	}
+	l.SharedFS = data.SharedFS
 	return nil
 }
 
+// linuxSharedRootParams returns the boot parameters that mount the shared
+// directory of the rootfs as the root of the kernel
+func linuxSharedRootParams(sharedFS MountParams) string {
+	rootParams := "root=" + sharedFS.Source
+	if sharedFS.Type == MountVirtioFS {
+		rootParams += " rootfstype=virtiofs"
+	} else {
+		rootParams += " rootfstype=9p rootflags=trans=virtio,version=9p2000.L"
+	}
+	if sharedFS.ReadOnly {
+		return rootParams + " ro"
+	}
+	return rootParams + " rw"
+}
+
+// linuxMountEntry returns the description of a mount for urunit, in the
+// format <source>:<mount point>:<filesystem>:<options>
+func linuxMountEntry(mount MountParams) string {
+	var source, fsType string
+	var options []string
+	switch mount.Type {
+	case Mount9P:
+		source = mount.Source
+		fsType = "9p"
+		options = append(options, "trans=virtio", "version=9p2000.L")
+	default:
+		source = linuxBlockDevice(mount.BlockIndex)
+		fsType = mount.FsType
+	}
+	if mount.ReadOnly {
+		options = append(options, "ro")
+	} else {
+		options = append(options, "rw")
+	}
+	return strings.Join([]string{source, mount.Destination, fsType, strings.Join(options, ",")}, ":")
+}
+
+// linuxBlockDevice returns the name of the virtio block device with index,
+// as named by Linux (e.g. /dev/vdb for index 1)
+func linuxBlockDevice(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('a'+index%26)) + name
+		index = index/26 - 1
+	}
+	return "/dev/vd" + name
+}
+
 func newLinux() *Linux {
 	linuxStruct := new(Linux)
 	return linuxStruct
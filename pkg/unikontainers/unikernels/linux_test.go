@@ -0,0 +1,186 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikernels
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinuxCommandString(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   UnikernelParams
+		expected string
+	}{
+		{
+			name: "ipv4 only",
+			params: UnikernelParams{
+				CmdLine:          []string{"/urunit", "/app"},
+				RootFSType:       "initrd",
+				EthDeviceIP:      "10.0.0.2",
+				EthDeviceGateway: "10.0.0.1",
+				EthDeviceMask:    "255.255.255.0",
+			},
+			expected: "panic=-1 console=ttyS0 root=/dev/ram0 rw" +
+				" ip=10.0.0.2::10.0.0.1:255.255.255.0:urunc:eth0:off" +
+				" rdinit=/urunit -- /app",
+		},
+		{
+			name: "dns and hostname",
+			params: UnikernelParams{
+				CmdLine:          []string{"/urunit", "/app"},
+				RootFSType:       "initrd",
+				EthDeviceIP:      "10.0.0.2",
+				EthDeviceGateway: "10.0.0.1",
+				EthDeviceMask:    "255.255.255.0",
+				DNSServers:       []string{"fd00::a", "10.96.0.10", "10.96.0.11", "10.96.0.12"},
+				DNSSearch:        []string{"default.svc.cluster.local", "svc.cluster.local"},
+				Hostname:         "web",
+			},
+			expected: "panic=-1 console=ttyS0 root=/dev/ram0 rw" +
+				" ip=10.0.0.2::10.0.0.1:255.255.255.0:web:eth0:off:10.96.0.10:10.96.0.11" +
+				" URUNIT_DNS_SEARCH=default.svc.cluster.local,svc.cluster.local" +
+				" rdinit=/urunit -- /app",
+		},
+		{
+			name: "dual stack",
+			params: UnikernelParams{
+				CmdLine:          []string{"/urunit", "/app"},
+				RootFSType:       "block",
+				EthDeviceIP:      "10.0.0.2",
+				EthDeviceGateway: "10.0.0.1",
+				EthDeviceMask:    "255.255.255.0",
+				EthDeviceIPv6:    "fd00::2",
+				EthDeviceIPv6Len: 64,
+				EthDeviceIPv6Gw:  "fd00::1",
+			},
+			expected: "panic=-1 console=ttyS0 root=/dev/vda rw" +
+				" ip=10.0.0.2::10.0.0.1:255.255.255.0:urunc:eth0:off" +
+				" URUNIT_IPV6=fd00::2/64 URUNIT_IPV6_GW=fd00::1" +
+				" init=/urunit -- /app",
+		},
+		{
+			name: "ipv6 only without gateway",
+			params: UnikernelParams{
+				CmdLine:          []string{"/urunit"},
+				RootFSType:       "block",
+				EthDeviceIPv6:    "fd00::2",
+				EthDeviceIPv6Len: 120,
+			},
+			expected: "panic=-1 console=ttyS0 root=/dev/vda rw" +
+				" URUNIT_IPV6=fd00::2/120" +
+				" init=/urunit -- ",
+		},
+		{
+			name: "volumes",
+			params: UnikernelParams{
+				CmdLine:    []string{"/urunit", "/app"},
+				RootFSType: "block",
+				Mounts: []MountParams{
+					{Type: Mount9P, Source: "vol0", Destination: "/config", ReadOnly: true},
+					{Type: Mount9P, Source: "vol1", Destination: "/cache"},
+					{Type: MountBlock, BlockIndex: 1, FsType: "ext2", Destination: "/data", ReadOnly: true},
+				},
+			},
+			expected: "panic=-1 console=ttyS0 root=/dev/vda rw" +
+				" URUNIT_MOUNTS=vol0:/config:9p:trans=virtio,version=9p2000.L,ro;" +
+				"vol1:/cache:9p:trans=virtio,version=9p2000.L,rw;" +
+				"/dev/vdb:/data:ext2:ro" +
+				" init=/urunit -- /app",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			l := newLinux()
+			err := l.Init(tc.params)
+			assert.NoError(t, err)
+			cmdline, err := l.CommandString()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, cmdline)
+		})
+	}
+}
+
+func TestLinuxBlockMountPoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   UnikernelParams
+		expected string
+		err      string
+	}{
+		{
+			name: "block device as rootfs",
+			params: UnikernelParams{
+				CmdLine:       []string{"/urunit"},
+				RootFSType:    "block",
+				BlockMntPoint: "/",
+			},
+			expected: "panic=-1 console=ttyS0 root=/dev/vda rw init=/urunit -- ",
+		},
+		{
+			name: "block device along with an initrd",
+			params: UnikernelParams{
+				CmdLine:       []string{"/urunit"},
+				RootFSType:    "initrd",
+				BlockMntPoint: "/data",
+				Mounts: []MountParams{
+					{Type: MountBlock, BlockIndex: 1, FsType: "ext2", Destination: "/config", ReadOnly: true},
+				},
+			},
+			expected: "panic=-1 console=ttyS0 root=/dev/ram0 rw" +
+				" URUNIT_MOUNTS=/dev/vda:/data:ext4:rw;/dev/vdb:/config:ext2:ro" +
+				" rdinit=/urunit -- ",
+		},
+		{
+			name: "block device with its filesystem",
+			params: UnikernelParams{
+				CmdLine:       []string{"/urunit"},
+				RootFSType:    "initrd",
+				BlockMntPoint: "/data",
+				BlockFsType:   "ext2",
+			},
+			expected: "panic=-1 console=ttyS0 root=/dev/ram0 rw" +
+				" URUNIT_MOUNTS=/dev/vda:/data:ext2:rw" +
+				" rdinit=/urunit -- ",
+		},
+		{
+			name: "block device without an initrd",
+			params: UnikernelParams{
+				CmdLine:       []string{"/urunit"},
+				RootFSType:    "block",
+				BlockMntPoint: "/data",
+			},
+			err: "linux can mount the block device at /data only along with an initrd",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			l := newLinux()
+			err := l.Init(tc.params)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			cmdline, err := l.CommandString()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, cmdline)
+		})
+	}
+}
@@ -16,11 +16,19 @@ package unikernels
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 )
 
 const MirageUnikernel string = "mirage"
 
+// The name of the block device in the Solo5 manifest of the unikernel, if
+// the image does not set one
+const mirageDefaultBlockName = "storage"
+
+// The names of the devices in Solo5 manifests
+var solo5DeviceName = regexp.MustCompile(`^[A-Za-z0-9_]{1,67}$`)
+
 type Mirage struct {
 	Command string
 	Net     MirageNet
@@ -28,18 +36,26 @@ type Mirage struct {
 }
 
 type MirageNet struct {
-	Address string
-	Gateway string
+	Address     string
+	Gateway     string
+	IPv6        string
+	IPv6Gateway string
+	IPv6Only    string
 }
 
 type MirageBlock struct {
 	RootFS string
+	Name   string
 }
 
 func (m *Mirage) CommandString() (string, error) {
-	return fmt.Sprintf("%s %s %s", m.Net.Address,
-		m.Net.Gateway,
-		m.Command), nil
+	netArgs := m.Net.Address + " " + m.Net.Gateway
+	for _, arg := range []string{m.Net.IPv6, m.Net.IPv6Gateway, m.Net.IPv6Only} {
+		if arg != "" {
+			netArgs += " " + arg
+		}
+	}
+	return fmt.Sprintf("%s %s", netArgs, m.Command), nil
 }
 
 func (m *Mirage) SupportsBlock() bool {
@@ -62,7 +78,11 @@ func (m *Mirage) MonitorNetCli(monitor string) string {
 func (m *Mirage) MonitorBlockCli(monitor string) string {
 	switch monitor {
 	case "hvt", "spt":
-		return "--block:storage="
+		name := m.Block.Name
+		if name == "" {
+			name = mirageDefaultBlockName
+		}
+		return "--block:" + name + "="
 	default:
 		return ""
 	}
@@ -78,6 +98,26 @@ func (m *Mirage) Init(data UnikernelParams) error {
 		m.Net.Address = "--ipv4=" + data.EthDeviceIP + "/24"
 		m.Net.Gateway = "--ipv4-gateway=" + data.EthDeviceGateway
 	}
+	if data.EthDeviceIPv6 != "" {
+		m.Net.IPv6 = fmt.Sprintf("--ipv6=%s/%d", data.EthDeviceIPv6, data.EthDeviceIPv6Len)
+		if data.EthDeviceIPv6Gw != "" {
+			m.Net.IPv6Gateway = "--ipv6-gateway=" + data.EthDeviceIPv6Gw
+		}
+		if data.EthDeviceMask == "" {
+			m.Net.IPv6Only = "--ipv6-only=true"
+		}
+	}
+
+	// Mirage does not mount the block device, but it accesses it by the
+	// name of its manifest. Hence, the mount point names the device.
+	m.Block.Name = mirageDefaultBlockName
+	if data.BlockMntPoint != "" {
+		name := strings.TrimPrefix(data.BlockMntPoint, "/")
+		if !solo5DeviceName.MatchString(name) {
+			return fmt.Errorf("invalid block mount point %s for mirage, expected /<block device name>", data.BlockMntPoint)
+		}
+		m.Block.Name = name
+	}
 
 	m.Command = strings.Join(data.CmdLine, " ")
 
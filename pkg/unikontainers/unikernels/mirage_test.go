@@ -0,0 +1,75 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikernels
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirageBlockMountPoint(t *testing.T) {
+	tests := []struct {
+		name          string
+		blockMntPoint string
+		monitor       string
+		expected      string
+		err           string
+	}{
+		{
+			name:     "default block device",
+			monitor:  "hvt",
+			expected: "--block:storage=",
+		},
+		{
+			name:          "block device named by the mount point",
+			blockMntPoint: "/data",
+			monitor:       "spt",
+			expected:      "--block:data=",
+		},
+		{
+			name:          "unsupported monitor",
+			blockMntPoint: "/data",
+			monitor:       "qemu",
+			expected:      "",
+		},
+		{
+			name:          "nested mount point",
+			blockMntPoint: "/data/disk",
+			err:           "invalid block mount point /data/disk for mirage, expected /<block device name>",
+		},
+		{
+			name:          "root",
+			blockMntPoint: "/",
+			err:           "invalid block mount point / for mirage, expected /<block device name>",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			m := newMirage()
+			err := m.Init(UnikernelParams{
+				CmdLine:       []string{"app"},
+				BlockMntPoint: tc.blockMntPoint,
+			})
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, m.MonitorBlockCli(tc.monitor))
+		})
+	}
+}
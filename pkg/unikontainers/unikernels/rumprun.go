@@ -23,15 +23,26 @@ import (
 const RumprunUnikernel string = "rumprun"
 const SubnetMask125 = "128.0.0.0"
 
+// The mount point of the block device, if the image does not set one
+const rumprunDefaultMountpoint = "/data"
+
+// The block device of Rumprun on top of Solo5. Solo5 passes a single block
+// device to Rumprun, which is the rootfs one of MonitorBlockCli, since Rumprun
+// does not mount any volumes. NetBSD names it ld0 and its partition a
+// covers the whole disk.
+const rumprunBlockDevice = "/dev/ld0a"
+
 type Rumprun struct {
-	Command string     `json:"cmdline"`
-	Net     RumprunNet `json:"net"`
-	Blk     RumprunBlk `json:"blk"`
+	Command  string     `json:"cmdline"`
+	Hostname string     `json:"hostname,omitempty"`
+	Net      RumprunNet `json:"net"`
+	Blk      RumprunBlk `json:"blk"`
 }
 
 type RumprunNoNet struct {
-	Command string     `json:"cmdline"`
-	Blk     RumprunBlk `json:"blk"`
+	Command  string     `json:"cmdline"`
+	Hostname string     `json:"hostname,omitempty"`
+	Blk      RumprunBlk `json:"blk"`
 }
 
 type RumprunCmd struct {
@@ -59,8 +70,9 @@ func (r *Rumprun) CommandString() (string, error) {
 	// if EthDeviceMask is empty, there is no network support. omit every relevant field
 	if r.Net.Mask == "" {
 		tmp := RumprunNoNet{
-			Command: r.Command,
-			Blk:     r.Blk,
+			Command:  r.Command,
+			Hostname: r.Hostname,
+			Blk:      r.Blk,
 		}
 		jsonData, err := json.Marshal(tmp)
 		if err != nil {
@@ -133,12 +145,21 @@ func (r *Rumprun) Init(data UnikernelParams) error {
 		r.Net.Gateway = data.EthDeviceGateway
 	}
 
+	// Rumprun keeps its own rootfs in memory, hence the block device
+	// cannot replace it.
+	mountpoint := data.BlockMntPoint
+	if mountpoint == "" {
+		mountpoint = rumprunDefaultMountpoint
+	} else if mountpoint == "/" {
+		return fmt.Errorf("rumprun cannot mount the block device at %s", mountpoint)
+	}
 	r.Blk.Source = "etfs"
-	r.Blk.Path = "/dev/ld0a"
+	r.Blk.Path = rumprunBlockDevice
 	r.Blk.FsType = "blk"
-	r.Blk.Mountpoint = "/data"
+	r.Blk.Mountpoint = mountpoint
 
 	r.Command = strings.Join(data.CmdLine, " ")
+	r.Hostname = data.Hostname
 
 	return nil
 }
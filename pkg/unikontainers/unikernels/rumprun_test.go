@@ -0,0 +1,63 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikernels
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRumprunBlockMountPoint(t *testing.T) {
+	tests := []struct {
+		name          string
+		blockMntPoint string
+		expected      string
+		err           string
+	}{
+		{
+			name:     "default mount point",
+			expected: `{"cmdline":"app","blk":{"source":"etfs","path":"/dev/ld0a","fstype":"blk","mountpoint":"/data"}}`,
+		},
+		{
+			name:          "custom mount point",
+			blockMntPoint: "/srv/www",
+			expected:      `{"cmdline":"app","blk":{"source":"etfs","path":"/dev/ld0a","fstype":"blk","mountpoint":"/srv/www"}}`,
+		},
+		{
+			name:          "root",
+			blockMntPoint: "/",
+			err:           "rumprun cannot mount the block device at /",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			r := newRumprun()
+			err := r.Init(UnikernelParams{
+				CmdLine:       []string{"app"},
+				BlockMntPoint: tc.blockMntPoint,
+			})
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			cmdline, err := r.CommandString()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, cmdline)
+		})
+	}
+}
@@ -28,16 +28,65 @@ type Unikernel interface {
 	MonitorCli(string) string
 }
 
+// DHCPClient is implemented by the unikernels that get their network
+// configuration over DHCP, instead of their command line.
+type DHCPClient interface {
+	UsesDHCP() bool
+}
+
+// The types of the volumes that a unikernel can mount, besides its rootfs
+const (
+	MountBlock    = "block"    // A block device of the guest with a filesystem
+	Mount9P       = "9p"       // A directory shared over 9p
+	MountVirtioFS = "virtiofs" // A directory shared over virtio-fs
+)
+
+// VolumeMounter is implemented by the unikernels that can mount the volumes
+// of the container.
+type VolumeMounter interface {
+	SupportsMount(mountType string) bool
+}
+
+// MountParams describes a volume that the unikernel mounts
+type MountParams struct {
+	Type        string // The type of the volume (MountBlock, Mount9P or MountVirtioFS)
+	Source      string // The tag of a shared directory
+	BlockIndex  int    // The index of a block device among the block devices of the guest
+	FsType      string // The filesystem of a block device
+	Destination string // The mount point in the guest
+	ReadOnly    bool   // Mount the volume as read-only
+}
+
 // UnikernelParams holds the data required to build the unikernels commandline
 type UnikernelParams struct {
-	CmdLine          []string // The cmdline provided by the image
-	EnvVars          []string // The environment variables provided by the image
-	EthDeviceIP      string   // The eth device IP
-	EthDeviceMask    string   // The eth device mask
-	EthDeviceGateway string   // The eth device gateway
-	RootFSType       string   // The rootfs type of the Unikernel
-	BlockMntPoint    string   // The mount point for the block device
-	Version          string   // The version of the unikernel
+	CmdLine          []string      // The cmdline provided by the image
+	EnvVars          []string      // The environment variables provided by the image
+	EthDeviceIP      string        // The eth device IP
+	EthDeviceMask    string        // The eth device mask
+	EthDeviceGateway string        // The eth device gateway
+	EthDeviceIPv6    string        // The eth device IPv6 address
+	EthDeviceIPv6Len int           // The prefix length of the eth device IPv6 address
+	EthDeviceIPv6Gw  string        // The eth device IPv6 gateway
+	RootFSType       string        // The rootfs type of the Unikernel
+	BlockMntPoint    string        // The mount point for the block device
+	BlockFsType      string        // The filesystem of the block device, if known
+	Version          string        // The version of the unikernel
+	DNSServers       []string      // The nameservers of the container
+	DNSSearch        []string      // The DNS search domains of the container
+	Hostname         string        // The hostname of the container
+	ExtraNetworks    []NetParams   // Additional network devices, in the order of the VMM's devices
+	Mounts           []MountParams // The volumes of the container, besides the rootfs
+	SharedFS         MountParams   // The shared directory of the rootfs, if RootFSType is "shared-fs"
+}
+
+// NetParams holds the configuration of a guest network device
+type NetParams struct {
+	IP          string // The IP of the device
+	Mask        string // The mask of the device
+	Gateway     string // The gateway of the device, if any
+	IPv6        string // The IPv6 address of the device
+	IPv6Len     int    // The prefix length of the IPv6 address
+	IPv6Gateway string // The IPv6 gateway of the device, if any
 }
 
 var ErrNotSupportedUnikernel = errors.New("unikernel is not supported")
@@ -35,6 +35,7 @@ type Unikraft struct {
 	Net     UnikraftNet
 	VFS     UnikraftVFS
 	Version string
+	Mounts  []MountParams
 }
 
 type UnikraftNet struct {
@@ -71,6 +72,12 @@ func (u *Unikraft) SupportsFS(_ string) bool {
 	return false
 }
 
+// SupportsMount returns true for shared directories over 9p, which Unikraft
+// mounts through vfs.fstab.
+func (u *Unikraft) SupportsMount(mountType string) bool {
+	return mountType == Mount9P
+}
+
 // There is no need for any changes here yet.
 func (u *Unikraft) MonitorNetCli(_ string) string {
 	return ""
@@ -81,14 +88,20 @@ func (u *Unikraft) MonitorBlockCli(_ string) string {
 	return ""
 }
 
-// There are no generic CLI hypervisor options for Unikraft yet.
-func (u *Unikraft) MonitorCli(_ string) string {
-	return ""
+func (u *Unikraft) MonitorCli(monitor string) string {
+	switch monitor {
+	case "cloud-hypervisor":
+		// Unikraft prints its output only in the serial console
+		return " --serial tty --console off"
+	default:
+		return ""
+	}
 }
 
 func (u *Unikraft) Init(data UnikernelParams) error {
 	u.Env = data.EnvVars
 	u.Version = data.Version
+	u.Mounts = data.Mounts
 	// We use the first argument in the CLI args as the app name and the
 	// rest as its arguments.
 	switch len(data.CmdLine) {
@@ -103,34 +116,77 @@ func (u *Unikraft) Init(data UnikernelParams) error {
 		u.Command = strings.Join(data.CmdLine[1:], " ")
 	}
 
-	return u.configureUnikraftArgs(data.RootFSType, data.EthDeviceIP, data.EthDeviceGateway, data.EthDeviceMask)
+	return u.configureUnikraftArgs(data)
 }
 
-func (u *Unikraft) configureUnikraftArgs(rootFsType, ethDeviceIP, ethDeviceGateway, ethDeviceMask string) error {
+// configureUnikraftArgs sets the network and VFS arguments of the unikernel.
+// Only the versions that use netdev.ip can configure more than one network
+// device, the nameservers and the hostname.
+func (u *Unikraft) configureUnikraftArgs(data UnikernelParams) error {
+	rootFsType := data.RootFSType
+	ethDeviceIP := data.EthDeviceIP
+	ethDeviceGateway := data.EthDeviceGateway
+	ethDeviceMask := data.EthDeviceMask
 	setCompatArgs := func() {
 		u.Net.Address = "netdev.ipv4_addr=" + ethDeviceIP
 		u.Net.Gateway = "netdev.ipv4_gw_addr=" + ethDeviceGateway
 		u.Net.Mask = "netdev.ipv4_subnet_mask=" + ethDeviceMask
 		// TODO: We need to add support for actual block devices (e.g. virtio-blk)
-		// and sharedfs or any other Unikraft related ways to pass data to guest.
+		// or any other Unikraft related ways to pass data to guest.
 		if rootFsType == "initrd" {
 			u.VFS.RootFS = "vfs.rootfs=" + "initrd"
+		} else if rootFsType == "shared-fs" && data.SharedFS.Type == Mount9P {
+			u.VFS.RootFS = "vfs.rootfs=9pfs vfs.rootdev=" + data.SharedFS.Source
 		} else {
 			u.VFS.RootFS = ""
 		}
 	}
 
 	setCurrentArgs := func() {
-		u.Net.Address = "netdev.ip=" + ethDeviceIP + "/24:" + ethDeviceGateway + ":8.8.8.8"
+		// netdev.ip accepts only IPv4 addresses. The IPv6 address of
+		// an IPv6 only device does not get passed to the unikernel, which
+		// has to rely on stateless autoconfiguration instead.
+		u.Net.Address = ""
+		if ethDeviceIP != "" {
+			domain := ""
+			if len(data.DNSSearch) > 0 {
+				domain = data.DNSSearch[0]
+			}
+			primary := NetParams{IP: ethDeviceIP, Mask: ethDeviceMask, Gateway: ethDeviceGateway}
+			nameservers := ipv4Addresses(data.DNSServers, 2)
+			u.Net.Address = "netdev.ip=" + unikraftNetdevIP(primary, nameservers, data.Hostname, domain)
+		}
+		if len(data.ExtraNetworks) > 0 && ethDeviceIP != "" {
+			// netdev.ip is an array with an entry for every device
+			addresses := []string{strings.TrimPrefix(u.Net.Address, "netdev.ip=")}
+			for _, extraNet := range data.ExtraNetworks {
+				// The entries match the devices by position
+				if extraNet.IP == "" {
+					break
+				}
+				addresses = append(addresses, unikraftNetdevIP(extraNet, nil, "", ""))
+			}
+			u.Net.Address = "netdev.ip=[ " + strings.Join(addresses, " ") + " ]"
+		}
 		// TODO: We need to add support for actual block devices (e.g. virtio-blk)
-		// and sharedfs or any other Unikraft related ways to pass data to guest.
+		// or any other Unikraft related ways to pass data to guest.
+		// TODO: This needs better handling. We need to revisit this
+		// when we better understand all the available options for
+		// passing info inside unikraft unikernels.
+		var fstab []string
 		if rootFsType == "initrd" {
-			// TODO: This needs better handling. We need to revisit this
-			// when we better understand all the available options for
-			// passing info inside unikraft unikernels.
-			u.VFS.RootFS = "vfs.fstab=[ \"initrd0:/:extract:::\" ]"
-		} else {
-			u.VFS.RootFS = ""
+			fstab = append(fstab, "\"initrd0:/:extract:::\"")
+		} else if rootFsType == "shared-fs" && data.SharedFS.Type == Mount9P {
+			fstab = append(fstab, fmt.Sprintf("\"%s:/:9pfs:::\"", data.SharedFS.Source))
+		}
+		for _, mount := range u.Mounts {
+			if mount.Type == Mount9P {
+				fstab = append(fstab, fmt.Sprintf("\"%s:%s:9pfs:::\"", mount.Source, mount.Destination))
+			}
+		}
+		u.VFS.RootFS = ""
+		if len(fstab) > 0 {
+			u.VFS.RootFS = "vfs.fstab=[ " + strings.Join(fstab, " ") + " ]"
 		}
 	}
 
@@ -158,6 +214,22 @@ func (u *Unikraft) configureUnikraftArgs(rootFsType, ethDeviceIP, ethDeviceGatew
 	return nil
 }
 
+// unikraftNetdevIP returns the netdev.ip entry of a network device in the
+// form of <IP>/<prefix length>:<gateway>:<dns0>:<dns1>:<hostname>:<domain>,
+// without the empty trailing fields.
+func unikraftNetdevIP(net NetParams, nameservers []string, hostname string, domain string) string {
+	cidr, err := subnetMaskToCIDR(net.Mask)
+	if err != nil {
+		cidr = 24
+	}
+	fields := []string{fmt.Sprintf("%s/%d", net.IP, cidr), net.Gateway, "", "", hostname, domain}
+	copy(fields[2:4], nameservers)
+	for fields[len(fields)-1] == "" {
+		fields = fields[:len(fields)-1]
+	}
+	return strings.Join(fields, ":")
+}
+
 func newUnikraft() *Unikraft {
 	unikraftStruct := new(Unikraft)
 	return unikraftStruct
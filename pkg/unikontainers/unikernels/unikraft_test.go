@@ -0,0 +1,94 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikernels
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnikraftCommandString(t *testing.T) {
+	network := UnikernelParams{
+		CmdLine:          []string{"nginx", "-c", "/nginx/conf/nginx.conf"},
+		Version:          "0.17.0",
+		EthDeviceIP:      "10.0.0.2",
+		EthDeviceGateway: "10.0.0.1",
+		EthDeviceMask:    "255.255.255.0",
+	}
+	withDNS := network
+	withDNS.DNSServers = []string{"fd00::a", "10.96.0.10", "10.96.0.11", "10.96.0.12"}
+	withDNS.DNSSearch = []string{"default.svc.cluster.local", "svc.cluster.local"}
+	withDNS.Hostname = "web"
+	withHostname := network
+	withHostname.Hostname = "web"
+	withExtraNetworks := network
+	withExtraNetworks.ExtraNetworks = []NetParams{
+		{IP: "172.16.2.3", Mask: "255.255.255.0"},
+		{IP: ""},
+	}
+	compat := network
+	compat.Version = "0.16.0"
+	compat.RootFSType = "initrd"
+	compat.Hostname = "web"
+
+	tests := []struct {
+		name     string
+		params   UnikernelParams
+		expected string
+	}{
+		{
+			name:   "without dns",
+			params: network,
+			expected: "nginx  netdev.ip=10.0.0.2/24:10.0.0.1    " +
+				"-- -c /nginx/conf/nginx.conf",
+		},
+		{
+			name:   "dns, hostname and domain",
+			params: withDNS,
+			expected: "nginx  netdev.ip=10.0.0.2/24:10.0.0.1:10.96.0.10:10.96.0.11:web:default.svc.cluster.local    " +
+				"-- -c /nginx/conf/nginx.conf",
+		},
+		{
+			name:   "hostname without dns",
+			params: withHostname,
+			expected: "nginx  netdev.ip=10.0.0.2/24:10.0.0.1:::web    " +
+				"-- -c /nginx/conf/nginx.conf",
+		},
+		{
+			name:   "extra networks",
+			params: withExtraNetworks,
+			expected: "nginx  netdev.ip=[ 10.0.0.2/24:10.0.0.1 172.16.2.3/24 ]    " +
+				"-- -c /nginx/conf/nginx.conf",
+		},
+		{
+			name:   "compat version",
+			params: compat,
+			expected: "nginx  netdev.ipv4_addr=10.0.0.2 netdev.ipv4_gw_addr=10.0.0.1 " +
+				"netdev.ipv4_subnet_mask=255.255.255.0 vfs.rootfs=initrd -- -c /nginx/conf/nginx.conf",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			u := newUnikraft()
+			err := u.Init(tc.params)
+			assert.NoError(t, err)
+			cmdline, err := u.CommandString()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, cmdline)
+		})
+	}
+}
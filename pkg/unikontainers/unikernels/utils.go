@@ -16,6 +16,7 @@ package unikernels
 
 import (
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 )
@@ -40,3 +41,18 @@ func subnetMaskToCIDR(subnetMask string) (int, error) {
 
 	return cidr, nil
 }
+
+// ipv4Addresses returns up to limit IPv4 addresses of addresses
+func ipv4Addresses(addresses []string, limit int) []string {
+	var ipv4 []string
+	for _, address := range addresses {
+		if len(ipv4) == limit {
+			break
+		}
+		ip := net.ParseIP(address)
+		if ip != nil && ip.To4() != nil {
+			ipv4 = append(ipv4, address)
+		}
+	}
+	return ipv4
+}
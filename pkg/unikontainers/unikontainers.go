@@ -16,6 +16,7 @@ package unikontainers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -28,6 +29,7 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/nubificus/urunc/pkg/network"
 	"github.com/nubificus/urunc/pkg/unikontainers/hypervisors"
@@ -36,6 +38,7 @@ import (
 	"golang.org/x/sys/unix"
 
 	"github.com/nubificus/urunc/internal/constants"
+	"github.com/nubificus/urunc/internal/fsutil"
 	m "github.com/nubificus/urunc/internal/metrics"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/sirupsen/logrus"
@@ -43,17 +46,45 @@ import (
 
 var uniklog = logrus.WithField("subsystem", "unikontainers")
 
+const (
+	defaultStopTimeout = 10 * time.Second
+	killWaitTimeout    = 2 * time.Second
+	// The interval in which the supervisor checks whether the monitor
+	// process has set up the networks of the unikernel
+	networkPollInterval = 50 * time.Millisecond
+)
+
+// StatePaused is the status of a container whose guest is paused. It is not
+// part of the OCI runtime spec, but it is reported by runc as well.
+const StatePaused specs.ContainerState = "paused"
+
 var ErrQueueProxy = errors.New("this a queue proxy container")
 var ErrNotUnikernel = errors.New("this is not a unikernel container")
 
 // Unikontainer holds the data necessary to create, manage and delete unikernel containers
 type Unikontainer struct {
 	State   *specs.State
+	Runtime *RuntimeState
 	Spec    *specs.Spec
 	BaseDir string
 	RootDir string
 }
 
+// RuntimeState holds urunc specific information about the container, which
+// is not part of the OCI state, but needs to persist across urunc invocations.
+type RuntimeState struct {
+	ExitCode *int                           `json:"exitCode,omitempty"` // The exit code of the guest
+	Cgroup   *CgroupState                   `json:"cgroup,omitempty"`   // The cgroup of the container
+	Networks []network.UnikernelNetworkInfo `json:"networks,omitempty"` // The networks of the unikernel, one per guest device
+}
+
+// containerState is the content of state.json. It extends the OCI state
+// with the urunc specific runtime information.
+type containerState struct {
+	specs.State
+	Runtime RuntimeState `json:"urunc"`
+}
+
 // New parses the bundle and creates a new Unikontainer object
 func New(bundlePath string, containerID string, rootDir string) (*Unikontainer, error) {
 	spec, err := loadSpec(bundlePath)
@@ -93,6 +124,7 @@ func New(bundlePath string, containerID string, rootDir string) (*Unikontainer,
 		RootDir: rootDir,
 		Spec:    spec,
 		State:   state,
+		Runtime: &RuntimeState{},
 	}, nil
 }
 
@@ -108,7 +140,8 @@ func Get(containerID string, rootDir string) (*Unikontainer, error) {
 	if state.Annotations[annotType] == "" {
 		return nil, ErrNotUnikernel
 	}
-	u.State = state
+	u.State = &state.State
+	u.Runtime = &state.Runtime
 
 	spec, err := loadSpec(state.Bundle)
 	if err != nil {
@@ -120,6 +153,60 @@ func Get(containerID string, rootDir string) (*Unikontainer, error) {
 	return u, nil
 }
 
+// List retrieves all the unikernel containers that have their state under
+// rootDir. Containers that are not unikernels or whose state can not be
+// loaded are skipped.
+func List(rootDir string) ([]*Unikontainer, error) {
+	entries, err := os.ReadDir(rootDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var unikontainers []*Unikontainer
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		u, err := Get(entry.Name(), rootDir)
+		if err != nil {
+			if !errors.Is(err, ErrNotUnikernel) {
+				uniklog.WithError(err).WithField("id", entry.Name()).Warn("failed to load container state")
+			}
+			continue
+		}
+		unikontainers = append(unikontainers, u)
+	}
+	return unikontainers, nil
+}
+
+// UnikernelType returns the type of the unikernel as defined in the
+// urunc annotations
+func (u *Unikontainer) UnikernelType() string {
+	return u.State.Annotations[annotType]
+}
+
+// Hypervisor returns the hypervisor of the unikernel as defined in the
+// urunc annotations
+func (u *Unikontainer) Hypervisor() string {
+	return u.State.Annotations[annotHypervisor]
+}
+
+// Processes returns the monitor process of the unikernel along with all
+// its children.
+func (u *Unikontainer) Processes() ([]Process, error) {
+	if !u.isRunning() {
+		return nil, fmt.Errorf("unikernel %s is not running", u.State.ID)
+	}
+	stats, err := listProcStats()
+	if err != nil {
+		return nil, err
+	}
+	return processTree(u.State.Pid, stats), nil
+}
+
 // InitialSetup sets the Unikernel status as creating,
 // creates the Unikernel base directory and
 // saves the state.json file with the current Unikernel state
@@ -145,6 +232,42 @@ func (u *Unikontainer) Create(pid int) error {
 	return u.saveContainerState()
 }
 
+// SetRunning sets the Unikernel status as running and saves the state.
+// It should be called only after the reexec process has been notified
+// to execve the monitor.
+func (u *Unikontainer) SetRunning() error {
+	return u.setStatus(specs.StateRunning)
+}
+
+func (u *Unikontainer) setStatus(status specs.ContainerState) error {
+	return u.updateState(func(state *specs.State, _ *RuntimeState) {
+		state.Status = status
+	})
+}
+
+// RefreshStatus probes the monitor process and updates the status of the
+// Unikernel according to the OCI runtime spec. If the monitor has exited,
+// the status is set to stopped and it is saved in state.json.
+func (u *Unikontainer) RefreshStatus() (specs.ContainerState, error) {
+	switch u.State.Status {
+	case specs.StateCreated, specs.StateRunning, StatePaused:
+		if u.isRunning() {
+			return u.State.Status, nil
+		}
+		uniklog.WithFields(logrus.Fields{
+			"id":  u.State.ID,
+			"pid": u.State.Pid,
+		}).Debug("monitor process has exited")
+		err := u.updateState(func(state *specs.State, _ *RuntimeState) {
+			state.Status = specs.StateStopped
+		})
+		if err != nil {
+			return u.State.Status, err
+		}
+	}
+	return u.State.Status, nil
+}
+
 func (u *Unikontainer) Exec() error {
 	// FIXME: We need to find a way to set the output file
 	var metrics = m.NewZerologMetrics(constants.TimestampTargetFile)
@@ -155,20 +278,15 @@ func (u *Unikontainer) Exec() error {
 	unikernelVersion := u.State.Annotations[annotVersion]
 	unikernelPath := u.State.Annotations[annotBinary]
 	initrdPath := u.State.Annotations[annotInitrd]
+	blockMntPoint := u.State.Annotations[annotBlockMntPoint]
+	err := validateBlockMntPoint(blockMntPoint)
+	if err != nil {
+		return err
+	}
 
-	// Make sure paths are clean
-	bundleDir := filepath.Clean(u.State.Bundle)
-	rootfsDir := filepath.Clean(u.Spec.Root.Path)
-	if !filepath.IsAbs(rootfsDir) {
-		if filepath.IsAbs(bundleDir) {
-			rootfsDir = filepath.Join(bundleDir, rootfsDir)
-		} else {
-			bundleAbsDir, err := filepath.Abs(bundleDir)
-			if err != nil {
-				return err
-			}
-			rootfsDir = filepath.Join(bundleAbsDir, rootfsDir)
-		}
+	rootfsDir, err := u.rootfsDir()
+	if err != nil {
+		return err
 	}
 
 	// populate vmm args
@@ -191,6 +309,12 @@ func (u *Unikontainer) Exec() error {
 		}
 	}
 
+	vcpus, err := u.getVCPUs(hypervisors.VmmType(vmmType))
+	if err != nil {
+		return err
+	}
+	vmmArgs.VCPUs = vcpus
+
 	// Check if container is set to unconfined -- disable seccomp
 	if u.Spec.Linux.Seccomp == nil {
 		uniklog.Warn("Seccomp is disabled")
@@ -217,22 +341,74 @@ func (u *Unikontainer) Exec() error {
 	// handle network
 	networkType := u.getNetworkType()
 	uniklog.WithField("network type", networkType).Debug("Retrieved network type")
-	netManager, err := network.NewNetworkManager(networkType)
+	netManager, err := u.newNetworkManager(networkType)
 	if err != nil {
 		uniklog.Errorf("Failed to create network manager: %v", err)
 		return err
 	}
-	networkInfo, err := netManager.NetworkSetup(u.Spec.Process.User.UID, u.Spec.Process.User.GID)
+	ifaces, err := network.DiscoverInterfaces(u.getNetInterfaces())
 	if err != nil {
-		uniklog.Errorf("Failed to setup network :%v. Possibly due to ctr", err)
+		return fmt.Errorf("failed to discover network interfaces: %w", err)
+	}
+	if len(ifaces) == 0 {
+		uniklog.Warn("no network interface found, assuming unikernel was spawned using ctr")
+	}
+	if networkType == "macvtap" && len(ifaces) > 0 && !hypervisors.SupportsTapCharDevices(hypervisors.VmmType(vmmType)) {
+		return fmt.Errorf("%s does not support macvtap network devices", vmmType)
+	}
+	if networkType == "static" && len(ifaces) > 1 {
+		uniklog.Warnf("static network supports a single interface, ignoring %v", ifaces[1:])
+		ifaces = ifaces[:1]
+	}
+	rateLimit, err := u.getRateLimit()
+	if err != nil {
+		return err
+	}
+	networks := make([]network.UnikernelNetworkInfo, 0, len(ifaces))
+	for _, iface := range ifaces {
+		networkInfo, err := netManager.NetworkSetup(u.Spec.Process.User.UID, u.Spec.Process.User.GID, iface)
+		if err != nil {
+			cleanupNetworks(networks)
+			return fmt.Errorf("failed to setup network for %s: %w", iface, err)
+		}
+		networks = append(networks, *networkInfo)
+	}
+	// As with the bandwidth plugin of CNI, the limits apply only to the
+	// first interface, which is the interface of the default route, unless
+	// the interfaces were set explicitly.
+	if len(networks) > 0 && rateLimit != (network.RateLimit{}) {
+		err = network.ApplyRateLimit(&networks[0], rateLimit)
+		if err != nil {
+			cleanupNetworks(networks)
+			return fmt.Errorf("failed to limit the bandwidth of %s: %w", networks[0].TapDevice, err)
+		}
 	}
 	metrics.Capture(u.State.ID, "TS16")
 
 	withTUNTAP := false
-	// if network info is nil, we didn't find eth0, so we are running with ctr
-	if networkInfo != nil {
-		withTUNTAP = true
+	var tapCharDevices []network.CharDevice
+	for _, networkInfo := range networks {
+		if networkInfo.TapCharDevice != nil {
+			tapCharDevices = append(tapCharDevices, *networkInfo.TapCharDevice)
+		} else {
+			withTUNTAP = true
+		}
+	}
+	// if there are no networks, there was no interface, so we are running with ctr
+	if len(networks) > 0 {
+		err = u.updateState(func(_ *specs.State, runtime *RuntimeState) {
+			runtime.Networks = networks
+		})
+		if err != nil {
+			cleanupNetworks(networks)
+			return fmt.Errorf("failed to save network allocation: %w", err)
+		}
+		// The first interface becomes the first network device of the guest
+		networkInfo := networks[0]
 		vmmArgs.TapDevice = networkInfo.TapDevice
+		if networkInfo.TapCharDevice != nil {
+			vmmArgs.TapCharDevice = networkInfo.TapCharDevice.Path
+		}
 		vmmArgs.IPAddress = networkInfo.EthDevice.IP
 		// The MAC address for the guest network device is the same as the
 		// ethernet device inside the namespace
@@ -240,6 +416,34 @@ func (u *Unikontainer) Exec() error {
 		unikernelParams.EthDeviceIP = networkInfo.EthDevice.IP
 		unikernelParams.EthDeviceMask = networkInfo.EthDevice.Mask
 		unikernelParams.EthDeviceGateway = networkInfo.EthDevice.DefaultGateway
+		unikernelParams.EthDeviceIPv6 = networkInfo.EthDevice.IPv6
+		unikernelParams.EthDeviceIPv6Len = networkInfo.EthDevice.IPv6PrefixLen
+		unikernelParams.EthDeviceIPv6Gw = networkInfo.EthDevice.IPv6Gateway
+		for _, extraInfo := range networks[1:] {
+			extraNet := hypervisors.NetArgs{
+				TapDevice: extraInfo.TapDevice,
+				IPAddress: extraInfo.EthDevice.IP,
+				GuestMAC:  extraInfo.EthDevice.MAC,
+			}
+			if extraInfo.TapCharDevice != nil {
+				extraNet.CharDevice = extraInfo.TapCharDevice.Path
+			}
+			vmmArgs.ExtraNetworks = append(vmmArgs.ExtraNetworks, extraNet)
+			unikernelParams.ExtraNetworks = append(unikernelParams.ExtraNetworks, unikernels.NetParams{
+				IP:          extraInfo.EthDevice.IP,
+				Mask:        extraInfo.EthDevice.Mask,
+				Gateway:     extraInfo.EthDevice.DefaultGateway,
+				IPv6:        extraInfo.EthDevice.IPv6,
+				IPv6Len:     extraInfo.EthDevice.IPv6PrefixLen,
+				IPv6Gateway: extraInfo.EthDevice.IPv6Gateway,
+			})
+		}
+		nameservers, search, err := readResolvConf(resolvConfPath(u.Spec, rootfsDir))
+		if err != nil {
+			uniklog.WithError(err).Warn("failed to read the DNS configuration")
+		}
+		unikernelParams.DNSServers = nameservers
+		unikernelParams.DNSSearch = search
 	} else {
 		vmmArgs.TapDevice = ""
 		vmmArgs.IPAddress = ""
@@ -247,6 +451,7 @@ func (u *Unikontainer) Exec() error {
 		unikernelParams.EthDeviceMask = ""
 		unikernelParams.EthDeviceGateway = ""
 	}
+	unikernelParams.Hostname = u.Spec.Hostname
 
 	if initrdPath != "" {
 		unikernelParams.RootFSType = "initrd"
@@ -273,7 +478,62 @@ func (u *Unikontainer) Exec() error {
 			u.State.Annotations[annotUseDMBlock])
 		useDevmapper = true
 	}
-	if u.State.Annotations[annotBlock] != "" && unikernel.SupportsBlock() {
+	// The rootfs mode takes precedence over the block device of the
+	// annotation and over devmapper
+	rootfsMode := u.State.Annotations[annotRootfsMode]
+	rootfsImage := ""
+	rootfsInitrdPath := ""
+	switch rootfsMode {
+	case "":
+	case rootfsModeSharedFS:
+		mountType, err := sharedRootfsType(unikernel, hypervisors.VmmType(vmmType))
+		if err != nil {
+			return err
+		}
+		unikernelParams.RootFSType = "shared-fs"
+		unikernelParams.SharedFS = unikernels.MountParams{
+			Type:        mountType,
+			Source:      sharedRootfsTag,
+			Destination: "/",
+			ReadOnly:    u.Spec.Root.Readonly,
+		}
+		sharedRootfs := hypervisors.SharedDirArgs{
+			Tag:      sharedRootfsTag,
+			Path:     monitorSharedRootfsDir,
+			ReadOnly: u.Spec.Root.Readonly,
+		}
+		if mountType == unikernels.MountVirtioFS {
+			sharedRootfs.Socket = filepath.Join(monitorControlDir, virtiofsdSocketName)
+		}
+		vmmArgs.SharedDirs = append(vmmArgs.SharedDirs, sharedRootfs)
+		useDevmapper = false
+	case rootfsModeBlock:
+		if !unikernel.SupportsBlock() || !unikernel.SupportsFS("ext2") {
+			return errors.New("the unikernel does not support an ext2 block device as its rootfs")
+		}
+		rootfsImage, err = u.buildRootfsImage(rootfsDir)
+		if err != nil {
+			return err
+		}
+		vmmArgs.BlockDevice = monitorRootfsImage
+		unikernelParams.RootFSType = "block"
+		unikernelParams.BlockFsType = "ext2"
+		useDevmapper = false
+	case rootfsModeInitrd:
+		if !hypervisors.SupportsInitrd(hypervisors.VmmType(vmmType)) {
+			return fmt.Errorf("%s does not support an initrd", vmmType)
+		}
+		rootfsInitrdPath, err = rootfsInitrd(rootfsDir, unikernelPath, u.State.Annotations[annotInitrdCompression])
+		if err != nil {
+			return err
+		}
+		vmmArgs.InitrdPath = monitorRootfsInitrd
+		unikernelParams.RootFSType = "initrd"
+		useDevmapper = false
+	default:
+		return fmt.Errorf("invalid %s annotation %q", annotRootfsMode, rootfsMode)
+	}
+	if u.State.Annotations[annotBlock] != "" && unikernel.SupportsBlock() && rootfsMode == "" {
 		vmmArgs.BlockDevice = u.State.Annotations[annotBlock]
 		unikernelParams.RootFSType = "block"
 	}
@@ -291,9 +551,34 @@ func (u *Unikontainer) Exec() error {
 			}
 			vmmArgs.BlockDevice = rootFsDevice.Device
 			unikernelParams.RootFSType = "block"
+			unikernelParams.BlockFsType = rootFsDevice.FsType
 			dmPath = rootFsDevice.Device
 		}
 	}
+	if vmmArgs.BlockDevice != "" {
+		unikernelParams.BlockMntPoint = blockMntPoint
+		// The block device gets mounted on top of the rootfs of the initrd
+		if blockMntPoint != "" && blockMntPoint != "/" && vmmArgs.InitrdPath != "" {
+			unikernelParams.RootFSType = "initrd"
+		}
+	} else if blockMntPoint != "" {
+		return fmt.Errorf("%s annotation %q is set, but no block device gets attached to the unikernel", annotBlockMntPoint, blockMntPoint)
+	}
+
+	// handle volumes
+	// The block devices of the volumes follow the one of the rootfs
+	firstBlockIndex := 0
+	if vmmArgs.BlockDevice != "" {
+		firstBlockIndex = 1
+	}
+	volumes, err := u.planVolumes(unikernel, hypervisors.VmmType(vmmType), firstBlockIndex)
+	if err != nil {
+		return err
+	}
+	volumeBlocks, volumeDirs, guestMounts := volumeArgs(volumes)
+	vmmArgs.Volumes = volumeBlocks
+	vmmArgs.SharedDirs = append(vmmArgs.SharedDirs, volumeDirs...)
+	unikernelParams.Mounts = guestMounts
 	metrics.Capture(u.State.ID, "TS17")
 
 	// get a new vmm
@@ -316,17 +601,6 @@ func (u *Unikontainer) Exec() error {
 	}
 	vmmArgs.Command = unikernelCmd
 
-	// update urunc.json state
-	// TODO: Move this somewhere else. We are not yet running and
-	// maybe we need to make sure the monitor started correctly before
-	// setting this to running.
-	// For example, we can move it to the Start command.
-	u.State.Status = "running"
-	err = u.saveContainerState()
-	if err != nil {
-		return err
-	}
-
 	// execute hooks
 	// TODO: Check when to run this hook. For sure we need to run it in the
 	// container's namespace, but after/before pivot, user setup, etc.?
@@ -342,13 +616,62 @@ func (u *Unikontainer) Exec() error {
 		return err
 	}
 
+	// Create the directory for the control sockets of the monitor. The
+	// monitor might run as a non-root user, hence it needs to own it.
+	controlDir := u.ControlDir()
+	err = os.MkdirAll(controlDir, 0o700)
+	if err != nil {
+		return fmt.Errorf("failed to create control directory: %w", err)
+	}
+	err = os.Chown(controlDir, int(u.Spec.Process.User.UID), int(u.Spec.Process.User.GID))
+	if err != nil {
+		return fmt.Errorf("failed to set owner of control directory: %w", err)
+	}
+	vmmArgs.ControlDir = monitorControlDir
+	vmmArgs.APISocket = u.useAPISocket()
+
+	if unikernelParams.RootFSType == "shared-fs" {
+		err = setupSharedRootfs(rootfsDir)
+		if err != nil {
+			return err
+		}
+		if unikernelParams.SharedFS.Type == unikernels.MountVirtioFS {
+			err = startVirtiofsd(filepath.Join(rootfsDir, monitorSharedRootfsDir),
+				filepath.Join(controlDir, virtiofsdSocketName), u.Spec.Root.Readonly,
+				u.Spec.Process.User.UID, u.Spec.Process.User.GID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	// Setup the rootfs for the the monitor execution, creating necessary
 	// devices and the monitor's binary.
-	err = prepareMonRootfs(rootfsDir, vmm.Path(), dmPath, vmm.UsesKVM(), withTUNTAP)
+	err = prepareMonRootfs(rootfsDir, vmm.Path(), dmPath, controlDir, vmm.UsesKVM(), withTUNTAP, tapCharDevices)
+	if err != nil {
+		return err
+	}
+
+	err = setupVolumes(rootfsDir, volumes)
 	if err != nil {
 		return err
 	}
 
+	if rootfsImage != "" {
+		dstPath := filepath.Join(rootfsDir, monitorRootfsImage)
+		err = bindMountFile(rootfsImage, filepath.Dir(dstPath), dstPath, 0o600, false)
+		if err != nil {
+			return err
+		}
+	}
+	if rootfsInitrdPath != "" {
+		dstPath := filepath.Join(rootfsDir, monitorRootfsInitrd)
+		err = bindMountFile(rootfsInitrdPath, filepath.Dir(dstPath), dstPath, 0o600, false)
+		if err != nil {
+			return err
+		}
+	}
+
 	withPivot := containsNS(u.Spec.Linux.Namespaces, specs.MountNamespace)
 	err = changeRoot(rootfsDir, withPivot)
 	if err != nil {
@@ -361,12 +684,37 @@ func (u *Unikontainer) Exec() error {
 		return err
 	}
 
+	// Changing the credentials of the process clears the parent death
+	// signal. Set it again, so the monitor does not outlive the urunc
+	// process that supervises it.
+	err = unix.Prctl(unix.PR_SET_PDEATHSIG, uintptr(unix.SIGKILL), 0, 0, 0)
+	if err != nil {
+		return fmt.Errorf("could not set parent death signal: %v", err)
+	}
+
 	uniklog.Debug("calling vmm execve")
 	metrics.Capture(u.State.ID, "TS18")
 	// metrics.Wait()
 	return vmm.Execve(vmmArgs, unikernel)
 }
 
+// rootfsDir returns the clean absolute path of the rootfs of the container
+func (u *Unikontainer) rootfsDir() (string, error) {
+	bundleDir := filepath.Clean(u.State.Bundle)
+	rootfsDir := filepath.Clean(u.Spec.Root.Path)
+	if filepath.IsAbs(rootfsDir) {
+		return rootfsDir, nil
+	}
+	if filepath.IsAbs(bundleDir) {
+		return filepath.Join(bundleDir, rootfsDir), nil
+	}
+	bundleAbsDir, err := filepath.Abs(bundleDir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(bundleAbsDir, rootfsDir), nil
+}
+
 func setupUser(user specs.User) error {
 	runtime.LockOSThread()
 	// Set the user for the current go routine to exec the Monitor
@@ -391,40 +739,415 @@ func setupUser(user specs.User) error {
 	return nil
 }
 
-// Kill stops the VMM process, first by asking the VMM struct to stop
-// and consequently by killing the process described in u.State.Pid
-func (u *Unikontainer) Kill() error {
+// Kill sends the given signal to the process described in u.State.Pid.
+// This process supervises the monitor and it turns SIGTERM and SIGINT to a
+// graceful shutdown of the guest, escalating to SIGKILL after a timeout.
+// If all is set, the signal is sent to every process of the container.
+// In the case of SIGKILL, Kill waits for the processes to exit and cleans up
+// the network resources of the unikernel.
+func (u *Unikontainer) Kill(sig unix.Signal, all bool) error {
+	err := u.signal(sig, all)
+	if err != nil || sig != unix.SIGKILL {
+		return err
+	}
+	// Once the processes are dead, we need to enter the network namespace
+	// and delete the TC rules, NAT rules and TAP device
+	u.cleanupNetwork()
+	return nil
+}
+
+// signal sends sig to the supervisor, or to every process of the container
+// if all is set. In the case of SIGKILL, it waits for the processes to exit.
+func (u *Unikontainer) signal(sig unix.Signal, all bool) error {
+	// The processes of the container get recorded before the signal, since
+	// the monitor and virtiofsd die after the supervisor through the parent
+	// death signal and they get reparented in the meantime.
+	tree := []int{u.State.Pid}
+	stats, err := listProcStats()
+	if err == nil {
+		tree = tree[:0]
+		for _, p := range processTree(u.State.Pid, stats) {
+			tree = append(tree, p.Pid)
+		}
+	} else if all {
+		return err
+	} else {
+		uniklog.WithError(err).Warn("failed to list the processes of the container")
+	}
+	pids := []int{u.State.Pid}
+	if all {
+		pids = tree
+	}
+
+	for _, pid := range pids {
+		if !pidAlive(pid) {
+			continue
+		}
+		uniklog.WithFields(logrus.Fields{
+			"pid":    pid,
+			"signal": unix.SignalName(sig),
+		}).Debug("sending signal")
+		err := unix.Kill(pid, sig)
+		if err != nil && !errors.Is(err, unix.ESRCH) {
+			return fmt.Errorf("failed to send %s to %d: %w", unix.SignalName(sig), pid, err)
+		}
+	}
+	if sig != unix.SIGKILL {
+		return nil
+	}
+
+	for _, pid := range tree {
+		if !waitPidExit(pid, killWaitTimeout) {
+			uniklog.Warnf("process %d did not exit after SIGKILL", pid)
+		}
+	}
+	return nil
+}
+
+// GracefulStop asks the VMM to gracefully shut down the guest. The monitorPid
+// is the PID of the monitor process. If the VMM does not support graceful
+// shutdown, hypervisors.ErrStopNotSupported is returned.
+func (u *Unikontainer) GracefulStop(monitorPid int) error {
+	vmmType := u.State.Annotations[annotHypervisor]
+	vmm, err := hypervisors.NewVMM(hypervisors.VmmType(vmmType))
+	if err != nil {
+		return err
+	}
+	return vmm.Stop(u.controlArgs(monitorPid))
+}
+
+// BootMonitor boots the guest, if the VMM runs in API mode and needs to be
+// configured through its API after it starts. The monitorPid is the PID of
+// the monitor process.
+func (u *Unikontainer) BootMonitor(monitorPid int) error {
+	if !u.useAPISocket() {
+		return nil
+	}
 	vmmType := u.State.Annotations[annotHypervisor]
 	vmm, err := hypervisors.NewVMM(hypervisors.VmmType(vmmType))
 	if err != nil {
 		return err
 	}
-	err = vmm.Stop(u.State.ID)
+	booter, ok := vmm.(hypervisors.Booter)
+	if !ok {
+		return nil
+	}
+	return booter.Boot(u.controlArgs(monitorPid))
+}
+
+// ServeDHCP serves the network configuration of the unikernel over DHCP,
+// until ctx gets canceled. It does nothing, unless DHCP is enabled for the
+// unikernel. The monitor process sets up the networks of the unikernel,
+// hence ServeDHCP waits until they show up in the state of the container.
+func (u *Unikontainer) ServeDHCP(ctx context.Context) error {
+	enabled, err := u.useDHCP()
+	if err != nil || !enabled {
+		return err
+	}
+	networks, err := u.awaitNetworks(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get the networks of the unikernel: %w", err)
+	}
+	if len(networks) == 0 {
+		return nil
+	}
+	rootfsDir, err := u.rootfsDir()
 	if err != nil {
 		return err
 	}
+	nameservers, search, err := readResolvConf(resolvConfPath(u.Spec, rootfsDir))
+	if err != nil {
+		uniklog.WithError(err).Warn("failed to read the DNS configuration")
+	}
 
-	// Check if pid is running
-	if syscall.Kill(u.State.Pid, syscall.Signal(0)) == nil {
-		err = syscall.Kill(u.State.Pid, unix.SIGKILL)
+	var wg sync.WaitGroup
+	errs := make([]error, len(networks))
+	for i, networkInfo := range networks {
+		// The traffic of the guest does not pass through the macvtap
+		// device, but it directly leaves from its interface.
+		if networkInfo.TapCharDevice != nil {
+			uniklog.Warnf("DHCP is not supported for macvtap device %s", networkInfo.TapDevice)
+			continue
+		}
+		// As with the command line of the unikernels, only the first
+		// network gets the DNS configuration and the hostname.
+		var lease network.DHCPLease
+		if i == 0 {
+			lease, err = network.NewDHCPLease(networkInfo.EthDevice, nameservers, search, u.Spec.Hostname)
+		} else {
+			lease, err = network.NewDHCPLease(networkInfo.EthDevice, nil, nil, "")
+		}
 		if err != nil {
-			return err
+			uniklog.WithError(err).Warnf("not serving DHCP on %s", networkInfo.TapDevice)
+			continue
 		}
+		wg.Add(1)
+		go func(i int, device string) {
+			defer wg.Done()
+			errs[i] = network.ServeDHCP(ctx, device, lease)
+		}(i, networkInfo.TapDevice)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// useDHCP returns whether urunc serves the network configuration of the
+// unikernel over DHCP, as set by the annotation or by the unikernel type.
+func (u *Unikontainer) useDHCP() (bool, error) {
+	if value, ok := u.Spec.Annotations[annotDHCP]; ok {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return false, fmt.Errorf("invalid %s annotation %q: %w", annotDHCP, value, err)
+		}
+		return enabled, nil
+	}
+	unikernel, err := unikernels.New(u.State.Annotations[annotType])
+	if err != nil {
+		return false, err
+	}
+	client, ok := unikernel.(unikernels.DHCPClient)
+	return ok && client.UsesDHCP(), nil
+}
+
+// awaitNetworks polls the state of the container until the monitor process
+// saves the networks of the unikernel or ctx gets canceled.
+func (u *Unikontainer) awaitNetworks(ctx context.Context) ([]network.UnikernelNetworkInfo, error) {
+	ticker := time.NewTicker(networkPollInterval)
+	defer ticker.Stop()
+	for {
+		state, err := loadUnikontainerState(filepath.Join(u.BaseDir, stateFilename))
+		if err != nil {
+			return nil, err
+		}
+		if len(state.Runtime.Networks) > 0 {
+			return state.Runtime.Networks, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Pause pauses the execution of the guest
+func (u *Unikontainer) Pause() error {
+	if u.State.Status != specs.StateRunning {
+		return fmt.Errorf("container %s is not running", u.State.ID)
+	}
+	pauser, err := u.pauser()
+	if err != nil {
+		return err
+	}
+	err = pauser.Pause(u.controlArgs(0))
+	if err != nil {
+		return err
+	}
+	return u.setStatus(StatePaused)
+}
+
+// Resume resumes the execution of a paused guest
+func (u *Unikontainer) Resume() error {
+	if u.State.Status != StatePaused {
+		return fmt.Errorf("container %s is not paused", u.State.ID)
+	}
+	pauser, err := u.pauser()
+	if err != nil {
+		return err
 	}
-	// If PID is running we need to kill the process
-	// Once the process is dead, we need to enter the network namespace
-	// and delete the TC rules and TAP device
-	err = u.joinSandboxNetNs()
+	err = pauser.Resume(u.controlArgs(0))
+	if err != nil {
+		return err
+	}
+	return u.setStatus(specs.StateRunning)
+}
+
+// Snapshot saves the state and the memory of the paused guest in the control
+// directory, as <name>.vmstate and <name>.mem respectively.
+func (u *Unikontainer) Snapshot(name string) error {
+	if u.State.Status != StatePaused {
+		return fmt.Errorf("container %s is not paused", u.State.ID)
+	}
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid snapshot name %q", name)
+	}
+	vmmType := u.State.Annotations[annotHypervisor]
+	vmm, err := hypervisors.NewVMM(hypervisors.VmmType(vmmType))
+	if err != nil {
+		return err
+	}
+	snapshotter, ok := vmm.(hypervisors.Snapshotter)
+	if !ok {
+		return fmt.Errorf("%s: %w", vmmType, hypervisors.ErrSnapshotNotSupported)
+	}
+	return snapshotter.Snapshot(u.controlArgs(0), name)
+}
+
+// Stats returns the statistics of the guest, as reported by the VMM
+func (u *Unikontainer) Stats() (hypervisors.VMStats, error) {
+	vmmType := u.State.Annotations[annotHypervisor]
+	vmm, err := hypervisors.NewVMM(hypervisors.VmmType(vmmType))
+	if err != nil {
+		return hypervisors.VMStats{}, err
+	}
+	reporter, ok := vmm.(hypervisors.StatsReporter)
+	if !ok {
+		return hypervisors.VMStats{}, fmt.Errorf("%s: %w", vmmType, hypervisors.ErrStatsNotSupported)
+	}
+	return reporter.Stats(u.controlArgs(0))
+}
+
+// MonitorConfigFile returns the path of the configuration file that was
+// generated for the monitor, if the monitor uses one.
+func (u *Unikontainer) MonitorConfigFile() string {
+	vmmType := u.State.Annotations[annotHypervisor]
+	vmm, err := hypervisors.NewVMM(hypervisors.VmmType(vmmType))
+	if err != nil {
+		return ""
+	}
+	reporter, ok := vmm.(hypervisors.ConfigReporter)
+	if !ok {
+		return ""
+	}
+	return reporter.ConfigFile(u.controlArgs(0))
+}
+
+// pauser returns the VMM of the container, if it supports pause and resume
+func (u *Unikontainer) pauser() (hypervisors.Pauser, error) {
+	vmmType := u.State.Annotations[annotHypervisor]
+	vmm, err := hypervisors.NewVMM(hypervisors.VmmType(vmmType))
+	if err != nil {
+		return nil, err
+	}
+	pauser, ok := vmm.(hypervisors.Pauser)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", vmmType, hypervisors.ErrPauseNotSupported)
+	}
+	return pauser, nil
+}
+
+// getVCPUs returns the number of vCPUs for the VM. The vcpus annotation takes
+// precedence over the CPU resources of the container. A number of vCPUs that
+// the monitor does not support is an error, whether it is requested through
+// the annotation or it is derived from the CPU resources.
+func (u *Unikontainer) getVCPUs(vmmType hypervisors.VmmType) (uint, error) {
+	var vcpus uint
+	if value, ok := u.Spec.Annotations[annotVCPUs]; ok {
+		requested, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || requested == 0 {
+			return 0, fmt.Errorf("invalid value in %s: %q", annotVCPUs, value)
+		}
+		vcpus = uint(requested)
+	} else if u.Spec.Linux != nil && u.Spec.Linux.Resources != nil {
+		var err error
+		vcpus, err = vcpusFromResources(u.Spec.Linux.Resources.CPU)
+		if err != nil {
+			return 0, err
+		}
+	}
+	maxVCPUs := hypervisors.MaxVCPUs(vmmType)
+	if maxVCPUs > 0 && vcpus > maxVCPUs {
+		return 0, fmt.Errorf("%s supports up to %d vCPUs, but %d were requested", vmmType, maxVCPUs, vcpus)
+	}
+	return vcpus, nil
+}
+
+// useAPISocket returns true if the VMM should be configured through its API
+// socket instead of a config file. Currently, only Firecracker supports it.
+func (u *Unikontainer) useAPISocket() bool {
+	value, ok := u.Spec.Annotations[annotFCAPISocket]
+	if !ok {
+		return false
+	}
+	useAPI, err := strconv.ParseBool(value)
+	if err != nil {
+		uniklog.Errorf("Invalid value in %s: %s. Using the config file", annotFCAPISocket, value)
+		return false
+	}
+	return useAPI
+}
+
+// ControlDir returns the directory of the control sockets of the monitor
+func (u *Unikontainer) ControlDir() string {
+	return filepath.Join(u.BaseDir, controlDirName)
+}
+
+func (u *Unikontainer) controlArgs(monitorPid int) hypervisors.ControlArgs {
+	return hypervisors.ControlArgs{
+		Container:  u.State.ID,
+		ControlDir: u.ControlDir(),
+		Pid:        monitorPid,
+	}
+}
+
+// StopTimeout returns the time to wait for the guest to gracefully shut down,
+// before killing the monitor. It can be set with the stopTimeout annotation
+// in seconds.
+func (u *Unikontainer) StopTimeout() time.Duration {
+	value, ok := u.Spec.Annotations[annotStopTimeout]
+	if !ok {
+		return defaultStopTimeout
+	}
+	seconds, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		uniklog.Errorf("Invalid value in %s: %s. Using default timeout", annotStopTimeout, value)
+		return defaultStopTimeout
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// cleanupNetwork enters the network namespace of the sandbox and deletes the
+// TC rules, NAT rules and TAP device of the unikernel, as recorded in its
+// state. The network resources of other unikernels in the same namespace
+// remain intact.
+// This function should be called only from a locked thread
+// (i.e. runtime. LockOSThread())
+func (u *Unikontainer) cleanupNetwork() {
+	if u.Runtime == nil || len(u.Runtime.Networks) == 0 {
+		return
+	}
+	joined, err := u.joinSandboxNetNs()
 	if err != nil {
 		uniklog.Errorf("failed to join sandbox netns: %v", err)
-		return nil
+		return
 	}
-	// TODO: tap0_urunc should not be hardcoded
-	err = network.Cleanup("tap0_urunc")
+	if joined && !cleanupNetworks(u.Runtime.Networks) {
+		return
+	}
+	// Forget the allocations, since the tap devices might get reused by
+	// other unikernels in the same namespace.
+	err = u.updateState(func(_ *specs.State, runtime *RuntimeState) {
+		runtime.Networks = nil
+	})
 	if err != nil {
-		uniklog.Errorf("failed to delete tap0_urunc: %v", err)
+		uniklog.Errorf("failed to save state: %v", err)
 	}
-	return nil
+}
+
+// cleanupNetworks releases the network resources of every network of the
+// unikernel in the current network namespace. It returns false, if the
+// resources of any network could not get released.
+func cleanupNetworks(networks []network.UnikernelNetworkInfo) bool {
+	released := true
+	for _, networkInfo := range networks {
+		err := network.Cleanup(networkInfo.Allocation)
+		if err != nil {
+			uniklog.Errorf("failed to delete %s: %v", networkInfo.TapDevice, err)
+			released = false
+		}
+	}
+	return released
+}
+
+// ForceDelete kills the processes of the container with SIGKILL, if they
+// are still running, and deletes the container. The network resources get
+// cleaned up once, by Delete.
+func (u *Unikontainer) ForceDelete() error {
+	err := u.signal(unix.SIGKILL, false)
+	if err != nil {
+		return err
+	}
+	return u.Delete()
 }
 
 // Delete removes the containers base directory and its contents
@@ -449,7 +1172,9 @@ func (u *Unikontainer) Delete() error {
 	if !filepath.IsAbs(rootfsDir) {
 		rootfsDir = filepath.Join(bundleDir, rootfsDir)
 	}
-	if unikernel.SupportsBlock() && annotBlock == "" && useDevmapper {
+	// No files were extracted, if the rootfs mode was set
+	rootfsMode := u.State.Annotations[annotRootfsMode]
+	if unikernel.SupportsBlock() && annotBlock == "" && useDevmapper && rootfsMode == "" {
 		err := cleanupExtractedFiles(rootfsDir)
 		if err != nil {
 			return fmt.Errorf("cannot delete rootfs %s: %v", rootfsDir, err)
@@ -483,13 +1208,31 @@ func (u *Unikontainer) Delete() error {
 	if err != nil {
 		return fmt.Errorf("cannot remove /usr: %v", err)
 	}
+	err = removeMonitorMountpoints(rootfsDir)
+	if err != nil {
+		uniklog.WithError(err).Warn("failed to remove the mount points of the volumes and the rootfs")
+	}
+	if rootfsMode == rootfsModeBlock || rootfsMode == rootfsModeInitrd {
+		err = pruneCache(rootfsCacheDir, rootfsCacheMaxAge)
+		if err != nil {
+			uniklog.WithError(err).Warn("failed to remove unused cached images")
+		}
+	}
+	// The unikernel might have been stopped gracefully, or it might have
+	// exited on its own. In both cases the network resources are still there.
+	u.cleanupNetwork()
+	err = u.removeCgroup()
+	if err != nil {
+		uniklog.WithError(err).Warn("failed to remove cgroup")
+	}
 	return os.RemoveAll(u.BaseDir)
 }
 
 // joinSandboxNetns joins the network namespace of the sandbox (pause container).
+// It returns false, if the container did not join an existing namespace.
 // This function should be called only from a locked thread
 // (i.e. runtime. LockOSThread())
-func (u Unikontainer) joinSandboxNetNs() error {
+func (u Unikontainer) joinSandboxNetNs() (bool, error) {
 	var netNsPath string
 	// We want enter the network namespace of the container.
 	// There are two possibilities:
@@ -507,13 +1250,13 @@ func (u Unikontainer) joinSandboxNetNs() error {
 				// We had to create the network namespace, when
 				// creating the container. Therefore, the namespace
 				// will die along with the unikernel.
-				return nil
+				return false, nil
 			}
 			err := checkValidNsPath(ns.Path)
 			if err == nil {
 				netNsPath = ns.Path
 			} else {
-				return err
+				return false, err
 			}
 			break
 		}
@@ -524,18 +1267,57 @@ func (u Unikontainer) joinSandboxNetNs() error {
 	}).Debug("Joining network namespace")
 	fd, err := unix.Open(netNsPath, unix.O_RDONLY|unix.O_CLOEXEC, 0)
 	if err != nil {
-		return fmt.Errorf("error opening namespace path: %w", err)
+		return false, fmt.Errorf("error opening namespace path: %w", err)
 	}
 	err = unix.Setns(int(fd), unix.CLONE_NEWNET)
 	if err != nil {
-		return fmt.Errorf("error joining namespace: %w", err)
+		return false, fmt.Errorf("error joining namespace: %w", err)
 	}
 	uniklog.Debug("Joined network namespace")
-	return nil
+	return true, nil
 }
 
 // Saves current Unikernel state as baseDir/state.json for later use
 func (u *Unikontainer) saveContainerState() error {
+	data, err := u.marshalContainerState()
+	if err != nil {
+		return err
+	}
+
+	stateName := filepath.Join(u.BaseDir, stateFilename)
+	return fsutil.WriteFileAtomic(stateName, data, 0o644)
+}
+
+// updateState reloads state.json under an exclusive lock, applies update to
+// the reloaded state and saves it. Multiple urunc processes update the state
+// of the same container concurrently (e.g. the start command and the monitor
+// process), hence every update must be based on the latest content of
+// state.json.
+func (u *Unikontainer) updateState(update func(state *specs.State, runtime *RuntimeState)) error {
+	lockFile, err := os.OpenFile(filepath.Join(u.BaseDir, stateLockFilename), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open state lock: %w", err)
+	}
+	defer lockFile.Close()
+	err = unix.Flock(int(lockFile.Fd()), unix.LOCK_EX)
+	if err != nil {
+		return fmt.Errorf("failed to lock state: %w", err)
+	}
+	defer unix.Flock(int(lockFile.Fd()), unix.LOCK_UN) //nolint: errcheck
+
+	state, err := loadUnikontainerState(filepath.Join(u.BaseDir, stateFilename))
+	if err != nil {
+		return fmt.Errorf("failed to load state: %w", err)
+	}
+	update(&state.State, &state.Runtime)
+	u.State = &state.State
+	u.Runtime = &state.Runtime
+	return u.saveContainerState()
+}
+
+// marshalContainerState returns the content of state.json for the current
+// Unikernel state
+func (u *Unikontainer) marshalContainerState() ([]byte, error) {
 	// Propagate all annotations from spec to state to solve nerdctl hooks errors.
 	// For more info: https://github.com/containerd/nerdctl/issues/133
 	for key, value := range u.Spec.Annotations {
@@ -544,13 +1326,11 @@ func (u *Unikontainer) saveContainerState() error {
 		}
 	}
 
-	data, err := json.Marshal(u.State)
-	if err != nil {
-		return err
+	state := containerState{State: *u.State}
+	if u.Runtime != nil {
+		state.Runtime = *u.Runtime
 	}
-
-	stateName := filepath.Join(u.BaseDir, stateFilename)
-	return os.WriteFile(stateName, data, 0o644) //nolint: gosec
+	return json.Marshal(state)
 }
 
 func (u *Unikontainer) ExecuteHooks(name string) error {
@@ -717,16 +1497,20 @@ func (u *Unikontainer) executeHooksSequentially(name string) error {
 	return nil
 }
 
-// loadUnikontainerState returns a specs.State object containing the info
+// loadUnikontainerState returns a containerState object containing the info
 // found in stateFilePath
-func loadUnikontainerState(stateFilePath string) (*specs.State, error) {
-	var state specs.State
+func loadUnikontainerState(stateFilePath string) (*containerState, error) {
 	data, err := os.ReadFile(stateFilePath)
 	if err != nil {
 		return nil, err
 	}
+	return parseUnikontainerState(data)
+}
 
-	err = json.Unmarshal(data, &state)
+// parseUnikontainerState parses the content of a state.json file
+func parseUnikontainerState(data []byte) (*containerState, error) {
+	var state containerState
+	err := json.Unmarshal(data, &state)
 	if err != nil {
 		return nil, err
 	}
@@ -976,17 +1760,82 @@ func (u *Unikontainer) SendStartExecve() error {
 
 // isRunning returns true if the PID is alive or hedge.ListVMs returns our containerID
 func (u *Unikontainer) isRunning() bool {
-	vmmType := hypervisors.VmmType(u.State.Annotations[annotType])
+	vmmType := hypervisors.VmmType(u.State.Annotations[annotHypervisor])
 	if vmmType != hypervisors.HedgeVmm {
-		return syscall.Kill(u.State.Pid, syscall.Signal(0)) == nil
+		return pidAlive(u.State.Pid)
 	}
 	hedge := hypervisors.Hedge{}
 	state := hedge.VMState(u.State.ID)
 	return state == "running"
 }
 
-// getNetworkType checks if current container is a knative user-container
+// getNetInterfaces returns the interfaces of the network namespace that the
+// annotation of the container requests for the unikernel, if any.
+func (u Unikontainer) getNetInterfaces() []string {
+	var ifaces []string
+	for _, iface := range strings.Split(u.Spec.Annotations[annotNetInterfaces], ",") {
+		iface = strings.TrimSpace(iface)
+		if iface != "" {
+			ifaces = append(ifaces, iface)
+		}
+	}
+	return ifaces
+}
+
+// newNetworkManager returns the network manager of the given network type.
+// The static network gets configured through the annotations of the
+// container.
+func (u Unikontainer) newNetworkManager(networkType string) (network.Manager, error) {
+	if networkType != "static" {
+		return network.NewNetworkManager(networkType)
+	}
+	config, err := staticNetworkConfig(u.Spec.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	return network.NewStaticNetwork(config), nil
+}
+
+// getRateLimit returns the bandwidth limits of the network of the unikernel,
+// as set by the urunc or the Kubernetes bandwidth annotations.
+func (u Unikontainer) getRateLimit() (network.RateLimit, error) {
+	var err error
+	var limit network.RateLimit
+	limit.Ingress, err = u.getBandwidth(annotIngressBandwidth, annotK8sIngressBandwidth)
+	if err != nil {
+		return network.RateLimit{}, err
+	}
+	limit.Egress, err = u.getBandwidth(annotEgressBandwidth, annotK8sEgressBandwidth)
+	if err != nil {
+		return network.RateLimit{}, err
+	}
+	return limit, nil
+}
+
+// getBandwidth returns the bandwidth in bits per second of the first of the
+// annotations that is set, or 0 if none of them is set.
+func (u Unikontainer) getBandwidth(annotations ...string) (uint64, error) {
+	for _, annot := range annotations {
+		value := u.Spec.Annotations[annot]
+		if value == "" {
+			continue
+		}
+		bandwidth, err := network.ParseBandwidth(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s annotation: %w", annot, err)
+		}
+		return bandwidth, nil
+	}
+	return 0, nil
+}
+
+// getNetworkType returns the network mode of the annotation, if it is set.
+// Otherwise, it checks if current container is a knative user-container,
+// which needs the static network for compatibility with the queue-proxy.
 func (u Unikontainer) getNetworkType() string {
+	if mode := strings.TrimSpace(u.Spec.Annotations[annotNetworkMode]); mode != "" {
+		return mode
+	}
 	if u.Spec.Annotations["io.kubernetes.cri.container-name"] == "user-container" {
 		return "static"
 	}
@@ -0,0 +1,138 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nubificus/urunc/pkg/network"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func newTestUnikontainer(t *testing.T) *Unikontainer {
+	t.Helper()
+	u := &Unikontainer{
+		BaseDir: t.TempDir(),
+		State: &specs.State{
+			ID:          "test",
+			Status:      specs.StateCreated,
+			Pid:         1234,
+			Annotations: map[string]string{},
+		},
+		Runtime: &RuntimeState{},
+		Spec:    &specs.Spec{},
+	}
+	assert.NoError(t, u.saveContainerState())
+	return u
+}
+
+func TestUpdateState(t *testing.T) {
+	t.Run("concurrent updates are preserved", func(t *testing.T) {
+		t.Parallel()
+		u := newTestUnikontainer(t)
+		// Two urunc processes with their own view of the container
+		starter := *u
+		monitor := *u
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, starter.setStatus(specs.StateRunning))
+		}()
+		go func() {
+			defer wg.Done()
+			err := monitor.updateState(func(_ *specs.State, runtime *RuntimeState) {
+				runtime.Networks = []network.UnikernelNetworkInfo{{TapDevice: "tap1_urunc"}}
+			})
+			assert.NoError(t, err)
+		}()
+		wg.Wait()
+
+		state, err := loadUnikontainerState(filepath.Join(u.BaseDir, stateFilename))
+		assert.NoError(t, err)
+		assert.Equal(t, specs.StateRunning, state.Status)
+		if assert.Len(t, state.Runtime.Networks, 1) {
+			assert.Equal(t, "tap1_urunc", state.Runtime.Networks[0].TapDevice)
+		}
+	})
+
+	t.Run("missing state", func(t *testing.T) {
+		t.Parallel()
+		u := &Unikontainer{
+			BaseDir: t.TempDir(),
+			State:   &specs.State{},
+			Runtime: &RuntimeState{},
+			Spec:    &specs.Spec{},
+		}
+		err := u.setStatus(specs.StateRunning)
+		assert.Error(t, err)
+	})
+}
+
+func TestKillWaitsForDescendants(t *testing.T) {
+	// The supervisor runs a child that outlives it for a while, as the
+	// monitor does until the parent death signal reaches it.
+	cmd := exec.Command("sh", "-c", "sleep 0.5; true")
+	err := cmd.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var child int
+	for i := 0; i < 100 && child == 0; i++ {
+		stats, err := listProcStats()
+		assert.NoError(t, err)
+		if tree := processTree(cmd.Process.Pid, stats); len(tree) > 1 {
+			child = tree[1].Pid
+		} else {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if child == 0 {
+		t.Fatal("the child of the supervisor did not start")
+	}
+	go func() {
+		_ = cmd.Wait()
+	}()
+
+	u := newTestUnikontainer(t)
+	u.State.Pid = cmd.Process.Pid
+	assert.NoError(t, u.Kill(unix.SIGKILL, false))
+	assert.False(t, pidAlive(cmd.Process.Pid))
+	assert.False(t, pidAlive(child))
+}
+
+func TestSnapshot(t *testing.T) {
+	t.Run("not paused", func(t *testing.T) {
+		t.Parallel()
+		u := newTestUnikontainer(t)
+		assert.EqualError(t, u.Snapshot("snap"), "container test is not paused")
+	})
+
+	t.Run("invalid name", func(t *testing.T) {
+		t.Parallel()
+		u := newTestUnikontainer(t)
+		u.State.Status = StatePaused
+		for _, name := range []string{"", ".", "..", "../snap"} {
+			assert.ErrorContains(t, u.Snapshot(name), "invalid snapshot name")
+		}
+	})
+}
@@ -15,7 +15,9 @@
 package unikontainers
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -24,16 +26,22 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/nubificus/urunc/internal/constants"
+	"github.com/nubificus/urunc/internal/fsutil"
+	"github.com/nubificus/urunc/pkg/network"
 	"github.com/opencontainers/runtime-spec/specs-go"
 )
 
 const (
 	configFilename    = "config.json"
 	stateFilename     = "state.json"
+	stateLockFilename = "state.lock"
 	initPidFilename   = "init.pid"
 	uruncJSONFilename = "urunc.json"
 	rootfsDirName     = "rootfs"
+	controlDirName    = "control"
+	// The path where the control directory of the container is mounted
+	// inside the rootfs of the monitor
+	monitorControlDir = "/tmp/urunc"
 )
 
 // getInitPid extracts "init_process_pid" value from the given JSON file
@@ -122,37 +130,46 @@ func loadSpec(bundleDir string) (*specs.Spec, error) {
 
 // writePidFile writes the content of pid to the file defined by path
 func writePidFile(path string, pid int) error {
-	var (
-		tmpDir  = filepath.Dir(path)
-		tmpName = filepath.Join(tmpDir, "."+filepath.Base(path))
-	)
-	f, err := os.OpenFile(tmpName, os.O_RDWR|os.O_CREATE|os.O_EXCL|os.O_SYNC, 0o666)
+	return fsutil.WriteFileAtomic(path, []byte(strconv.Itoa(pid)), 0o666)
+}
+
+// staticNetworkConfig returns the configuration of the static network, as
+// set by the annotations.
+func staticNetworkConfig(annotations map[string]string) (network.StaticConfig, error) {
+	ports, err := network.ParsePortForwards(annotations[annotPorts])
 	if err != nil {
-		return err
+		return network.StaticConfig{}, fmt.Errorf("invalid %s annotation: %w", annotPorts, err)
 	}
-	_, err = f.WriteString(strconv.Itoa(pid))
-	f.Close()
-	if err != nil {
-		return err
-	}
-	return os.Rename(tmpName, path)
+	return network.NewStaticConfig(
+		strings.TrimSpace(annotations[annotStaticSubnet]),
+		strings.TrimSpace(annotations[annotStaticTapIP]),
+		strings.TrimSpace(annotations[annotStaticGuestIP]),
+		ports,
+	)
 }
 
-// handleQueueProxy adds a hardcoded IP to the process's environment.
-// Then, the container is identified as a non-bima container
-// is spawned using runc.
+// handleQueueProxy adds the IP of the unikernel in the static network to the
+// process's environment. Then, the container is identified as a non-bima
+// container is spawned using runc.
 func handleQueueProxy(spec specs.Spec, configFile string) error {
+	// The annotations of the pod configure the static network of the
+	// user-container too
+	config, err := staticNetworkConfig(spec.Annotations)
+	if err != nil {
+		return err
+	}
+	redirectIP := config.GuestIP.String()
 	var readinessProbeEnv string
 	for i, envVar := range spec.Process.Env {
 		if strings.HasPrefix(envVar, "SERVING_READINESS_PROBE") {
 			spec.Process.Env = remove(spec.Process.Env, i)
 			re := regexp.MustCompile(`"host"\s*:\s*"[^"]+"`)
-			readinessProbeEnv = re.ReplaceAllString(envVar, `"host":"`+constants.QueueProxyRedirectIP+`"`)
+			readinessProbeEnv = re.ReplaceAllString(envVar, `"host":"`+redirectIP+`"`)
 			break
 		}
 	}
 
-	redirectIPEnv := fmt.Sprintf("REDIRECT_IP=%s", constants.QueueProxyRedirectIP)
+	redirectIPEnv := fmt.Sprintf("REDIRECT_IP=%s", redirectIP)
 	envs := []string{readinessProbeEnv, redirectIPEnv}
 	spec.Process.Env = append(spec.Process.Env, envs...)
 
@@ -197,6 +214,20 @@ func checkValidNsPath(path string) error {
 	return nil
 }
 
+// validateBlockMntPoint checks the mount point of the block device, which
+// ends up in the command line or the configuration of the unikernel
+func validateBlockMntPoint(mntPoint string) error {
+	if mntPoint == "" {
+		return nil
+	}
+	if !filepath.IsAbs(mntPoint) || filepath.Clean(mntPoint) != mntPoint ||
+		strings.ContainsAny(mntPoint, ":;, \t\n") {
+		return fmt.Errorf("invalid %s annotation %q: expected a clean absolute path", annotBlockMntPoint, mntPoint)
+	}
+
+	return nil
+}
+
 func convertUint32ToIntSlice(valSlice []uint32, size int) []int {
 	retSlice := make([]int, size)
 	for i, val := range valSlice {
@@ -217,3 +248,97 @@ func convertUint32ToIntSlice(valSlice []uint32, size int) []int {
 // 	}
 // 	return data.Bytes(), nil
 // }
+
+// vcpusFromResources calculates the number of vCPUs that correspond to the
+// CPU resources of the container. The CPU quota and period take precedence
+// and the result is rounded up. Otherwise, the number of CPUs in the cpuset
+// is used. It returns 0, if there is no CPU limit.
+func vcpusFromResources(cpu *specs.LinuxCPU) (uint, error) {
+	if cpu == nil {
+		return 0, nil
+	}
+	if cpu.Quota != nil && *cpu.Quota > 0 && cpu.Period != nil && *cpu.Period > 0 {
+		quota := uint64(*cpu.Quota) // nolint:gosec
+		return uint((quota + *cpu.Period - 1) / *cpu.Period), nil
+	}
+	if cpu.Cpus != "" {
+		return cpusetSize(cpu.Cpus)
+	}
+	return 0, nil
+}
+
+// cpusetSize returns the number of CPUs in a cpuset list, e.g. "0-3,7"
+func cpusetSize(cpuset string) (uint, error) {
+	var size uint
+	for _, part := range strings.Split(cpuset, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last, isRange := strings.Cut(part, "-")
+		start, err := strconv.ParseUint(first, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid cpuset %q: %w", cpuset, err)
+		}
+		end := start
+		if isRange {
+			end, err = strconv.ParseUint(last, 10, 32)
+			if err != nil {
+				return 0, fmt.Errorf("invalid cpuset %q: %w", cpuset, err)
+			}
+			if end < start {
+				return 0, fmt.Errorf("invalid cpuset %q: invalid range %s", cpuset, part)
+			}
+		}
+		size += uint(end - start + 1)
+	}
+	return size, nil
+}
+
+// resolvConfPath returns the path of the resolv.conf of the container. The
+// container engines usually bind mount a resolv.conf, which points to the
+// DNS of the cluster, on top of the one of the image.
+func resolvConfPath(spec *specs.Spec, rootfsDir string) string {
+	for _, mount := range spec.Mounts {
+		if filepath.Clean(mount.Destination) == "/etc/resolv.conf" {
+			return mount.Source
+		}
+	}
+	return filepath.Join(rootfsDir, "etc", "resolv.conf")
+}
+
+// readResolvConf returns the nameservers and the search domains of a
+// resolv.conf file. A missing file means that there is no DNS configuration.
+func readResolvConf(path string) ([]string, []string, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	nameservers, search := parseResolvConf(file)
+	return nameservers, search, nil
+}
+
+// parseResolvConf parses the nameservers and the search domains of a
+// resolv.conf. As in the resolver of glibc, the last search (or domain)
+// line takes precedence.
+func parseResolvConf(r io.Reader) ([]string, []string) {
+	var nameservers []string
+	var search []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], ";") {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			nameservers = append(nameservers, fields[1])
+		case "search", "domain":
+			search = fields[1:]
+		}
+	}
+	return nameservers, search
+}
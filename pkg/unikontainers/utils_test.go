@@ -19,8 +19,10 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/nubificus/urunc/pkg/network"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/stretchr/testify/assert"
 )
@@ -364,3 +366,271 @@ func TestLoadSpec(t *testing.T) {
 		assert.Contains(t, err.Error(), "failed to parse specification json", "Expected specific error message")
 	})
 }
+
+func TestVcpusFromResources(t *testing.T) {
+	int64Ptr := func(v int64) *int64 { return &v }
+	uint64Ptr := func(v uint64) *uint64 { return &v }
+
+	tests := []struct {
+		name     string
+		cpu      *specs.LinuxCPU
+		expected uint
+	}{
+		{"no cpu resources", nil, 0},
+		{"no limits", &specs.LinuxCPU{}, 0},
+		{"quota and period", &specs.LinuxCPU{Quota: int64Ptr(200000), Period: uint64Ptr(100000)}, 2},
+		{"quota rounded up", &specs.LinuxCPU{Quota: int64Ptr(150000), Period: uint64Ptr(100000)}, 2},
+		{"fractional quota", &specs.LinuxCPU{Quota: int64Ptr(50000), Period: uint64Ptr(100000)}, 1},
+		{"unlimited quota", &specs.LinuxCPU{Quota: int64Ptr(-1), Period: uint64Ptr(100000), Cpus: "0-3"}, 4},
+		{"quota over cpuset", &specs.LinuxCPU{Quota: int64Ptr(100000), Period: uint64Ptr(100000), Cpus: "0-3"}, 1},
+		{"cpuset list", &specs.LinuxCPU{Cpus: "0-2,5,7-8"}, 6},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			vcpus, err := vcpusFromResources(tc.cpu)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, vcpus)
+		})
+	}
+
+	t.Run("invalid cpuset", func(t *testing.T) {
+		t.Parallel()
+		_, err := vcpusFromResources(&specs.LinuxCPU{Cpus: "3-1"})
+		assert.Error(t, err)
+		_, err = vcpusFromResources(&specs.LinuxCPU{Cpus: "a-b"})
+		assert.Error(t, err)
+	})
+}
+
+func TestGetVCPUs(t *testing.T) {
+	newUnikontainer := func(annotations map[string]string, cpus string) *Unikontainer {
+		return &Unikontainer{
+			State: &specs.State{ID: "test"},
+			Spec: &specs.Spec{
+				Annotations: annotations,
+				Linux: &specs.Linux{
+					Resources: &specs.LinuxResources{CPU: &specs.LinuxCPU{Cpus: cpus}},
+				},
+			},
+		}
+	}
+
+	t.Run("annotation overrides resources", func(t *testing.T) {
+		t.Parallel()
+		u := newUnikontainer(map[string]string{annotVCPUs: "3"}, "0-1")
+		vcpus, err := u.getVCPUs("qemu")
+		assert.NoError(t, err)
+		assert.Equal(t, uint(3), vcpus)
+	})
+	t.Run("invalid annotation", func(t *testing.T) {
+		t.Parallel()
+		u := newUnikontainer(map[string]string{annotVCPUs: "0"}, "")
+		_, err := u.getVCPUs("qemu")
+		assert.Error(t, err)
+	})
+	t.Run("annotation exceeds monitor limit", func(t *testing.T) {
+		t.Parallel()
+		u := newUnikontainer(map[string]string{annotVCPUs: "2"}, "")
+		_, err := u.getVCPUs("hvt")
+		assert.ErrorContains(t, err, "hvt supports up to 1 vCPUs")
+	})
+	t.Run("resources exceed monitor limit", func(t *testing.T) {
+		t.Parallel()
+		u := newUnikontainer(nil, "0-3")
+		_, err := u.getVCPUs("spt")
+		assert.ErrorContains(t, err, "spt supports up to 1 vCPUs, but 4 were requested")
+
+		u = newUnikontainer(nil, "0")
+		vcpus, err := u.getVCPUs("spt")
+		assert.NoError(t, err)
+		assert.Equal(t, uint(1), vcpus)
+	})
+	t.Run("firecracker limit", func(t *testing.T) {
+		t.Parallel()
+		u := newUnikontainer(nil, "0-31")
+		vcpus, err := u.getVCPUs("firecracker")
+		assert.NoError(t, err)
+		assert.Equal(t, uint(32), vcpus)
+
+		u = newUnikontainer(nil, "0-63")
+		_, err = u.getVCPUs("firecracker")
+		assert.ErrorContains(t, err, "firecracker supports up to 32 vCPUs")
+
+		u = newUnikontainer(map[string]string{annotVCPUs: "33"}, "")
+		_, err = u.getVCPUs("firecracker")
+		assert.ErrorContains(t, err, "firecracker supports up to 32 vCPUs")
+	})
+}
+
+func TestGetNetInterfaces(t *testing.T) {
+	t.Run("no annotation", func(t *testing.T) {
+		t.Parallel()
+		u := Unikontainer{Spec: &specs.Spec{}}
+		assert.Empty(t, u.getNetInterfaces())
+	})
+	t.Run("multiple interfaces", func(t *testing.T) {
+		t.Parallel()
+		u := Unikontainer{Spec: &specs.Spec{
+			Annotations: map[string]string{annotNetInterfaces: " net1, eth0,,"},
+		}}
+		assert.Equal(t, []string{"net1", "eth0"}, u.getNetInterfaces())
+	})
+}
+
+func TestGetNetworkType(t *testing.T) {
+	t.Run("dynamic by default", func(t *testing.T) {
+		t.Parallel()
+		u := Unikontainer{Spec: &specs.Spec{}}
+		assert.Equal(t, "dynamic", u.getNetworkType())
+	})
+	t.Run("knative user-container", func(t *testing.T) {
+		t.Parallel()
+		u := Unikontainer{Spec: &specs.Spec{
+			Annotations: map[string]string{"io.kubernetes.cri.container-name": "user-container"},
+		}}
+		assert.Equal(t, "static", u.getNetworkType())
+	})
+	t.Run("annotation", func(t *testing.T) {
+		t.Parallel()
+		u := Unikontainer{Spec: &specs.Spec{
+			Annotations: map[string]string{
+				"io.kubernetes.cri.container-name": "user-container",
+				annotNetworkMode:                   "macvtap",
+			},
+		}}
+		assert.Equal(t, "macvtap", u.getNetworkType())
+	})
+}
+
+func TestUseDHCP(t *testing.T) {
+	t.Run("disabled by default", func(t *testing.T) {
+		t.Parallel()
+		u := Unikontainer{
+			State: &specs.State{Annotations: map[string]string{annotType: "unikraft"}},
+			Spec:  &specs.Spec{},
+		}
+		enabled, err := u.useDHCP()
+		assert.NoError(t, err)
+		assert.False(t, enabled)
+	})
+	t.Run("annotation", func(t *testing.T) {
+		t.Parallel()
+		u := Unikontainer{
+			State: &specs.State{Annotations: map[string]string{annotType: "unikraft"}},
+			Spec:  &specs.Spec{Annotations: map[string]string{annotDHCP: "true"}},
+		}
+		enabled, err := u.useDHCP()
+		assert.NoError(t, err)
+		assert.True(t, enabled)
+	})
+	t.Run("invalid annotation", func(t *testing.T) {
+		t.Parallel()
+		u := Unikontainer{
+			State: &specs.State{Annotations: map[string]string{annotType: "unikraft"}},
+			Spec:  &specs.Spec{Annotations: map[string]string{annotDHCP: "sometimes"}},
+		}
+		_, err := u.useDHCP()
+		assert.Error(t, err)
+	})
+}
+
+func TestGetRateLimit(t *testing.T) {
+	t.Run("no annotations", func(t *testing.T) {
+		t.Parallel()
+		u := Unikontainer{Spec: &specs.Spec{}}
+		limit, err := u.getRateLimit()
+		assert.NoError(t, err)
+		assert.Equal(t, network.RateLimit{}, limit)
+	})
+	t.Run("urunc annotations override the kubernetes ones", func(t *testing.T) {
+		t.Parallel()
+		u := Unikontainer{Spec: &specs.Spec{
+			Annotations: map[string]string{
+				annotK8sIngressBandwidth: "10M",
+				annotK8sEgressBandwidth:  "20M",
+				annotEgressBandwidth:     "1M",
+			},
+		}}
+		limit, err := u.getRateLimit()
+		assert.NoError(t, err)
+		assert.Equal(t, network.RateLimit{Ingress: 10000000, Egress: 1000000}, limit)
+	})
+	t.Run("invalid bandwidth", func(t *testing.T) {
+		t.Parallel()
+		u := Unikontainer{Spec: &specs.Spec{
+			Annotations: map[string]string{annotK8sIngressBandwidth: "fast"},
+		}}
+		_, err := u.getRateLimit()
+		assert.Error(t, err)
+	})
+}
+
+func TestStaticNetworkConfig(t *testing.T) {
+	t.Run("default configuration", func(t *testing.T) {
+		t.Parallel()
+		config, err := staticNetworkConfig(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "172.16.1.2", config.GuestIP.String())
+		assert.Empty(t, config.Ports)
+	})
+	t.Run("annotations", func(t *testing.T) {
+		t.Parallel()
+		config, err := staticNetworkConfig(map[string]string{
+			annotStaticSubnet:  "10.20.0.0/24",
+			annotStaticGuestIP: "10.20.0.9",
+			annotPorts:         "8080",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "10.20.0.1", config.TapIP.String())
+		assert.Equal(t, "10.20.0.9", config.GuestIP.String())
+		assert.Equal(t, []network.PortForward{{Protocol: "tcp", Port: 8080, GuestPort: 8080}}, config.Ports)
+	})
+	t.Run("invalid ports", func(t *testing.T) {
+		t.Parallel()
+		_, err := staticNetworkConfig(map[string]string{annotPorts: "http"})
+		assert.Error(t, err)
+	})
+}
+
+func TestResolvConf(t *testing.T) {
+	t.Run("parse nameservers and search domains", func(t *testing.T) {
+		t.Parallel()
+		conf := "# generated\nsearch default.svc.cluster.local svc.cluster.local\n" +
+			"nameserver 10.96.0.10\nnameserver fd00::a\n;nameserver 1.1.1.1\noptions ndots:5\n"
+		nameservers, search := parseResolvConf(strings.NewReader(conf))
+		assert.Equal(t, []string{"10.96.0.10", "fd00::a"}, nameservers)
+		assert.Equal(t, []string{"default.svc.cluster.local", "svc.cluster.local"}, search)
+	})
+	t.Run("last search line wins", func(t *testing.T) {
+		t.Parallel()
+		_, search := parseResolvConf(strings.NewReader("search a.local\ndomain b.local\n"))
+		assert.Equal(t, []string{"b.local"}, search)
+	})
+	t.Run("missing file", func(t *testing.T) {
+		t.Parallel()
+		nameservers, search, err := readResolvConf(filepath.Join(t.TempDir(), "resolv.conf"))
+		assert.NoError(t, err)
+		assert.Empty(t, nameservers)
+		assert.Empty(t, search)
+	})
+	t.Run("bind mounted resolv.conf", func(t *testing.T) {
+		t.Parallel()
+		spec := &specs.Spec{Mounts: []specs.Mount{
+			{Destination: "/etc/hostname", Source: "/sandbox/hostname"},
+			{Destination: "/etc/resolv.conf", Source: "/sandbox/resolv.conf"},
+		}}
+		assert.Equal(t, "/sandbox/resolv.conf", resolvConfPath(spec, "/rootfs"))
+		assert.Equal(t, "/rootfs/etc/resolv.conf", resolvConfPath(&specs.Spec{}, "/rootfs"))
+	})
+}
+
+func TestValidateBlockMntPoint(t *testing.T) {
+	t.Parallel()
+	for _, mntPoint := range []string{"", "/", "/data", "/mnt/data"} {
+		assert.NoError(t, validateBlockMntPoint(mntPoint), mntPoint)
+	}
+	for _, mntPoint := range []string{"data", "/data/", "/mnt/../data", "/my data", "/data:rw", "/a,b"} {
+		assert.Error(t, validateBlockMntPoint(mntPoint), mntPoint)
+	}
+}
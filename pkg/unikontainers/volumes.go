@@ -0,0 +1,216 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nubificus/urunc/pkg/unikontainers/hypervisors"
+	"github.com/nubificus/urunc/pkg/unikontainers/unikernels"
+	"github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// The directory of the rootfs of the monitor, where the volumes of the
+// container get mounted
+const monitorVolumesDir = "/.urunc/volumes"
+
+// ignoredMountDestinations are the mounts that container engines add to
+// every container, but they either get passed to the guest in other ways,
+// or they make no sense for a guest.
+var ignoredMountDestinations = []string{
+	"/etc/hosts",
+	"/etc/hostname",
+	"/etc/resolv.conf",
+	"/dev/termination-log",
+}
+
+// guestVolume is a volume of the container, as it gets passed to the guest
+type guestVolume struct {
+	hostPath    string                 // The directory or the image of the volume on the host
+	monitorPath string                 // The path of the volume in the rootfs of the monitor
+	mount       unikernels.MountParams // The mount of the volume in the guest
+}
+
+// volumeMounts returns the bind mounts of the spec, which are the volumes of
+// the container (e.g. ConfigMaps, Secrets and PersistentVolumeClaims).
+func volumeMounts(mounts []specs.Mount) []specs.Mount {
+	var volumes []specs.Mount
+	for _, mount := range mounts {
+		isBind := mount.Type == "bind" || slices.Contains(mount.Options, "bind") || slices.Contains(mount.Options, "rbind")
+		if !isBind || slices.Contains(ignoredMountDestinations, filepath.Clean(mount.Destination)) {
+			continue
+		}
+		volumes = append(volumes, mount)
+	}
+	return volumes
+}
+
+// planVolumes decides how each volume of the container reaches the guest,
+// depending on what the unikernel and the monitor support. The directory of
+// a volume gets shared over 9p, or it gets copied into an ext2 image, which
+// gets attached as a block device. Only read-only volumes get copied, since
+// the changes of the guest would not reach the host. The block devices of
+// the volumes follow the firstBlockIndex block devices of the guest. Volumes
+// that cannot reach the guest get ignored.
+func (u *Unikontainer) planVolumes(unikernel unikernels.Unikernel, vmmType hypervisors.VmmType, firstBlockIndex int) ([]guestVolume, error) {
+	mounts := volumeMounts(u.Spec.Mounts)
+	if len(mounts) == 0 {
+		return nil, nil
+	}
+	mounter, ok := unikernel.(unikernels.VolumeMounter)
+	if !ok {
+		uniklog.Infof("unikernel does not support volumes, ignoring %d volumes", len(mounts))
+		return nil, nil
+	}
+	supports := func(mountType string) bool {
+		return mounter.SupportsMount(mountType) && hypervisors.SupportsMount(vmmType, mountType)
+	}
+
+	var volumes []guestVolume
+	blockIndex := firstBlockIndex
+	for i, mount := range mounts {
+		logger := uniklog.WithField("volume", mount.Destination)
+		// The mounts of the guest get described in colon separated lists
+		if !filepath.IsAbs(mount.Destination) || strings.ContainsAny(mount.Destination, ":; \t\n") {
+			logger.Warn("ignoring volume with unsupported mount point")
+			continue
+		}
+		info, err := os.Stat(mount.Source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat volume %s: %w", mount.Source, err)
+		}
+		if !info.IsDir() {
+			logger.Warn("ignoring volume, only directories are supported")
+			continue
+		}
+		volume := guestVolume{
+			monitorPath: filepath.Join(monitorVolumesDir, strconv.Itoa(i)),
+			mount: unikernels.MountParams{
+				Destination: filepath.Clean(mount.Destination),
+				ReadOnly:    slices.Contains(mount.Options, "ro"),
+			},
+		}
+		switch {
+		case supports(unikernels.Mount9P):
+			volume.hostPath = mount.Source
+			volume.mount.Type = unikernels.Mount9P
+			volume.mount.Source = "vol" + strconv.Itoa(i)
+		case supports(unikernels.MountBlock):
+			// The image is a copy of the directory, hence the writes of
+			// the guest would be silently lost
+			if !volume.mount.ReadOnly {
+				return nil, fmt.Errorf("volume %s is writable, but %s and the unikernel can only attach a read-only copy of it", mount.Destination, vmmType)
+			}
+			image := filepath.Join(u.BaseDir, "volumes", strconv.Itoa(i)+".img")
+			err = buildExt2Image(mount.Source, image)
+			if err != nil {
+				return nil, err
+			}
+			// The monitor might not run as root
+			err = os.Chown(image, int(u.Spec.Process.User.UID), int(u.Spec.Process.User.GID))
+			if err != nil {
+				return nil, fmt.Errorf("failed to set owner of %s: %w", image, err)
+			}
+			volume.hostPath = image
+			volume.mount.Type = unikernels.MountBlock
+			volume.mount.FsType = "ext2"
+			volume.mount.BlockIndex = blockIndex
+			blockIndex++
+		default:
+			logger.Warnf("ignoring volume, %s and the unikernel do not support a common volume type", vmmType)
+			continue
+		}
+		volumes = append(volumes, volume)
+	}
+	return volumes, nil
+}
+
+// volumeArgs returns the block devices and the shared directories of the
+// monitor for volumes, along with their mounts in the guest.
+func volumeArgs(volumes []guestVolume) ([]hypervisors.BlockArgs, []hypervisors.SharedDirArgs, []unikernels.MountParams) {
+	var blocks []hypervisors.BlockArgs
+	var dirs []hypervisors.SharedDirArgs
+	var mounts []unikernels.MountParams
+	for _, volume := range volumes {
+		switch volume.mount.Type {
+		case unikernels.MountBlock:
+			blocks = append(blocks, hypervisors.BlockArgs{
+				Path:     volume.monitorPath,
+				ReadOnly: volume.mount.ReadOnly,
+			})
+		case unikernels.Mount9P:
+			dirs = append(dirs, hypervisors.SharedDirArgs{
+				Tag:      volume.mount.Source,
+				Path:     volume.monitorPath,
+				ReadOnly: volume.mount.ReadOnly,
+			})
+		}
+		mounts = append(mounts, volume.mount)
+	}
+	return blocks, dirs, mounts
+}
+
+// setupVolumes bind mounts the directories and the images of the volumes in
+// the rootfs of the monitor.
+func setupVolumes(monRootfs string, volumes []guestVolume) error {
+	for _, volume := range volumes {
+		dstPath := filepath.Join(monRootfs, volume.monitorPath)
+		var err error
+		if volume.mount.Type == unikernels.MountBlock {
+			err = bindMountFile(volume.hostPath, filepath.Dir(dstPath), dstPath, 0o600, false)
+		} else {
+			err = bindMountFile(volume.hostPath, dstPath, "", 0, true)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to set up volume %s: %w", volume.mount.Destination, err)
+		}
+	}
+	return nil
+}
+
+// removeMonitorMountpoints removes the mount points of the volumes and of the
+// rootfs, when it is shared, an image or an initrd, from the rootfs of the
+// monitor. The mounts are gone along with
+// the mount namespace of the monitor, but the mount points get removed one by
+// one, in order to never touch the content of a volume that is still mounted.
+func removeMonitorMountpoints(monRootfs string) error {
+	volumesDir := filepath.Join(monRootfs, monitorVolumesDir)
+	entries, err := os.ReadDir(volumesDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	mountpoints := make([]string, 0, len(entries)+3)
+	for _, entry := range entries {
+		mountpoints = append(mountpoints, filepath.Join(volumesDir, entry.Name()))
+	}
+	mountpoints = append(mountpoints, volumesDir,
+		filepath.Join(monRootfs, monitorSharedRootfsDir),
+		filepath.Join(monRootfs, monitorRootfsImage),
+		filepath.Join(monRootfs, monitorRootfsInitrd),
+		filepath.Dir(volumesDir))
+	for _, mountpoint := range mountpoints {
+		err = os.Remove(mountpoint)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
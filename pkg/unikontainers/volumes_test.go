@@ -0,0 +1,120 @@
+// Copyright (c) 2023-2025, Nubificus LTD
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unikontainers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nubificus/urunc/pkg/unikontainers/hypervisors"
+	"github.com/nubificus/urunc/pkg/unikontainers/unikernels"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVolumeMounts(t *testing.T) {
+	mounts := []specs.Mount{
+		{Destination: "/proc", Type: "proc", Source: "proc"},
+		{Destination: "/etc/resolv.conf", Type: "bind", Source: "/resolv.conf", Options: []string{"rbind", "ro"}},
+		{Destination: "/etc/hosts", Source: "/hosts", Options: []string{"rbind", "rw"}},
+		{Destination: "/data", Source: "/pvc", Options: []string{"rbind", "rw"}},
+		{Destination: "/config", Type: "bind", Source: "/configmap", Options: []string{"ro"}},
+	}
+	volumes := volumeMounts(mounts)
+	assert.Equal(t, []specs.Mount{mounts[3], mounts[4]}, volumes)
+}
+
+func TestPlanVolumes(t *testing.T) {
+	newUnikontainer := func(t *testing.T, mounts ...specs.Mount) *Unikontainer {
+		return &Unikontainer{
+			BaseDir: t.TempDir(),
+			Spec: &specs.Spec{
+				Mounts:  mounts,
+				Process: &specs.Process{},
+			},
+		}
+	}
+	linux, err := unikernels.New(unikernels.LinuxUnikernel)
+	assert.NoError(t, err)
+
+	t.Run("9p", func(t *testing.T) {
+		t.Parallel()
+		source := t.TempDir()
+		u := newUnikontainer(t, specs.Mount{Destination: "/config/", Source: source, Options: []string{"rbind", "ro"}})
+		volumes, err := u.planVolumes(linux, hypervisors.QemuVmm, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, []guestVolume{{
+			hostPath:    source,
+			monitorPath: "/.urunc/volumes/0",
+			mount: unikernels.MountParams{
+				Type:        unikernels.Mount9P,
+				Source:      "vol0",
+				Destination: "/config",
+				ReadOnly:    true,
+			},
+		}}, volumes)
+
+		blocks, dirs, mounts := volumeArgs(volumes)
+		assert.Empty(t, blocks)
+		assert.Equal(t, []hypervisors.SharedDirArgs{{Tag: "vol0", Path: "/.urunc/volumes/0", ReadOnly: true}}, dirs)
+		assert.Equal(t, []unikernels.MountParams{volumes[0].mount}, mounts)
+	})
+
+	t.Run("unsupported unikernel", func(t *testing.T) {
+		t.Parallel()
+		mirage, err := unikernels.New(unikernels.MirageUnikernel)
+		assert.NoError(t, err)
+		u := newUnikontainer(t, specs.Mount{Destination: "/data", Source: t.TempDir(), Options: []string{"rbind"}})
+		volumes, err := u.planVolumes(mirage, hypervisors.QemuVmm, 0)
+		assert.NoError(t, err)
+		assert.Empty(t, volumes)
+	})
+
+	t.Run("unsupported monitor", func(t *testing.T) {
+		t.Parallel()
+		u := newUnikontainer(t, specs.Mount{Destination: "/data", Source: t.TempDir(), Options: []string{"rbind"}})
+		volumes, err := u.planVolumes(linux, hypervisors.HvtVmm, 0)
+		assert.NoError(t, err)
+		assert.Empty(t, volumes)
+	})
+
+	t.Run("files and invalid mount points", func(t *testing.T) {
+		t.Parallel()
+		file := filepath.Join(t.TempDir(), "file")
+		assert.NoError(t, os.WriteFile(file, []byte("data"), 0o600))
+		u := newUnikontainer(t,
+			specs.Mount{Destination: "/file", Source: file, Options: []string{"rbind"}},
+			specs.Mount{Destination: "/my:data", Source: t.TempDir(), Options: []string{"rbind"}},
+		)
+		volumes, err := u.planVolumes(linux, hypervisors.QemuVmm, 0)
+		assert.NoError(t, err)
+		assert.Empty(t, volumes)
+	})
+
+	t.Run("writable volume as block image", func(t *testing.T) {
+		t.Parallel()
+		u := newUnikontainer(t, specs.Mount{Destination: "/data", Source: t.TempDir(), Options: []string{"rbind", "rw"}})
+		_, err := u.planVolumes(linux, hypervisors.FirecrackerVmm, 0)
+		assert.ErrorContains(t, err, "volume /data is writable")
+	})
+
+	t.Run("missing source", func(t *testing.T) {
+		t.Parallel()
+		u := newUnikontainer(t, specs.Mount{Destination: "/data", Source: "/nonexistent/volume", Options: []string{"rbind"}})
+		_, err := u.planVolumes(linux, hypervisors.QemuVmm, 0)
+		assert.Error(t, err)
+	})
+}